@@ -0,0 +1,353 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	rpprof "runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/credentials"
+	"github.com/AtlantPlatform/atlant-go/rs"
+)
+
+// ErrOperationRunning is returned when another admin operation hasn't completed yet.
+var ErrOperationRunning = errors.New("another admin operation is running")
+
+// AdminServer serves operational endpoints, every request must carry the admin token
+// in the Authorization header as "Bearer <token>".
+type AdminServer struct {
+	mux   http.Handler
+	token string
+
+	// running is set while a long running operation is in progress
+	running int32
+}
+
+// NewAdminServer returns new instance of admin http server protected by the token
+func NewAdminServer(token string) *AdminServer {
+	return &AdminServer{
+		token: token,
+	}
+}
+
+// Listen starts a listener for admin server, the address is either a TCP address
+// or a path to unix socket prefixed with "unix:". Returns the final address or an error if any.
+func (a *AdminServer) Listen(addr string) (string, error) {
+	var l net.Listener
+	var err error
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		// remove a stale socket left after an unclean shutdown
+		os.Remove(path)
+		if l, err = net.Listen("unix", path); err != nil {
+			return "", err
+		} else if err = os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return "", err
+		}
+	} else if l, err = net.Listen("tcp", addr); err != nil {
+		return "", err
+	}
+	log.Debugln("AdminServer listen on", l.Addr().String())
+	go http.Serve(l, a.mux)
+	return l.Addr().String(), nil
+}
+
+// RouteAPI sets up GIN routes for admin API
+func (a *AdminServer) RouteAPI(ctx APIContext) {
+	r := gin.Default()
+	r.Use(a.authorize())
+	r.POST("/admin/v1/gc", a.GCHandler(ctx))
+	r.POST("/admin/v1/sync", a.SyncHandler(ctx))
+	r.POST("/admin/v1/repin", a.RepinHandler(ctx))
+	r.GET("/admin/v1/logLevel", a.LogLevelHandler(ctx))
+	r.PUT("/admin/v1/logLevel", a.SetLogLevelHandler(ctx))
+	r.GET("/admin/v1/goroutines", a.GoroutinesHandler(ctx))
+	r.GET("/admin/v1/queues", a.QueuesHandler(ctx))
+	r.GET("/admin/v1/credentials", a.CredentialListHandler(ctx))
+	r.POST("/admin/v1/credentials", a.CredentialCreateHandler(ctx))
+	r.DELETE("/admin/v1/credentials/:id", a.CredentialRevokeHandler(ctx))
+	r.Any("/debug/pprof/*profile", a.PprofHandler(ctx))
+	a.mux = r
+}
+
+func (a *AdminServer) authorize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if len(a.token) == 0 || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			c.AbortWithStatus(401)
+			return
+		}
+		c.Next()
+	}
+}
+
+// runOperation runs fn unless another operation is running.
+func (a *AdminServer) runOperation(c *gin.Context, name string, fn func() (interface{}, error)) {
+	if !atomic.CompareAndSwapInt32(&a.running, 0, 1) {
+		c.String(409, "error: %v", ErrOperationRunning)
+		return
+	}
+	defer atomic.StoreInt32(&a.running, 0)
+	started := time.Now()
+	log.WithField("operation", name).Infoln("admin operation started")
+	result, err := fn()
+	if err != nil {
+		log.WithField("operation", name).Warningf("admin operation failed: %v", err)
+		c.String(500, "error: %v", err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"operation": name,
+		"took":      time.Since(started),
+	}).Infoln("admin operation completed")
+	if result == nil {
+		c.Status(200)
+		return
+	}
+	c.JSON(200, result)
+}
+
+// GCHandler removes record versions that are out of the retention policy and unpins them
+func (a *AdminServer) GCHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.runOperation(c, "gc", func() (interface{}, error) {
+			return nil, rs.GC(ctx.FileStore(), ctx.StateStore(), ctx.RecordStore().Retention())
+		})
+	}
+}
+
+// SyncHandler re-runs the record sync with peers, accepts ?timeout=10m
+func (a *AdminServer) SyncHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, err := queryDuration(c, "timeout", 10*time.Minute)
+		if err != nil {
+			c.String(400, "error: %v", err)
+			return
+		}
+		a.runOperation(c, "sync", func() (interface{}, error) {
+			if err := ctx.RecordStore().Sync(timeout); err != nil {
+				return nil, err
+			}
+			return ctx.RecordStore().SyncProgress(), nil
+		})
+	}
+}
+
+// RepinHandler checks that retained record versions are pinned, missing ones are fetched
+// from peers and pinned again. Accepts ?timeout=1m to limit repair of a single version.
+func (a *AdminServer) RepinHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, err := queryDuration(c, "timeout", time.Minute)
+		if err != nil {
+			c.String(400, "error: %v", err)
+			return
+		}
+		a.runOperation(c, "repin", func() (interface{}, error) {
+			return rs.Fsck(c.Request.Context(), ctx.FileStore(), ctx.StateStore(), rs.FsckOptions{
+				Retention:     ctx.RecordStore().Retention(),
+				Repair:        true,
+				RepairTimeout: timeout,
+			})
+		})
+	}
+}
+
+// LogLevel is the logging verbosity (0 = minimum, 1...4, 5 = debug).
+type LogLevel struct {
+	Level uint32 `json:"level"`
+	Name  string `json:"name"`
+}
+
+// LogLevelHandler returns the current logging verbosity
+func (a *AdminServer) LogLevelHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		level := log.GetLevel()
+		c.JSON(200, &LogLevel{
+			Level: uint32(level),
+			Name:  level.String(),
+		})
+	}
+}
+
+// SetLogLevelHandler changes the logging verbosity, accepts a JSON body {"level": 5}
+func (a *AdminServer) SetLogLevelHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req *LogLevel
+		if err := c.BindJSON(&req); err != nil {
+			return
+		} else if req == nil || req.Level > uint32(log.DebugLevel) {
+			c.String(400, "error: level must be within 0...%d", log.DebugLevel)
+			return
+		}
+		log.SetLevel(log.Level(req.Level))
+		log.Infof("log level set to %v", log.GetLevel())
+		level := log.GetLevel()
+		c.JSON(200, &LogLevel{
+			Level: uint32(level),
+			Name:  level.String(),
+		})
+	}
+}
+
+// GoroutinesHandler dumps stacks of all goroutines as text
+func (a *AdminServer) GoroutinesHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		if err := rpprof.Lookup("goroutine").WriteTo(c.Writer, 2); err != nil {
+			c.String(500, "error: %v", err)
+		}
+	}
+}
+
+// Queues contains depths of the record store pumps and work done.
+type Queues struct {
+	State          string `json:"state"`
+	InboundQueue   int64  `json:"inbound_queue"`
+	OutboundQueue  int64  `json:"outbound_queue"`
+	InboundWork    uint64 `json:"inbound_work_total"`
+	OutboundWork   uint64 `json:"outbound_work_total"`
+	PendingFetches int    `json:"pending_fetches"`
+}
+
+// QueuesHandler returns depths of the record store pumps
+func (a *AdminServer) QueuesHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		m := ctx.RecordStore().StoreMetrics()
+		c.JSON(200, &Queues{
+			State:          m.State,
+			InboundQueue:   m.InboundQueue,
+			OutboundQueue:  m.OutboundQueue,
+			InboundWork:    m.InboundWork,
+			OutboundWork:   m.OutboundWork,
+			PendingFetches: ctx.RecordStore().PendingFetches(),
+		})
+	}
+}
+
+// CredentialRequest describes an API credential to create
+type CredentialRequest struct {
+	Name   string              `json:"name"`
+	Scopes []credentials.Scope `json:"scopes"`
+	Prefix string              `json:"prefix"`
+}
+
+// CredentialToken is a created API credential along with its token, the token can't be retrieved later
+type CredentialToken struct {
+	*credentials.Credential
+	Token string `json:"token"`
+}
+
+// CredentialListHandler lists API credentials of the public API
+func (a *AdminServer) CredentialListHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		creds := ctx.Credentials()
+		if creds == nil {
+			c.String(503, "error: credentials are not enabled")
+			return
+		}
+		list, err := creds.List()
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.JSON(200, list)
+	}
+}
+
+// CredentialCreateHandler creates an API credential, accepts a JSON body
+// {"name": "uploader", "scopes": ["read", "write"], "prefix": "/docs/"}
+func (a *AdminServer) CredentialCreateHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		creds := ctx.Credentials()
+		if creds == nil {
+			c.String(503, "error: credentials are not enabled")
+			return
+		}
+		var req CredentialRequest
+		if err := c.BindJSON(&req); err != nil {
+			return
+		}
+		cred, token, err := creds.Create(req.Name, req.Scopes, req.Prefix)
+		if err == credentials.ErrInvalidCredential {
+			c.String(400, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		log.WithFields(log.Fields{
+			"id":     cred.ID,
+			"name":   cred.Name,
+			"scopes": cred.Scopes,
+			"prefix": cred.Prefix,
+		}).Infoln("API credential created")
+		c.JSON(200, &CredentialToken{
+			Credential: cred,
+			Token:      token,
+		})
+	}
+}
+
+// CredentialRevokeHandler removes an API credential
+func (a *AdminServer) CredentialRevokeHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		creds := ctx.Credentials()
+		if creds == nil {
+			c.String(503, "error: credentials are not enabled")
+			return
+		}
+		if err := creds.Revoke(c.Param("id")); err == credentials.ErrNotFound {
+			c.AbortWithStatus(404)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		log.WithField("id", c.Param("id")).Infoln("API credential revoked")
+		c.Status(200)
+	}
+}
+
+// PprofHandler serves runtime profiles the way net/http/pprof does
+func (a *AdminServer) PprofHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch strings.TrimPrefix(c.Param("profile"), "/") {
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			// serves the index and named profiles, e.g. heap or goroutine
+			pprof.Index(c.Writer, c.Request)
+		}
+	}
+}
+
+func queryDuration(c *gin.Context, name string, defaults time.Duration) (time.Duration, error) {
+	v := c.Query(name)
+	if len(v) == 0 {
+		return defaults, nil
+	}
+	dur, err := time.ParseDuration(v)
+	if err != nil || dur <= 0 {
+		return 0, errors.New("invalid duration: " + v)
+	}
+	return dur, nil
+}
@@ -0,0 +1,140 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package api
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AtlantPlatform/atlant-go/credentials"
+	"github.com/AtlantPlatform/atlant-go/rs"
+)
+
+// AuthMode tells which requests to the public API require credentials.
+type AuthMode string
+
+const (
+	// AuthOff serves all requests without credentials
+	AuthOff AuthMode = "off"
+	// AuthWrite requires credentials to write and delete records
+	AuthWrite AuthMode = "write"
+	// AuthAll requires credentials to read records as well
+	AuthAll AuthMode = "all"
+)
+
+// AuthOpt sets which requests to the public API require credentials.
+func AuthOpt(mode AuthMode) ServerOpt {
+	return func(p *PublicServer) {
+		p.authMode = mode
+	}
+}
+
+// credentialKey keeps the authenticated credential in gin context.
+const credentialKey = "credential"
+
+func (p *PublicServer) isAuthRequired(scope credentials.Scope) bool {
+	switch p.authMode {
+	case AuthAll:
+		return true
+	case AuthWrite:
+		return scope != credentials.ScopeRead
+	default:
+		return false
+	}
+}
+
+// authenticate checks that the request carries a token of credential with the scope, if required.
+// Handlers check the path of the record with allowPath.
+func (p *PublicServer) authenticate(ctx APIContext, scope credentials.Scope) gin.HandlerFunc {
+	required := p.requireScope(ctx, scope)
+	return func(c *gin.Context) {
+		if !p.isAuthRequired(scope) {
+			return
+		}
+		required(c)
+	}
+}
+
+// requireScope checks that the request carries a token of credential with the scope regardless
+// of the auth mode, for routes that expose secrets or make the node send requests.
+func (p *PublicServer) requireScope(ctx APIContext, scope credentials.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		creds := ctx.Credentials()
+		if creds == nil {
+			c.String(503, "error: credentials are not enabled")
+			c.Abort()
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if len(token) == 0 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatus(401)
+			return
+		}
+		cred, err := creds.Authenticate(token)
+		if err == credentials.ErrInvalidToken {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.String(401, "error: %v", err)
+			c.Abort()
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			c.Abort()
+			return
+		} else if !cred.HasScope(scope) {
+			c.String(403, "error: credential has no %s scope", scope)
+			c.Abort()
+			return
+		}
+		c.Set(credentialKey, cred)
+	}
+}
+
+// requestCredential returns the credential the request has been authenticated with, if any.
+func requestCredential(c *gin.Context) *credentials.Credential {
+	if v, ok := c.Get(credentialKey); ok {
+		return v.(*credentials.Credential)
+	}
+	return nil
+}
+
+// allowPath checks that the credential of the request allows the path, responds with 403 otherwise.
+func allowPath(c *gin.Context, path string) bool {
+	if cred := requestCredential(c); cred != nil && !cred.AllowsPath(path) {
+		c.String(403, "error: path is outside of the credential prefix: %s", path)
+		return false
+	}
+	return true
+}
+
+// objectPath returns the path of the record version that has been read.
+func objectPath(r *rs.Record) string {
+	if meta := r.Object.Meta(); meta != nil {
+		return meta.Path()
+	}
+	return ""
+}
+
+// allowScope checks that the credential of the request has the scope, responds with 403 otherwise.
+func allowScope(c *gin.Context, scope credentials.Scope) bool {
+	if cred := requestCredential(c); cred != nil && !cred.HasScope(scope) {
+		c.String(403, "error: credential has no %s scope", scope)
+		return false
+	}
+	return true
+}
+
+// requireSynced rejects requests with 503 until the record store has finished
+// the initial sync, writes before that would be checked against an incomplete path index
+func (p *PublicServer) requireSynced(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctx.RecordStore().IsReady() {
+			c.Header("Retry-After", "10")
+			c.String(503, "error: record store is syncing")
+			c.Abort()
+		}
+	}
+}
@@ -8,9 +8,11 @@ import (
 	"context"
 
 	"github.com/AtlantPlatform/atlant-go/contracts"
+	"github.com/AtlantPlatform/atlant-go/credentials"
 	"github.com/AtlantPlatform/atlant-go/fs"
 	"github.com/AtlantPlatform/atlant-go/rs"
 	"github.com/AtlantPlatform/atlant-go/state"
+	"github.com/AtlantPlatform/atlant-go/webhooks"
 )
 
 // APIContext structure to store API Context
@@ -62,6 +64,24 @@ func (c APIContext) StateStore() state.IndexedStore {
 	return c.Value("ss").(state.IndexedStore)
 }
 
+// Webhooks returns the webhook manager, if webhooks are enabled
+func (c APIContext) Webhooks() *webhooks.Manager {
+	v := c.Value("webhooks")
+	if v == nil {
+		return nil
+	}
+	return v.(*webhooks.Manager)
+}
+
+// Credentials returns the API credential manager, if credentials are enabled
+func (c APIContext) Credentials() *credentials.Manager {
+	v := c.Value("credentials")
+	if v == nil {
+		return nil
+	}
+	return v.(*credentials.Manager)
+}
+
 // ContractsManager returns manager for contracts
 func (c APIContext) ContractsManager() contracts.Manager {
 	v := c.Value("contracts")
@@ -0,0 +1,146 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+)
+
+// ReadinessOpts sets thresholds of the readiness checks.
+type ReadinessOpts struct {
+	// MinPeers is the number of connected IPFS peers required.
+	MinPeers int
+	// MaxAuthAge is the maximum age of the last auth center refresh, zero disables the check.
+	MaxAuthAge time.Duration
+	// MinDiskFree is the number of bytes required to be available on the IPFS storage volume.
+	MinDiskFree uint64
+}
+
+// DefaultReadinessOpts are used unless overridden with ReadinessOpt.
+var DefaultReadinessOpts = ReadinessOpts{
+	MinPeers:    1,
+	MaxAuthAge:  10 * time.Minute,
+	MinDiskFree: 1 * GB,
+}
+
+// ServerOpt configures the public server
+type ServerOpt func(p *PublicServer)
+
+// ReadinessOpt sets thresholds of the readiness checks.
+func ReadinessOpt(opts ReadinessOpts) ServerOpt {
+	return func(p *PublicServer) {
+		p.readiness = opts
+	}
+}
+
+// HealthCheck is the result of a single readiness check.
+type HealthCheck struct {
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Health is the breakdown of readiness checks.
+type Health struct {
+	OK     bool                    `json:"ok"`
+	Checks map[string]*HealthCheck `json:"checks"`
+}
+
+// HealthzHandler reports that the node process is alive and serving requests
+func (p *PublicServer) HealthzHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(200, &Health{
+			OK:     true,
+			Checks: map[string]*HealthCheck{},
+		})
+	}
+}
+
+// ReadyzHandler reports whether the node is able to serve consistent data,
+// responds with 503 if any of the checks fails
+func (p *PublicServer) ReadyzHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		health := p.checkReadiness(ctx, time.Now())
+		if !health.OK {
+			c.JSON(503, health)
+			return
+		}
+		c.JSON(200, health)
+	}
+}
+
+func (p *PublicServer) checkReadiness(ctx APIContext, now time.Time) *Health {
+	opts := p.readiness
+	checks := make(map[string]*HealthCheck)
+
+	store := ctx.RecordStore()
+	checks["store"] = &HealthCheck{
+		OK: store.IsReady(),
+	}
+	progress := store.SyncProgress()
+	checks["store"].Detail = progress.State
+
+	sync := &HealthCheck{
+		OK: progress.FinishedAt > 0,
+	}
+	switch {
+	case progress.StartedAt == 0:
+		sync.Detail = "not started"
+	case sync.OK:
+		took := time.Duration(progress.FinishedAt - progress.StartedAt)
+		sync.Detail = fmt.Sprintf("%d records imported from %d peers in %s", progress.Imported, progress.Peers, took)
+	default:
+		elapsed := now.Sub(time.Unix(0, progress.StartedAt))
+		sync.Detail = fmt.Sprintf("%d records imported from %d peers in %s so far", progress.Imported, progress.Peers, elapsed)
+	}
+	checks["sync"] = sync
+
+	peers := ctx.FileStore().PeerCount()
+	checks["peers"] = &HealthCheck{
+		OK:     peers >= opts.MinPeers,
+		Detail: fmt.Sprintf("%d connected, %d required", peers, opts.MinPeers),
+	}
+
+	auth := &HealthCheck{
+		OK: true,
+	}
+	if authcenter.Default == nil {
+		auth.Detail = "not configured"
+	} else if last := authcenter.Default.LastRefresh(); last.IsZero() {
+		auth.OK = opts.MaxAuthAge == 0
+		auth.Detail = "never refreshed"
+	} else {
+		age := now.Sub(last)
+		auth.OK = opts.MaxAuthAge == 0 || age <= opts.MaxAuthAge
+		auth.Detail = fmt.Sprintf("refreshed %s ago", age.Round(time.Second))
+	}
+	checks["auth"] = auth
+
+	disk := &HealthCheck{}
+	if ds, err := ctx.FileStore().DiskStats(); err != nil {
+		disk.Detail = err.Error()
+	} else {
+		disk.OK = ds.BytesFree >= opts.MinDiskFree
+		disk.Detail = fmt.Sprintf("%s free, %s required",
+			humanBytes(int64(ds.BytesFree), 1024), humanBytes(int64(opts.MinDiskFree), 1024))
+	}
+	checks["disk"] = disk
+
+	health := &Health{
+		OK:     true,
+		Checks: checks,
+	}
+	for _, check := range checks {
+		if !check.OK {
+			health.OK = false
+			break
+		}
+	}
+	return health
+}
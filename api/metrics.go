@@ -0,0 +1,286 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/rs"
+)
+
+const metricsNamespace = "atlant"
+
+// routeUnmatched labels requests that haven't been routed to any of the API handlers.
+const routeUnmatched = "unmatched"
+
+// MetricsHandler is endpoint to expose node metrics in Prometheus text format
+func (p *PublicServer) MetricsHandler(ctx APIContext) gin.HandlerFunc {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		newNodeCollector(ctx),
+		p.requestDuration,
+		peerRejections,
+	)
+	return gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+}
+
+func newRequestDuration() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of API requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "code"})
+}
+
+// routeLookup maps the handler of a request to the route pattern it has been registered with.
+type routeLookup struct {
+	once   sync.Once
+	engine *gin.Engine
+	routes map[string][]string
+}
+
+func (l *routeLookup) route(c *gin.Context) string {
+	l.once.Do(func() {
+		l.routes = make(map[string][]string)
+		for _, info := range l.engine.Routes() {
+			key := info.Method + " " + info.Handler
+			l.routes[key] = append(l.routes[key], info.Path)
+		}
+	})
+	paths := l.routes[c.Request.Method+" "+c.HandlerName()]
+	if len(paths) == 1 {
+		return paths[0]
+	}
+	// the same handler serves several static routes
+	for _, path := range paths {
+		if path == c.Request.URL.Path {
+			return path
+		}
+	}
+	return routeUnmatched
+}
+
+// observeRequests records the latency of each request labeled by its route pattern,
+// so requests to different records share the same series.
+func (p *PublicServer) observeRequests(r *gin.Engine) gin.HandlerFunc {
+	lookup := &routeLookup{
+		engine: r,
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		p.requestDuration.WithLabelValues(
+			c.Request.Method,
+			lookup.route(c),
+			strconv.Itoa(c.Writer.Status()),
+		).Observe(time.Since(start).Seconds())
+	}
+}
+
+// nodeCollector exports stats of the node stores that are collected on scrape.
+type nodeCollector struct {
+	ctx APIContext
+
+	storeState     *prometheus.Desc
+	inboundWork    *prometheus.Desc
+	outboundWork   *prometheus.Desc
+	inboundQueue   *prometheus.Desc
+	outboundQueue  *prometheus.Desc
+	handled        *prometheus.Desc
+	rejected       *prometheus.Desc
+	pendingFetches *prometheus.Desc
+	peers          *prometheus.Desc
+	authEntries    *prometheus.Desc
+
+	badgerCounters map[string]*prometheus.Desc
+	badgerLevels   map[string]*prometheus.Desc
+	badgerDirs     map[string]*prometheus.Desc
+
+	bandwidthTotal *prometheus.Desc
+	bandwidthRate  *prometheus.Desc
+	repoObjects    *prometheus.Desc
+	repoSize       *prometheus.Desc
+	repoStorageMax *prometheus.Desc
+	bitswapMetrics map[string]*prometheus.Desc
+}
+
+func newNodeCollector(ctx APIContext) *nodeCollector {
+	desc := func(subsystem, name, help string, labels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, subsystem, name), help, labels, nil)
+	}
+	return &nodeCollector{
+		ctx: ctx,
+
+		storeState:     desc("rs", "state", "Sync state of the record store, the current one is set to 1.", "state"),
+		inboundWork:    desc("rs", "inbound_work_total", "Number of inbound announces processed by workers."),
+		outboundWork:   desc("rs", "outbound_work_total", "Number of outbound announces processed by workers."),
+		inboundQueue:   desc("rs", "inbound_queue_depth", "Number of inbound announces waiting in the pump."),
+		outboundQueue:  desc("rs", "outbound_queue_depth", "Number of outbound announces waiting in the pump."),
+		handled:        desc("rs", "announces_handled_total", "Number of received announces handled by type.", "type"),
+		rejected:       desc("rs", "announces_rejected_total", "Number of received announces rejected by type and reason.", "type", "reason"),
+		pendingFetches: desc("rs", "pending_fetches", "Number of record versions waiting for their content."),
+		peers:          desc("fs", "peers", "Number of connected IPFS peers."),
+		authEntries:    desc("auth", "entries", "Number of nodes known to the auth center."),
+
+		badgerCounters: map[string]*prometheus.Desc{
+			"disk_reads_total":    desc("badger", "disk_reads_total", "Number of badger disk reads."),
+			"disk_writes_total":   desc("badger", "disk_writes_total", "Number of badger disk writes."),
+			"read_bytes":          desc("badger", "read_bytes", "Number of bytes read by badger."),
+			"written_bytes":       desc("badger", "written_bytes", "Number of bytes written by badger."),
+			"gets_total":          desc("badger", "gets_total", "Number of badger gets."),
+			"puts_total":          desc("badger", "puts_total", "Number of badger puts."),
+			"blocked_puts_total":  desc("badger", "blocked_puts_total", "Number of badger blocked puts."),
+			"memtable_gets_total": desc("badger", "memtable_gets_total", "Number of badger memtable gets."),
+		},
+		badgerLevels: map[string]*prometheus.Desc{
+			"lsm_level_gets_total": desc("badger", "lsm_level_gets_total", "Number of badger LSM gets by level.", "level"),
+			"lsm_bloom_hits_total": desc("badger", "lsm_bloom_hits_total", "Number of badger LSM bloom hits by level.", "level"),
+		},
+		badgerDirs: map[string]*prometheus.Desc{
+			"lsm_size_bytes":       desc("badger", "lsm_size_bytes", "Size of badger LSM tables.", "dir"),
+			"vlog_size_bytes":      desc("badger", "vlog_size_bytes", "Size of badger value log.", "dir"),
+			"pending_writes_total": desc("badger", "pending_writes_total", "Number of badger pending writes.", "dir"),
+		},
+
+		bandwidthTotal: desc("fs", "bandwidth_bytes_total", "Number of bytes transferred by direction.", "direction"),
+		bandwidthRate:  desc("fs", "bandwidth_rate_bytes", "Bytes per second transferred by direction.", "direction"),
+		repoObjects:    desc("fs", "repo_objects", "Number of objects in the IPFS repo."),
+		repoSize:       desc("fs", "repo_size_bytes", "Size of the IPFS repo."),
+		repoStorageMax: desc("fs", "repo_storage_max_bytes", "Maximum size of the IPFS repo."),
+		bitswapMetrics: map[string]*prometheus.Desc{
+			"provide_buf_len":         desc("bitswap", "provide_buf_len", "Length of the bitswap provide buffer."),
+			"wantlist_len":            desc("bitswap", "wantlist_len", "Length of the bitswap wantlist."),
+			"peers":                   desc("bitswap", "peers", "Number of bitswap partners."),
+			"blocks_received_total":   desc("bitswap", "blocks_received_total", "Number of blocks received."),
+			"data_received_bytes":     desc("bitswap", "data_received_bytes", "Number of bytes received."),
+			"blocks_sent_total":       desc("bitswap", "blocks_sent_total", "Number of blocks sent."),
+			"data_sent_bytes":         desc("bitswap", "data_sent_bytes", "Number of bytes sent."),
+			"dup_blocks_received":     desc("bitswap", "dup_blocks_received_total", "Number of duplicate blocks received."),
+			"dup_data_received_bytes": desc("bitswap", "dup_data_received_bytes", "Number of duplicate bytes received."),
+		},
+	}
+}
+
+func (n *nodeCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		n.storeState, n.inboundWork, n.outboundWork, n.inboundQueue, n.outboundQueue,
+		n.handled, n.rejected, n.pendingFetches, n.peers, n.authEntries,
+		n.bandwidthTotal, n.bandwidthRate, n.repoObjects, n.repoSize, n.repoStorageMax,
+	} {
+		ch <- d
+	}
+	for _, descs := range []map[string]*prometheus.Desc{
+		n.badgerCounters, n.badgerLevels, n.badgerDirs, n.bitswapMetrics,
+	} {
+		for _, d := range descs {
+			ch <- d
+		}
+	}
+}
+
+func (n *nodeCollector) Collect(ch chan<- prometheus.Metric) {
+	n.collectRecordStore(ch)
+	n.collectBadger(ch, n.ctx.RecordStore().BadgerStats())
+	n.collectFileStore(ch)
+	if auth := authcenter.Default; auth != nil {
+		ch <- prometheus.MustNewConstMetric(n.authEntries, prometheus.GaugeValue, float64(len(auth.Entries())))
+	}
+}
+
+func (n *nodeCollector) collectRecordStore(ch chan<- prometheus.Metric) {
+	m := n.ctx.RecordStore().StoreMetrics()
+	for _, state := range []string{"inactive", "sync", "active"} {
+		var v float64
+		if state == m.State {
+			v = 1
+		}
+		ch <- prometheus.MustNewConstMetric(n.storeState, prometheus.GaugeValue, v, state)
+	}
+	ch <- prometheus.MustNewConstMetric(n.inboundWork, prometheus.CounterValue, float64(m.InboundWork))
+	ch <- prometheus.MustNewConstMetric(n.outboundWork, prometheus.CounterValue, float64(m.OutboundWork))
+	ch <- prometheus.MustNewConstMetric(n.inboundQueue, prometheus.GaugeValue, float64(m.InboundQueue))
+	ch <- prometheus.MustNewConstMetric(n.outboundQueue, prometheus.GaugeValue, float64(m.OutboundQueue))
+	for typ, count := range m.Handled {
+		ch <- prometheus.MustNewConstMetric(n.handled, prometheus.CounterValue, float64(count), typ.String())
+	}
+	for typ, reasons := range m.Rejected {
+		for reason, count := range reasons {
+			ch <- prometheus.MustNewConstMetric(n.rejected, prometheus.CounterValue, float64(count), typ.String(), reason)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(n.pendingFetches, prometheus.GaugeValue, float64(n.ctx.RecordStore().PendingFetches()))
+}
+
+func (n *nodeCollector) collectBadger(ch chan<- prometheus.Metric, stats *rs.BadgerStats) {
+	if stats == nil {
+		return
+	}
+	for name, v := range map[string]int64{
+		"disk_reads_total":    stats.NumReads,
+		"disk_writes_total":   stats.NumWrites,
+		"read_bytes":          stats.NumBytesRead,
+		"written_bytes":       stats.NumBytesWritten,
+		"gets_total":          stats.NumGets,
+		"puts_total":          stats.NumPuts,
+		"blocked_puts_total":  stats.NumBlockedPuts,
+		"memtable_gets_total": stats.NumMemtableGets,
+	} {
+		ch <- prometheus.MustNewConstMetric(n.badgerCounters[name], prometheus.CounterValue, float64(v))
+	}
+	labeled := func(d *prometheus.Desc, typ prometheus.ValueType, raw json.RawMessage) {
+		// badger exposes these as expvar maps, keyed by LSM level or by the store directory
+		var values map[string]float64
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return
+		}
+		for label, v := range values {
+			ch <- prometheus.MustNewConstMetric(d, typ, v, label)
+		}
+	}
+	labeled(n.badgerLevels["lsm_level_gets_total"], prometheus.CounterValue, stats.NumLSMGets)
+	labeled(n.badgerLevels["lsm_bloom_hits_total"], prometheus.CounterValue, stats.NumLSMBloomHits)
+	labeled(n.badgerDirs["lsm_size_bytes"], prometheus.GaugeValue, stats.LSMSize)
+	labeled(n.badgerDirs["vlog_size_bytes"], prometheus.GaugeValue, stats.VlogSize)
+	labeled(n.badgerDirs["pending_writes_total"], prometheus.GaugeValue, stats.PendingWrites)
+}
+
+func (n *nodeCollector) collectFileStore(ch chan<- prometheus.Metric) {
+	fileStore := n.ctx.FileStore()
+	ch <- prometheus.MustNewConstMetric(n.peers, prometheus.GaugeValue, float64(fileStore.PeerCount()))
+	if bw := fileStore.BandwidthStats(); bw != nil {
+		ch <- prometheus.MustNewConstMetric(n.bandwidthTotal, prometheus.CounterValue, float64(bw.TotalIn), "in")
+		ch <- prometheus.MustNewConstMetric(n.bandwidthTotal, prometheus.CounterValue, float64(bw.TotalOut), "out")
+		ch <- prometheus.MustNewConstMetric(n.bandwidthRate, prometheus.GaugeValue, bw.RateIn, "in")
+		ch <- prometheus.MustNewConstMetric(n.bandwidthRate, prometheus.GaugeValue, bw.RateOut, "out")
+	}
+	if repo := fileStore.RepoStats(); repo != nil {
+		ch <- prometheus.MustNewConstMetric(n.repoObjects, prometheus.GaugeValue, float64(repo.NumObjects))
+		ch <- prometheus.MustNewConstMetric(n.repoSize, prometheus.GaugeValue, float64(repo.RepoSize))
+		ch <- prometheus.MustNewConstMetric(n.repoStorageMax, prometheus.GaugeValue, float64(repo.StorageMax))
+	}
+	if bs := fileStore.BitswapStats(); bs != nil {
+		b := n.bitswapMetrics
+		ch <- prometheus.MustNewConstMetric(b["provide_buf_len"], prometheus.GaugeValue, float64(bs.ProvideBufLen))
+		ch <- prometheus.MustNewConstMetric(b["wantlist_len"], prometheus.GaugeValue, float64(bs.WantlistLen))
+		ch <- prometheus.MustNewConstMetric(b["peers"], prometheus.GaugeValue, float64(len(bs.Peers)))
+		ch <- prometheus.MustNewConstMetric(b["blocks_received_total"], prometheus.CounterValue, float64(bs.BlocksReceived))
+		ch <- prometheus.MustNewConstMetric(b["data_received_bytes"], prometheus.CounterValue, float64(bs.DataReceived))
+		ch <- prometheus.MustNewConstMetric(b["blocks_sent_total"], prometheus.CounterValue, float64(bs.BlocksSent))
+		ch <- prometheus.MustNewConstMetric(b["data_sent_bytes"], prometheus.CounterValue, float64(bs.DataSent))
+		ch <- prometheus.MustNewConstMetric(b["dup_blocks_received"], prometheus.CounterValue, float64(bs.DupBlksReceived))
+		ch <- prometheus.MustNewConstMetric(b["dup_data_received_bytes"], prometheus.CounterValue, float64(bs.DupDataReceived))
+	}
+}
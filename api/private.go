@@ -5,15 +5,33 @@
 package api
 
 import (
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
 	"github.com/AtlantPlatform/atlant-go/rs"
 )
 
+// peerRejections counts private API requests of peers that lack the permission, exposed on /metrics.
+var peerRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: metricsNamespace,
+	Name:      "private_rejected_requests_total",
+	Help:      "Private API requests rejected because the peer lacks the permission.",
+}, []string{"route", "permission"})
+
 // PrivateServer contains http server descriptor
 type PrivateServer struct {
 	mux http.Handler
@@ -26,6 +44,8 @@ func NewPrivateServer() *PrivateServer {
 
 // Listen starts a TCP listener, for private server it is advised to use a randomly
 // assinged port, e.g. "127.0.0.1:0". Returns the final address or an error if any.
+// Only streams forwarded by fs.PlanetaryListener are served, the remote address of
+// each request is the ID of the peer.
 func (p *PrivateServer) Listen(addr string) (string, error) {
 	l, err := net.Listen("tcp4", addr)
 	if err != nil {
@@ -33,7 +53,7 @@ func (p *PrivateServer) Listen(addr string) (string, error) {
 	}
 	log.Debugln("PrivateServer listen on", l.Addr().String())
 	// start a HTTP server using node's private listener
-	go http.Serve(l, p.mux)
+	go http.Serve(fs.NewPeerListener(l), p.mux)
 	return l.Addr().String(), nil
 }
 
@@ -41,11 +61,29 @@ func (p *PrivateServer) Listen(addr string) (string, error) {
 func (p *PrivateServer) RouteAPI(ctx APIContext) {
 	r := gin.Default()
 	r.GET("/private/v1/ping", p.PingHandler(ctx))
-	r.GET("/private/v1/records", p.RecordsHandler(ctx))
-	r.POST("/private/v1/announce", p.AnnounceHandler(ctx))
+	r.GET("/private/v1/records", p.authorizePeer(authcenter.RecordSyncPermission), p.RecordsHandler(ctx))
+	r.GET("/private/v1/digest", p.authorizePeer(authcenter.RecordSyncPermission), p.DigestHandler(ctx))
+	r.POST("/private/v1/announce", p.authorizePeer(authcenter.RecordWritePermission), p.AnnounceHandler(ctx))
 	p.mux = r
 }
 
+// authorizePeer allows requests of peers that have the permission in the auth center.
+func (p *PrivateServer) authorizePeer(perm authcenter.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		peerID := c.Request.RemoteAddr
+		if authcenter.Default != nil && authcenter.Default.HasPermissions(peerID, perm) {
+			return
+		}
+		log.WithFields(log.Fields{
+			"peer":       peerID,
+			"permission": perm,
+			"route":      c.Request.URL.Path,
+		}).Warningln("private API request of unauthorized peer rejected")
+		peerRejections.WithLabelValues(c.Request.URL.Path, string(perm)).Inc()
+		c.AbortWithStatus(403)
+	}
+}
+
 // PingHandler returns HTTP response with NodeID
 func (p *PrivateServer) PingHandler(ctx APIContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -56,21 +94,82 @@ func (p *PrivateServer) PingHandler(ctx APIContext) gin.HandlerFunc {
 // RecordsHandler returns HTTP response with records exported
 func (p *PrivateServer) RecordsHandler(ctx APIContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if err := ctx.RecordStore().ExportRecords(ctx, c.Writer); err != nil {
+		since, err := parseSince(c.Query("since"))
+		if err != nil {
+			c.String(400, "error: %v", err)
+			return
+		}
+		var buckets []int
+		if v := c.Query("buckets"); len(v) > 0 {
+			for _, b := range strings.Split(v, ",") {
+				i, err := strconv.Atoi(b)
+				if err != nil || i < 0 || i >= rs.DigestBuckets {
+					c.String(400, "error: invalid bucket: %s", b)
+					return
+				}
+				buckets = append(buckets, i)
+			}
+		}
+		if err := ctx.RecordStore().ExportRecords(ctx, c.Writer, rs.ExportOptions{
+			Since:   since,
+			Buckets: buckets,
+		}); err != nil {
 			c.AbortWithStatus(500)
 		}
 		c.Status(200)
 	}
 }
 
-// AnnounceHandler endpoint to reace on event announcements
+// DigestHandler returns the digest of all records, used to find records that differ between nodes
+func (p *PrivateServer) DigestHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		digest, err := ctx.RecordStore().RecordsDigest(ctx)
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.JSON(200, digest)
+	}
+}
+
+// parseSince parses a sync cursor, that is either a ULID or a timestamp in Unix nanoseconds.
+func parseSince(v string) (int64, error) {
+	if len(v) == 0 {
+		return 0, nil
+	}
+	if u, err := ulid.Parse(v); err == nil {
+		return int64(u.Time()) * int64(time.Millisecond), nil
+	}
+	since, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || since < 0 {
+		return 0, fmt.Errorf("invalid since cursor: %s", v)
+	}
+	return since, nil
+}
+
+// maxAnnounceSize limits the body of an announce pushed by a peer.
+const maxAnnounceSize = 4 * MB
+
+// AnnounceHandler endpoint to receive record announces pushed by writers directly. The body is
+// a packed announce as published to pubsub, the type is passed as topic, e.g. ?type=record-update
 func (p *PrivateServer) AnnounceHandler(ctx APIContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var event *rs.EventAnnounce
-		if err := c.BindJSON(&event); err != nil {
+		typ := rs.EventFromTopic(c.Query("type"))
+		switch typ {
+		case rs.EventRecordUpdate, rs.EventRecordBatch:
+		default:
+			c.String(400, "error: unsupported announce type: %s", c.Query("type"))
+			return
+		}
+		seg, err := capn.ReadFromPackedStream(io.LimitReader(c.Request.Body, maxAnnounceSize), nil)
+		if err != nil {
+			c.String(400, "error: failed to decode announce: %v", err)
 			return
 		}
-		ctx.RecordStore().ReceiveEventAnnounce(event)
+		ctx.RecordStore().ReceiveEventAnnounce(&rs.EventAnnounce{
+			Type:     typ,
+			Announce: proto.ReadRootAnnounce(seg),
+		})
 		c.Status(200)
 	}
 }
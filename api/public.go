@@ -6,10 +6,12 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
+	"io/ioutil"
 	"math"
 	"mime"
 	"net/http"
@@ -20,10 +22,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/AtlantPlatform/atlant-go/contracts"
+	"github.com/AtlantPlatform/atlant-go/credentials"
 	"github.com/AtlantPlatform/atlant-go/fs"
 	"github.com/AtlantPlatform/atlant-go/proto"
 	"github.com/AtlantPlatform/atlant-go/rs"
@@ -33,13 +38,24 @@ import (
 type PublicServer struct {
 	mux       *gin.Engine
 	startedAt time.Time
+
+	requestDuration *prometheus.HistogramVec
+	readiness       ReadinessOpts
+	authMode        AuthMode
 }
 
 // NewPublicServer is a constructor of the PublicServer
-func NewPublicServer() *PublicServer {
-	return &PublicServer{
-		startedAt: time.Now(),
+func NewPublicServer(opts ...ServerOpt) *PublicServer {
+	p := &PublicServer{
+		startedAt:       time.Now(),
+		requestDuration: newRequestDuration(),
+		readiness:       DefaultReadinessOpts,
+		authMode:        AuthOff,
+	}
+	for _, o := range opts {
+		o(p)
 	}
+	return p
 }
 
 // ListenAndServe starts server binded to address i.e. "0.0.0.0:33780"
@@ -50,12 +66,27 @@ func (p *PublicServer) ListenAndServe(addr string) error {
 // RouteAPI initializes GIN routes
 func (p *PublicServer) RouteAPI(ctx APIContext) {
 	r := gin.Default()
-	r.POST("/api/v1/put/*path", p.PutHandler(ctx))
-	r.POST("/api/v1/delete/:id", p.DeleteHandler(ctx))
-	r.GET("/api/v1/content/*path", p.ContentHandler(ctx))
-	r.GET("/api/v1/meta/*path", p.MetaHandler(ctx))
-	r.GET("/api/v1/listVersions/*path", p.ListVersionsHandler(ctx))
-	r.GET("/api/v1/listAll/*prefix", p.ListAllHandler(ctx))
+	r.Use(p.observeRequests(r))
+	read := p.authenticate(ctx, credentials.ScopeRead)
+	write := p.authenticate(ctx, credentials.ScopeWrite)
+	synced := p.requireSynced(ctx)
+	r.POST("/api/v1/put/*path", write, synced, p.PutHandler(ctx))
+	r.POST("/api/v1/delete/:id", p.authenticate(ctx, credentials.ScopeDelete), synced, p.DeleteHandler(ctx))
+	r.POST("/api/v1/restore/*path", write, synced, p.RestoreHandler(ctx))
+	r.POST("/api/v1/batch", write, synced, p.BatchHandler(ctx))
+	r.GET("/api/v1/content/*path", read, p.ContentHandler(ctx))
+	r.GET("/api/v1/meta/*path", read, p.MetaHandler(ctx))
+	r.GET("/api/v1/listVersions/*path", read, p.ListVersionsHandler(ctx))
+	r.GET("/api/v1/listAll/*prefix", read, p.ListAllHandler(ctx))
+	r.GET("/api/v1/watch/*prefix", read, p.WatchHandler(ctx))
+	r.GET("/api/v1/conflicts", read, p.ConflictsHandler(ctx))
+	// webhooks carry secrets and make the node send requests, so credentials are required in any auth mode
+	hooksRead := p.requireScope(ctx, credentials.ScopeRead)
+	hooksWrite := p.requireScope(ctx, credentials.ScopeWrite)
+	r.GET("/api/v1/webhooks", hooksRead, p.WebhookListHandler(ctx))
+	r.POST("/api/v1/webhooks", hooksWrite, p.WebhookRegisterHandler(ctx))
+	r.DELETE("/api/v1/webhooks/:id", hooksWrite, p.WebhookDeleteHandler(ctx))
+	r.GET("/api/v1/webhookFailures", hooksRead, p.WebhookFailuresHandler(ctx))
 
 	r.GET("/api/v1/tokenDistributionInfo", p.TokenDistributionInfo(ctx))
 	r.GET("/api/v1/kycStatus", p.KYCStatus(ctx))
@@ -69,10 +100,13 @@ func (p *PublicServer) RouteAPI(ctx APIContext) {
 	r.GET("/api/v1/session", p.SessionHandler(ctx))
 	r.GET("/api/v1/version", p.VersionHandler(ctx))
 	r.GET("/api/v1/stats", p.StatsHandler(ctx))
+	r.GET("/metrics", p.MetricsHandler(ctx))
+	r.GET("/healthz", p.HealthzHandler(ctx))
+	r.GET("/readyz", p.ReadyzHandler(ctx))
 	r.GET("/api/v1/logs", p.LogListHandler(ctx))
 	r.GET("/api/v1/log/:year/:month/:day", p.LogGetHandler(ctx))
 
-	r.GET("/index/*prefix", p.IndexHandler(ctx))
+	r.GET("/index/*prefix", read, p.IndexHandler(ctx))
 	r.StaticFS("/assets", assetFS())
 
 	p.mux = r
@@ -147,6 +181,8 @@ type Stats struct {
 	RepoStats      *fs.RepoStats      `json:"repo_stats,omitempty"`
 	BitswapStats   *fs.BitswapStats   `json:"bitswap_stats,omitempty"`
 	BadgerStats    *rs.BadgerStats    `json:"badger_stats,omitempty"`
+	PendingFetches int                `json:"pending_fetches"`
+	AnnounceStats  *rs.AnnounceStats  `json:"announce_stats,omitempty"`
 }
 
 // StatsHandler endpoint returning JSON with all collects stats
@@ -157,6 +193,8 @@ func (p *PublicServer) StatsHandler(ctx APIContext) gin.HandlerFunc {
 			BandwidthStats: ctx.FileStore().BandwidthStats(),
 			RepoStats:      ctx.FileStore().RepoStats(),
 			BadgerStats:    ctx.RecordStore().BadgerStats(),
+			PendingFetches: ctx.RecordStore().PendingFetches(),
+			AnnounceStats:  ctx.RecordStore().AnnounceStats(),
 		}
 		if useBitswap := c.Query("bitswap"); useBitswap == "1" || useBitswap == "true" {
 			stats.BitswapStats = ctx.FileStore().BitswapStats()
@@ -185,7 +223,10 @@ func (p *PublicServer) ContentHandler(ctx APIContext) gin.HandlerFunc {
 		r, err := ctx.RecordStore().ReadRecord(ctx, c.Param("path"), rs.ReadOptions{
 			Version: c.Query("ver"),
 		})
-		if err == rs.ErrRecordNotFound {
+		if r != nil && !allowPath(c, objectPath(r)) {
+			// the version may belong to a record at another path
+			return
+		} else if err == rs.ErrRecordNotFound {
 			if r != nil {
 				if meta := r.Object.Meta(); meta != nil {
 					serveMeta(c, meta)
@@ -210,7 +251,9 @@ func (p *PublicServer) MetaHandler(ctx APIContext) gin.HandlerFunc {
 			Version:   c.Query("ver"),
 			NoContent: true,
 		})
-		if err == rs.ErrRecordNotFound {
+		if r != nil && !allowPath(c, objectPath(r)) {
+			return
+		} else if err == rs.ErrRecordNotFound {
 			if r != nil {
 				c.JSON(200, r.Object.Meta())
 				return
@@ -240,24 +283,46 @@ func (p *PublicServer) PutHandler(ctx APIContext) gin.HandlerFunc {
 		if len(path) == 0 || path == "/" || len(filepath.Base(path)) == 0 {
 			c.AbortWithStatus(400)
 			return
+		} else if !allowPath(c, path) {
+			return
+		}
+		expiresAt, err := expiresAtHeader(c)
+		if err != nil {
+			c.String(400, "error: %v", err)
+			return
+		}
+		ifVersion := ifMatchVersion(c)
+		var r *rs.Record
+		if len(ifVersion) == 0 {
+			r, err = ctx.RecordStore().CreateRecord(ctx, path, c.Request.Body, rs.CreateOptions{
+				Size:      size,
+				UserMeta:  []byte(userMeta),
+				ExpiresAt: expiresAt,
+			})
+		} else {
+			// a version precondition implies that the record exists
+			err = rs.ErrRecordExists
 		}
-		r, err := ctx.RecordStore().CreateRecord(ctx, path, c.Request.Body, rs.CreateOptions{
-			Size:     size,
-			UserMeta: []byte(userMeta),
-		})
 		if err == rs.ErrRecordExists {
 			log.Debugln("record exists, updating:", path)
 			r, err = ctx.RecordStore().UpdateRecord(ctx, path, c.Request.Body, rs.UpdateOptions{
-				Size:     size,
-				UserMeta: []byte(userMeta),
+				Size:      size,
+				UserMeta:  []byte(userMeta),
+				IfVersion: ifVersion,
+				ExpiresAt: expiresAt,
 			})
 		} else if err == nil {
 			log.Debugln("record not exists, created:", path, r.Id())
 		}
-		if err != nil {
+		if err == rs.ErrVersionConflict {
+			c.String(409, "error: %v", err)
+			return
+		} else if err == rs.ErrRecordNotFound {
+			c.String(404, "error: %v", err)
+			return
+		} else if err != nil {
 			log.WithFields(log.Fields{
 				"path": path,
-				"id":   r.Id(),
 			}).Errorf("error: %v", err)
 			c.String(500, "error: %v", err)
 			return
@@ -269,8 +334,28 @@ func (p *PublicServer) PutHandler(ctx APIContext) gin.HandlerFunc {
 // DeleteHandler endpoint to delete record from the store
 func (p *PublicServer) DeleteHandler(ctx APIContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		r, err := ctx.RecordStore().DeleteRecord(ctx, c.Param("id"))
-		if err == rs.ErrRecordNotFound {
+		if requestCredential(c) != nil {
+			// deleted records are read along with ErrRecordNotFound, so their path is checked as well
+			r, err := ctx.RecordStore().ReadRecord(ctx, c.Param("id"), rs.ReadOptions{
+				NoContent: true,
+			})
+			if r == nil && (err == nil || err == rs.ErrRecordNotFound) {
+				c.Status(404)
+				return
+			} else if r == nil {
+				c.String(403, "error: unable to check the record path: %v", err)
+				return
+			} else if !allowPath(c, objectPath(r)) {
+				return
+			}
+		}
+		r, err := ctx.RecordStore().DeleteRecord(ctx, c.Param("id"), rs.DeleteOptions{
+			IfVersion: ifMatchVersion(c),
+		})
+		if err == rs.ErrVersionConflict {
+			c.String(409, "error: %v", err)
+			return
+		} else if err == rs.ErrRecordNotFound {
 			if r != nil {
 				if meta := r.Object.Meta(); meta != nil {
 					serveMeta(c, meta)
@@ -291,6 +376,180 @@ func (p *PublicServer) DeleteHandler(ctx APIContext) gin.HandlerFunc {
 	}
 }
 
+// RestoreHandler endpoint to restore record to a previous version, specified in ver query param
+func (p *PublicServer) RestoreHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version := c.Query("ver")
+		if len(version) == 0 {
+			c.String(400, "error: version must be specified")
+			return
+		}
+		path := c.Param("path")
+		if !allowPath(c, path) {
+			return
+		}
+		r, err := ctx.RecordStore().RestoreRecord(ctx, path, version)
+		if err == rs.ErrRecordNotFound || err == rs.ErrVersionNotFound {
+			c.String(404, "error: %v", err)
+			return
+		} else if err != nil {
+			log.WithFields(log.Fields{
+				"path":    path,
+				"version": version,
+			}).Errorf("error: %v", err)
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.JSON(200, r.Object.Meta())
+	}
+}
+
+// BatchRequest contains operations to be applied atomically
+type BatchRequest struct {
+	Ops []BatchRequestOp `json:"ops"`
+}
+
+// BatchRequestOp is a single operation of the batch, body is base64-encoded in JSON
+type BatchRequestOp struct {
+	Path      string          `json:"path"`
+	Body      []byte          `json:"body"`
+	UserMeta  json.RawMessage `json:"userMeta,omitempty"`
+	Delete    bool            `json:"delete,omitempty"`
+	IfVersion string          `json:"ifVersion,omitempty"`
+	ExpiresAt time.Time       `json:"expiresAt,omitempty"`
+}
+
+// BatchHandler endpoint to apply multiple record changes atomically
+func (p *PublicServer) BatchHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BatchRequest
+		if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+			c.String(400, "error: failed to decode batch: %v", err)
+			return
+		}
+		ops := make([]rs.BatchOp, 0, len(req.Ops))
+		for _, op := range req.Ops {
+			path := op.Path
+			if len(path) == 0 || path == "/" || len(filepath.Base(path)) == 0 {
+				c.String(400, "error: invalid path: %s", path)
+				return
+			} else if !allowPath(c, path) {
+				return
+			} else if op.Delete && !allowScope(c, credentials.ScopeDelete) {
+				return
+			}
+			if len(op.UserMeta) > 0 && !json.Valid(op.UserMeta) {
+				c.String(400, "error: user meta json is not valid: %s", op.UserMeta)
+				return
+			}
+			var expiresAt int64
+			if !op.ExpiresAt.IsZero() {
+				if op.ExpiresAt.Before(time.Now()) {
+					c.String(400, "error: expiry time is in the past: %s", path)
+					return
+				}
+				expiresAt = op.ExpiresAt.UnixNano()
+			}
+			ops = append(ops, rs.BatchOp{
+				Path:      path,
+				Body:      ioutil.NopCloser(bytes.NewReader(op.Body)),
+				Size:      int64(len(op.Body)),
+				UserMeta:  []byte(op.UserMeta),
+				Delete:    op.Delete,
+				IfVersion: op.IfVersion,
+				ExpiresAt: expiresAt,
+			})
+		}
+		records, err := ctx.RecordStore().BatchApply(ctx, ops)
+		if err == rs.ErrEmptyBatch || err == rs.ErrBatchDuplicatePath {
+			c.String(400, "error: %v", err)
+			return
+		} else if err == rs.ErrVersionConflict {
+			c.String(409, "error: %v", err)
+			return
+		} else if err == rs.ErrRecordNotFound {
+			c.String(404, "error: %v", err)
+			return
+		} else if err != nil {
+			log.Errorf("failed to apply batch: %v", err)
+			c.String(500, "error: %v", err)
+			return
+		}
+		metas := make([]*proto.ObjectMeta, 0, len(records))
+		for _, r := range records {
+			metas = append(metas, r.Object.Meta())
+		}
+		c.JSON(200, metas)
+	}
+}
+
+// ConflictsHandler endpoint listing records whose history has diverged, with the losing branches
+func (p *PublicServer) ConflictsHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		conflicts, err := ctx.RecordStore().Conflicts(ctx)
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		if cred := requestCredential(c); cred != nil {
+			allowed := conflicts[:0]
+			for _, conflict := range conflicts {
+				if cred.AllowsPath(conflict.Path) {
+					allowed = append(allowed, conflict)
+				}
+			}
+			conflicts = allowed
+		}
+		c.JSON(200, conflicts)
+	}
+}
+
+// WatchHandler streams record changes under the prefix as Server-Sent Events. A client may resume
+// after disconnect by passing the last received event ID in Last-Event-ID header or cursor query param.
+func (p *PublicServer) WatchHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allowPath(c, c.Param("prefix")) {
+			return
+		}
+		cursor := c.Request.Header.Get("Last-Event-ID")
+		if len(cursor) == 0 {
+			cursor = c.Query("cursor")
+		}
+		watchCtx, cancelFn := context.WithCancel(c.Request.Context())
+		defer cancelFn()
+		changes, err := ctx.RecordStore().WatchRecords(watchCtx, c.Param("prefix"), cursor)
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Status(200)
+		c.Writer.Flush()
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-watchCtx.Done():
+				return false
+			case <-keepAlive.C:
+				_, err := io.WriteString(w, ": ping\n\n")
+				return err == nil
+			case change, ok := <-changes:
+				if !ok {
+					return false
+				}
+				c.Render(-1, sse.Event{
+					Id:    change.ID,
+					Event: string(change.Type),
+					Data:  change,
+				})
+				return true
+			}
+		})
+	}
+}
+
 // LogListHandler endpoint to return list of available logs
 func (p *PublicServer) LogListHandler(ctx APIContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -444,6 +703,28 @@ func (p *PublicServer) PropertyTokenBalance(ctx APIContext) gin.HandlerFunc {
 	}
 }
 
+// ifMatchVersion returns the expected record version from If-Match header, if any.
+func ifMatchVersion(c *gin.Context) string {
+	v := strings.TrimSpace(c.Request.Header.Get("If-Match"))
+	v = strings.TrimPrefix(v, "W/")
+	return strings.Trim(v, `"`)
+}
+
+// expiresAtHeader parses X-Meta-ExpiresAt header as RFC 3339 time, returns zero if not set
+func expiresAtHeader(c *gin.Context) (int64, error) {
+	v := strings.TrimSpace(c.Request.Header.Get("X-Meta-ExpiresAt"))
+	if len(v) == 0 {
+		return 0, nil
+	}
+	ts, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return 0, fmt.Errorf("expiry time is not valid RFC 3339: %s", v)
+	} else if ts.Before(time.Now()) {
+		return 0, fmt.Errorf("expiry time is in the past: %s", v)
+	}
+	return ts.UnixNano(), nil
+}
+
 func numeric(str string) string {
 	var safe []rune
 	for _, v := range str {
@@ -469,6 +750,9 @@ func serveMeta(c *gin.Context, meta *proto.ObjectMeta) {
 	if meta.IsDeleted() {
 		c.Header("X-Meta-Deleted", "true")
 	}
+	if ts := meta.ExpiresAt(); ts > 0 {
+		c.Header("X-Meta-ExpiresAt", time.Unix(0, ts).UTC().Format(time.RFC3339))
+	}
 }
 
 func serveObject(c *gin.Context, r io.ReadCloser, meta *proto.ObjectMeta) {
@@ -574,7 +858,9 @@ func (p *PublicServer) ListVersionsHandler(ctx APIContext) gin.HandlerFunc {
 		r, err := ctx.RecordStore().ReadRecord(ctx, c.Param("path"), rs.ReadOptions{
 			NoContent: true,
 		})
-		if err == rs.ErrRecordNotFound {
+		if r != nil && !allowPath(c, objectPath(r)) {
+			return
+		} else if err == rs.ErrRecordNotFound {
 			if r == nil {
 				c.AbortWithStatus(404)
 				return
@@ -630,6 +916,9 @@ func (p *PublicServer) ListAllHandler(ctx APIContext) gin.HandlerFunc {
 		if !strings.HasSuffix(prefix, "/") {
 			prefix = prefix + "/"
 		}
+		if !allowPath(c, prefix) {
+			return
+		}
 		resp := &ListResponse{}
 		seenDirs := make(map[string]struct{})
 		err := ctx.RecordStore().WalkRecords(ctx, "", func(path string, r *rs.Record) error {
@@ -689,6 +978,9 @@ func (p *PublicServer) IndexHandler(ctx APIContext) gin.HandlerFunc {
 		if !strings.HasSuffix(prefix, "/") {
 			prefix = prefix + "/"
 		}
+		if !allowPath(c, prefix) {
+			return
+		}
 		index := Index{
 			Prefix: prefix,
 		}
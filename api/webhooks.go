@@ -0,0 +1,127 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/AtlantPlatform/atlant-go/webhooks"
+)
+
+// WebhookRequest describes a webhook to register
+type WebhookRequest struct {
+	Prefix string `json:"prefix"`
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// WebhookListHandler endpoint to list registered webhooks
+func (p *PublicServer) WebhookListHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hooks := ctx.Webhooks()
+		if hooks == nil {
+			c.String(503, "error: webhooks are not enabled")
+			return
+		}
+		list := hooks.List()
+		if cred := requestCredential(c); cred != nil {
+			allowed := list[:0]
+			for _, hook := range list {
+				if cred.AllowsPath(hook.Prefix) {
+					allowed = append(allowed, hook)
+				}
+			}
+			list = allowed
+		}
+		c.JSON(200, list)
+	}
+}
+
+// WebhookRegisterHandler endpoint to register a webhook for changes of records under prefix
+func (p *PublicServer) WebhookRegisterHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hooks := ctx.Webhooks()
+		if hooks == nil {
+			c.String(503, "error: webhooks are not enabled")
+			return
+		}
+		var req WebhookRequest
+		if err := c.BindJSON(&req); err != nil {
+			return
+		} else if !allowPath(c, req.Prefix) {
+			return
+		}
+		hook, err := hooks.Register(req.Prefix, req.URL, req.Secret)
+		if err == webhooks.ErrInvalidWebhook || err == webhooks.ErrPrivateDestination {
+			c.String(400, "error: %v", err)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		hook.Secret = ""
+		c.JSON(200, hook)
+	}
+}
+
+// WebhookDeleteHandler endpoint to remove a webhook
+func (p *PublicServer) WebhookDeleteHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hooks := ctx.Webhooks()
+		if hooks == nil {
+			c.String(503, "error: webhooks are not enabled")
+			return
+		}
+		if cred := requestCredential(c); cred != nil {
+			var found bool
+			for _, hook := range hooks.List() {
+				if hook.ID == c.Param("id") {
+					found = true
+					if !allowPath(c, hook.Prefix) {
+						return
+					}
+				}
+			}
+			if !found {
+				c.AbortWithStatus(404)
+				return
+			}
+		}
+		if err := hooks.Unregister(c.Param("id")); err == webhooks.ErrNotFound {
+			c.AbortWithStatus(404)
+			return
+		} else if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		c.Status(200)
+	}
+}
+
+// WebhookFailuresHandler endpoint to list failed webhook deliveries, optionally filtered by webhook ID
+func (p *PublicServer) WebhookFailuresHandler(ctx APIContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hooks := ctx.Webhooks()
+		if hooks == nil {
+			c.String(503, "error: webhooks are not enabled")
+			return
+		}
+		failures, err := hooks.Failures(c.Query("webhook"))
+		if err != nil {
+			c.String(500, "error: %v", err)
+			return
+		}
+		if cred := requestCredential(c); cred != nil {
+			allowed := failures[:0]
+			for _, f := range failures {
+				if f.Change != nil && cred.AllowsPath(f.Change.Path) {
+					allowed = append(allowed, f)
+				}
+			}
+			failures = allowed
+		}
+		c.JSON(200, failures)
+	}
+}
@@ -43,6 +43,9 @@ type Auth interface {
 	Entries() map[string]Entry
 	HasPermissions(key string, perms ...Permission) bool
 	AllPermissions(key string) []Permission
+	// LastRefresh returns the time entries have been fetched from any of the sources,
+	// zero if none has responded yet.
+	LastRefresh() time.Time
 	StopUpdates()
 }
 
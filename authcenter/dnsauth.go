@@ -45,6 +45,8 @@ type dnsAuth struct {
 	dur     time.Duration
 	domains []string
 	entries map[string][]Entry
+	// lastRefresh is the time any of the sources has responded
+	lastRefresh time.Time
 
 	stopC chan struct{}
 }
@@ -124,6 +126,9 @@ func (d *dnsAuth) refresh() {
 			d.domains = append(d.domains, domain)
 			checkDomain(domain)
 		}
+		if len(seen) > 0 {
+			d.lastRefresh = time.Now()
+		}
 		return nil
 	}
 	t := time.NewTimer(time.Millisecond)
@@ -167,6 +172,12 @@ func parseLabel(label string) (key string, tags []string, ok bool) {
 	return key, tags, true
 }
 
+func (d *dnsAuth) LastRefresh() time.Time {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.lastRefresh
+}
+
 func (d *dnsAuth) StopUpdates() {
 	close(d.stopC)
 }
@@ -30,6 +30,8 @@ type urlAuth struct {
 	dur     time.Duration
 	urls    []string
 	entries map[string][]Entry
+	// lastRefresh is the time any of the sources has responded
+	lastRefresh time.Time
 
 	stopC chan struct{}
 }
@@ -112,6 +114,9 @@ func (d *urlAuth) refresh() {
 			d.urls = append(d.urls, url)
 			checkURL(url)
 		}
+		if len(seen) > 0 {
+			d.lastRefresh = time.Now()
+		}
 		return nil
 	}
 	t := time.NewTimer(time.Millisecond)
@@ -129,6 +134,13 @@ func (d *urlAuth) refresh() {
 		}
 	}
 }
+
+func (d *urlAuth) LastRefresh() time.Time {
+	d.mux.RLock()
+	defer d.mux.RUnlock()
+	return d.lastRefresh
+}
+
 func (d *urlAuth) StopUpdates() {
 	close(d.stopC)
 }
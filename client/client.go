@@ -31,8 +31,10 @@ type Client interface {
 	GetContents(ctx context.Context, path, version string) ([]byte, error)
 	GetMeta(ctx context.Context, path, version string) (*ObjectMeta, error)
 	DeleteObject(ctx context.Context, id string) error
+	RestoreObject(ctx context.Context, path, version string) (*ObjectMeta, error)
 	ListVersions(ctx context.Context, path string) (id string, versions []*ObjectMeta, err error)
 	ListObjects(ctx context.Context, prefix string) (dirs []string, files []*ObjectMeta, err error)
+	Watch(ctx context.Context, prefix, cursor string) (<-chan *ObjectChange, error)
 }
 
 // NewID returns ID for the protocol
@@ -50,16 +52,35 @@ type ObjectMeta struct {
 	IsDeleted       bool   `json:"isDeleted,omitempty"`
 	Size            int64  `json:"size,omitempty"`
 	UserMeta        string `json:"userMeta,omitempty"`
+	ExpiresAt       int64  `json:"expiresAt,omitempty"`
 }
 
 type rpcClient struct {
 	apiURL string
+	token  string
 	cli    *http.Client
 }
 
+// Option configures the RPC client
+type Option func(client *rpcClient)
+
+// WithToken sets the API token sent as "Authorization: Bearer <token>" with every request.
+func WithToken(token string) Option {
+	return func(client *rpcClient) {
+		client.token = token
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to make requests.
+func WithHTTPClient(cli *http.Client) Option {
+	return func(client *rpcClient) {
+		client.cli = cli
+	}
+}
+
 // New should return RPC client
-func New(apiURL string) Client {
-	return &rpcClient{
+func New(apiURL string, opts ...Option) Client {
+	client := &rpcClient{
 		apiURL: apiURL,
 		cli: &http.Client{
 			Transport: &http.Transport{
@@ -67,6 +88,10 @@ func New(apiURL string) Client {
 			},
 		},
 	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
 }
 
 func (client *rpcClient) Ping(ctx context.Context) (id string, err error) {
@@ -90,8 +115,22 @@ type PutObjectInput struct {
 	Body     io.ReadCloser
 	Size     int64
 	UserMeta string
+	// IfVersion makes the put conditional, it succeeds only if the current
+	// version of the object equals to this one, otherwise ErrVersionConflict is returned.
+	IfVersion string
+	// ExpiresAt is the time after which the object gets deleted, zero means never.
+	ExpiresAt time.Time
 }
 
+var (
+	// ErrVersionConflict is returned when the object version precondition fails
+	ErrVersionConflict = errors.New("object version conflict")
+	// ErrUnauthorized is returned when the node requires an API token and it's missing or invalid
+	ErrUnauthorized = errors.New("API token is missing or invalid")
+	// ErrForbidden is returned when the API token has no scope for the request or the path is outside of its prefix
+	ErrForbidden = errors.New("API token doesn't allow the request")
+)
+
 func (client *rpcClient) PutObject(ctx context.Context, path string, obj *PutObjectInput) (*ObjectMeta, error) {
 	contentType := mime.TypeByExtension(filepath.Base(path))
 	if len(contentType) == 0 {
@@ -99,6 +138,10 @@ func (client *rpcClient) PutObject(ctx context.Context, path string, obj *PutObj
 	}
 	headers := map[string]string{
 		"X-Meta-UserMeta": obj.UserMeta,
+		"If-Match":        obj.IfVersion,
+	}
+	if !obj.ExpiresAt.IsZero() {
+		headers["X-Meta-ExpiresAt"] = obj.ExpiresAt.UTC().Format(time.RFC3339)
 	}
 	respData, err := client.post(ctx, filepath.Join("/api/v1/put", path), contentType, obj.Body, obj.Size, headers)
 	if err != nil {
@@ -137,6 +180,20 @@ func (client *rpcClient) DeleteObject(ctx context.Context, id string) error {
 	return nil
 }
 
+func (client *rpcClient) RestoreObject(ctx context.Context, path, version string) (*ObjectMeta, error) {
+	endpoint := filepath.Join("/api/v1/restore", path) + "?ver=" + url.QueryEscape(version)
+	respData, err := client.post(ctx, endpoint, "", nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta *ObjectMeta
+	if err := json.Unmarshal(respData, &meta); err != nil {
+		err = fmt.Errorf("response unmarshal failed: %v", err)
+		return nil, err
+	}
+	return meta, nil
+}
+
 type listVersionsResponse struct {
 	ID       string        `json:"id"`
 	Versions []*ObjectMeta `json:"versions"`
@@ -185,6 +242,7 @@ func (client *rpcClient) post(ctx context.Context,
 	req := &http.Request{
 		Method:        "POST",
 		URL:           u,
+		Header:        make(http.Header),
 		Body:          r,
 		ContentLength: length,
 	}
@@ -194,6 +252,7 @@ func (client *rpcClient) post(ctx context.Context,
 			req.Header.Add(k, v)
 		}
 	}
+	client.authorize(req)
 	req = req.WithContext(ctx)
 	log.Debug("[client] Doing request")
 	resp, err := client.cli.Do(req)
@@ -204,7 +263,11 @@ func (client *rpcClient) post(ctx context.Context,
 	resp.Body.Close()
 	log.WithField("status", resp.Status).Debug("[client] resp.Status")
 	log.WithField("body", string(respBody)).Debug("[client] resp.Body")
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode == http.StatusConflict {
+		return nil, ErrVersionConflict
+	} else if err := authError(resp.StatusCode, respBody); err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
 		if len(respBody) > 0 {
 			err := fmt.Errorf("error %d: %s", resp.StatusCode, respBody)
 			return nil, err
@@ -224,10 +287,12 @@ func (client *rpcClient) get(ctx context.Context, endpoint string,
 	req := &http.Request{
 		Method: "GET",
 		URL:    u,
+		Header: make(http.Header),
 	}
 	for k, v := range headers {
 		req.Header.Add(k, v)
 	}
+	client.authorize(req)
 	req = req.WithContext(ctx)
 	resp, err := client.cli.Do(req)
 	if err != nil {
@@ -235,7 +300,9 @@ func (client *rpcClient) get(ctx context.Context, endpoint string,
 	}
 	respBody, _ := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+	if err := authError(resp.StatusCode, respBody); err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
 		if len(respBody) > 0 {
 			err := fmt.Errorf("error %d: %s", resp.StatusCode, respBody)
 			return nil, err
@@ -245,3 +312,23 @@ func (client *rpcClient) get(ctx context.Context, endpoint string,
 	}
 	return respBody, nil
 }
+
+func (client *rpcClient) authorize(req *http.Request) {
+	if len(client.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+client.token)
+	}
+}
+
+// authError maps authentication failures to ErrUnauthorized and ErrForbidden
+func authError(statusCode int, respBody []byte) error {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		log.WithField("body", string(respBody)).Debug("[client] unauthorized")
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		log.WithField("body", string(respBody)).Debug("[client] forbidden")
+		return ErrForbidden
+	default:
+		return nil
+	}
+}
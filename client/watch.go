@@ -0,0 +1,147 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ObjectChange describes a change of object, see Watch.
+type ObjectChange struct {
+	// ID is a cursor that can be used to resume watching.
+	ID              string `json:"id"`
+	Type            string `json:"type"`
+	ObjectID        string `json:"recordId"`
+	Path            string `json:"path"`
+	Version         string `json:"version"`
+	VersionPrevious string `json:"versionPrevious,omitempty"`
+	Timestamp       int64  `json:"timestamp"`
+}
+
+// watchRetryDelay is the delay before reconnecting the change feed.
+var watchRetryDelay = 5 * time.Second
+
+// Watch streams changes of objects under the prefix. If cursor is set, changes after that cursor
+// are received first. The stream reconnects automatically, resuming from the last received change,
+// the channel is closed when ctx is done.
+func (client *rpcClient) Watch(ctx context.Context, prefix, cursor string) (<-chan *ObjectChange, error) {
+	resp, err := client.watch(ctx, prefix, cursor)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan *ObjectChange, 100)
+	go func() {
+		defer close(out)
+		for {
+			last, err := readChanges(ctx, resp, out)
+			if len(last) > 0 {
+				cursor = last
+			}
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			log.WithField("cursor", cursor).Debugf("[client] watch disconnected: %v", err)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(watchRetryDelay):
+				}
+				if resp, err = client.watch(ctx, prefix, cursor); err == nil {
+					break
+				}
+				log.Debugf("[client] watch reconnect failed: %v", err)
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (client *rpcClient) watch(ctx context.Context, prefix, cursor string) (*http.Response, error) {
+	u, err := url.Parse(client.apiURL + filepath.Join("/api/v1/watch", prefix))
+	if err != nil {
+		return nil, err
+	}
+	req := &http.Request{
+		Method: "GET",
+		URL:    u,
+		Header: make(http.Header),
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if len(cursor) > 0 {
+		req.Header.Set("Last-Event-ID", cursor)
+	}
+	client.authorize(req)
+	req = req.WithContext(ctx)
+	resp, err := client.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err := authError(resp.StatusCode, respBody); err != nil {
+			return nil, err
+		} else if len(respBody) > 0 {
+			err := fmt.Errorf("error %d: %s", resp.StatusCode, respBody)
+			return nil, err
+		}
+		err := errors.New(resp.Status)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// readChanges decodes the event stream until it ends, returns ID of the last received change.
+func readChanges(ctx context.Context, resp *http.Response, out chan<- *ObjectChange) (string, error) {
+	defer resp.Body.Close()
+	var last string
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case len(line) == 0:
+			// end of event
+			if len(data) == 0 {
+				continue
+			}
+			var change *ObjectChange
+			err := json.Unmarshal([]byte(strings.Join(data, "\n")), &change)
+			data = data[:0]
+			if err != nil {
+				log.Debugf("[client] failed to decode change: %v", err)
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return last, ctx.Err()
+			case out <- change:
+				last = change.ID
+			}
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return last, err
+	}
+	return last, errors.New("stream closed")
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -24,6 +25,13 @@ var app = cli.App("atlant-lite", getBanner()+"\nA lightweight ATLANT node client
 
 var nodeAddr = app.StringOpt("A addr", "testnet", "Full node address (ex. localhost:33780)")
 
+var apiToken = app.String(cli.StringOpt{
+	Name:      "t token",
+	Desc:      "API token of the node, required to write records unless the node runs with --api-auth off.",
+	EnvVar:    "ANC_TOKEN",
+	HideValue: true,
+})
+
 func init() {
 	// log.SetFlags(log.Lshortfile | log.LstdFlags)
 }
@@ -61,6 +69,7 @@ func main() {
 	app.Command("get", "Get object contents from the store", cmdGetContents)
 	app.Command("meta", "Get object meta data from the store", cmdGetMeta)
 	app.Command("delete", "Delete object from a store by its ID", cmdDeleteObject)
+	app.Command("restore", "Restore object to one of its previous versions", cmdRestoreObject)
 	app.Command("versions", "List all object versions", cmdListVersions)
 	app.Command("ls", "List all objects and sub-directories in a prefix", cmdListObjects)
 	if err := app.Run(os.Args); err != nil {
@@ -96,8 +105,18 @@ func cmdPutObject(c *cli.Cmd) {
 	src := c.StringArg("SRC", "", "Source file path on the disk")
 	dst := c.StringArg("DST", "", "Destination object path in the store")
 	meta := c.StringOpt("M meta", "", "User meta to keep with object")
-	c.Spec = "[-M] SRC DST"
+	ifVersion := c.StringOpt("if-version", "", "Put only if the current object version matches")
+	expiresIn := c.StringOpt("expires-in", "", "Delete the object after the specified duration (ex. 24h)")
+	c.Spec = "[-M] [--if-version] [--expires-in] SRC DST"
 	c.Action = func() {
+		var expiresAt time.Time
+		if len(*expiresIn) > 0 {
+			dur, err := time.ParseDuration(*expiresIn)
+			if err != nil {
+				log.Fatalln("[ERR]", err)
+			}
+			expiresAt = time.Now().Add(dur)
+		}
 		f, err := os.Open(*src)
 		if err != nil {
 			log.Fatalln("[ERR]", err)
@@ -111,9 +130,11 @@ func cmdPutObject(c *cli.Cmd) {
 		cli := getClient()
 		ctx := context.Background()
 		meta, err := cli.PutObject(ctx, *dst, &client.PutObjectInput{
-			Body:     f,
-			Size:     fileInfo.Size(),
-			UserMeta: *meta,
+			Body:      f,
+			Size:      fileInfo.Size(),
+			UserMeta:  *meta,
+			IfVersion: *ifVersion,
+			ExpiresAt: expiresAt,
 		})
 		if err != nil {
 			log.Fatalln("[ERR]", err)
@@ -169,6 +190,21 @@ func cmdDeleteObject(c *cli.Cmd) {
 	}
 }
 
+func cmdRestoreObject(c *cli.Cmd) {
+	path := c.StringArg("PATH", "", "Object path in the store")
+	version := c.StringArg("VERSION", "", "Object version to restore")
+	c.Spec = "PATH VERSION"
+	c.Action = func() {
+		cli := getClient()
+		ctx := context.Background()
+		meta, err := cli.RestoreObject(ctx, *path, *version)
+		if err != nil {
+			log.Fatalln("[ERR]", err)
+		}
+		fmt.Println(jsonPrint(meta))
+	}
+}
+
 func cmdListVersions(c *cli.Cmd) {
 	path := c.StringArg("PATH", "", "Object path in the store")
 	c.Spec = "PATH"
@@ -213,7 +249,7 @@ func getClient() client.Client {
 	default:
 		urlPrefix = "http://" + *nodeAddr
 	}
-	return client.New(urlPrefix)
+	return client.New(urlPrefix, client.WithToken(*apiToken))
 }
 
 func getBanner() string {
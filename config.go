@@ -33,6 +33,12 @@ var (
 		EnvVar: "AN_STATE_DIR",
 		Value:  "var/state",
 	})
+	stateEngine = app.String(cli.StringOpt{
+		Name:   "state-engine",
+		Desc:   "Storage engine of the state DB: badger, leveldb (kept in the leveldb subdirectory of the state dir) or memory (nothing is persisted).",
+		EnvVar: "AN_STATE_ENGINE",
+		Value:  "badger",
+	})
 	stateGcInterval = app.String(cli.StringOpt{
 		Name:   "state-gcinterval",
 		Desc:   "Set a default GC interval for the state DB. Setting it lower will result in increased CPU load.",
@@ -76,6 +82,43 @@ var (
 		EnvVar: "AN_FS_SYNC_TIMEOUT",
 		Value:  "10m",
 	})
+	fsSyncInterval = app.String(cli.StringOpt{
+		Name:   "sync-interval",
+		Desc:   "Sets the interval of background record reconciliation with a random peer.",
+		EnvVar: "AN_FS_SYNC_INTERVAL",
+		Value:  "5m",
+	})
+	fsHeadsInterval = app.String(cli.StringOpt{
+		Name:   "heads-interval",
+		Desc:   "Sets the interval of re-announcing current versions of records written by this node.",
+		EnvVar: "AN_FS_HEADS_INTERVAL",
+		Value:  "1h",
+	})
+	fsClockSkew = app.String(cli.StringOpt{
+		Name:   "clock-skew",
+		Desc:   "Sets the maximum clock difference with peers, announces outside of the window are rejected, record announces are accepted for 24h after signing (0 disables).",
+		EnvVar: "AN_FS_CLOCK_SKEW",
+		Value:  "10m",
+	})
+	fsAnnounceFanout = app.String(cli.StringOpt{
+		Name:   "announce-fanout",
+		Desc:   "Sets the number of alive sync peers record announces are pushed to directly besides pubsub (0 disables).",
+		EnvVar: "AN_FS_ANNOUNCE_FANOUT",
+		Value:  "8",
+	})
+	fsRetention = app.Strings(cli.StringsOpt{
+		Name:      "retention",
+		Desc:      "Version retention rules as prefix:versions[:maxage], versions can be all (e.g. /beat_reports/:0,/legal/:all). Other records keep 3 versions.",
+		EnvVar:    "AN_FS_RETENTION",
+		Value:     nil,
+		HideValue: true,
+	})
+	fsGCInterval = app.String(cli.StringOpt{
+		Name:   "gc-interval",
+		Desc:   "Sets the interval of record GC that removes versions according to the retention rules.",
+		EnvVar: "AN_FS_GC_INTERVAL",
+		Value:  "1h",
+	})
 	fsListenAddr = app.String(cli.StringOpt{
 		Name:   "L fs-listen-addr",
 		Desc:   "Sets IPFS listen address to communicate with peers.",
@@ -88,6 +131,49 @@ var (
 		EnvVar: "AN_WEB_LISTEN_ADDR",
 		Value:  "0.0.0.0:33780",
 	})
+	adminListenAddr = app.String(cli.StringOpt{
+		Name:   "admin-listen-addr",
+		Desc:   "Sets admin API listen address, use unix:/path/to/socket for a unix socket or an empty value to disable.",
+		EnvVar: "AN_ADMIN_LISTEN_ADDR",
+		Value:  "127.0.0.1:33790",
+	})
+	adminTokenOpt = app.String(cli.StringOpt{
+		Name:      "admin-token",
+		Desc:      "Sets the bearer token of admin API, generated into admin.token in the IPFS storage dir if not set.",
+		EnvVar:    "AN_ADMIN_TOKEN",
+		Value:     "",
+		HideValue: true,
+	})
+	apiAuth = app.String(cli.StringOpt{
+		Name:   "api-auth",
+		Desc:   "Sets which public API requests require an API token: off, write (writes and deletes) or all.",
+		EnvVar: "AN_API_AUTH",
+		Value:  "write",
+	})
+	webhookAllowPrivate = app.Bool(cli.BoolOpt{
+		Name:   "webhook-allow-private",
+		Desc:   "Allows webhooks to deliver to loopback, private and link-local addresses.",
+		EnvVar: "AN_WEBHOOK_ALLOW_PRIVATE",
+		Value:  false,
+	})
+	readyMinPeers = app.String(cli.StringOpt{
+		Name:   "ready-min-peers",
+		Desc:   "Sets the number of connected IPFS peers required for the node to report readiness.",
+		EnvVar: "AN_READY_MIN_PEERS",
+		Value:  "1",
+	})
+	readyAuthAge = app.String(cli.StringOpt{
+		Name:   "ready-auth-age",
+		Desc:   "Sets the maximum age of the last auth center refresh for the node to report readiness (0 disables).",
+		EnvVar: "AN_READY_AUTH_AGE",
+		Value:  "10m",
+	})
+	readyDiskFree = app.String(cli.StringOpt{
+		Name:   "ready-disk-free",
+		Desc:   "Sets the free disk space in MB required for the node to report readiness.",
+		EnvVar: "AN_READY_DISK_FREE",
+		Value:  "1024",
+	})
 	// clusterEnabled = app.String(cli.StringOpt{
 	// 	Name:   "cluster-enabled",
 	// 	Desc:   "Enable cluster discovery (experimental).",
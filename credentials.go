@@ -0,0 +1,121 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/api"
+	"github.com/AtlantPlatform/atlant-go/credentials"
+)
+
+func credentialsCmd(c *cli.Cmd) {
+	c.Command("add", "Create a credential and print its token, the token is shown only once.", func(c *cli.Cmd) {
+		c.Spec = "[--scopes] [--prefix] NAME"
+		name := c.StringArg("NAME", "", "Name of the credential, e.g. the client it is issued to.")
+		scopes := c.StringOpt("scopes", "read,write", "Comma-separated scopes: read, write, delete.")
+		prefix := c.StringOpt("prefix", "", "Restrict the credential to records under the path prefix, e.g. /docs/.")
+		c.Action = func() {
+			parsed, err := credentials.ParseScopes(*scopes)
+			if err != nil {
+				log.Fatalln(err)
+			}
+			body, _ := json.Marshal(&api.CredentialRequest{
+				Name:   *name,
+				Scopes: parsed,
+				Prefix: *prefix,
+			})
+			var cred api.CredentialToken
+			adminRequest("POST", "/admin/v1/credentials", bytes.NewReader(body), &cred)
+			printJSON(&cred)
+		}
+	})
+	c.Command("ls", "List credentials.", func(c *cli.Cmd) {
+		c.Action = func() {
+			var list []*credentials.Credential
+			adminRequest("GET", "/admin/v1/credentials", nil, &list)
+			printJSON(list)
+		}
+	})
+	c.Command("revoke", "Revoke a credential, its token is rejected right away.", func(c *cli.Cmd) {
+		id := c.StringArg("ID", "", "ID of the credential.")
+		c.Action = func() {
+			adminRequest("DELETE", "/admin/v1/credentials/"+*id, nil, nil)
+			log.Infoln("credential revoked:", *id)
+		}
+	})
+}
+
+// adminRequest calls admin API of the running node, the response is decoded into v unless it's nil.
+func adminRequest(method, endpoint string, body io.Reader, v interface{}) {
+	if len(*adminListenAddr) == 0 {
+		log.Fatalln("admin API is disabled, set --admin-listen-addr")
+	}
+	token := *adminTokenOpt
+	if len(token) == 0 {
+		data, err := ioutil.ReadFile(filepath.Join(*fsDir, adminTokenFile))
+		if err != nil {
+			log.Fatalln("failed to read admin token, set --admin-token:", err)
+		}
+		token = string(bytes.TrimSpace(data))
+	}
+	httpClient := &http.Client{
+		Timeout: time.Minute,
+	}
+	baseURL := "http://" + *adminListenAddr
+	if path := strings.TrimPrefix(*adminListenAddr, "unix:"); path != *adminListenAddr {
+		baseURL = "http://unix"
+		httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+	req, err := http.NewRequest(method, baseURL+endpoint, body)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Fatalln("admin API request failed:", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("admin API request failed: %s %s", resp.Status, respBody)
+	}
+	if v != nil {
+		if err := json.Unmarshal(respBody, v); err != nil {
+			log.Fatalln("failed to decode admin API response:", err)
+		}
+	}
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+// Package credentials keeps API credentials, bearer tokens with scopes limited to a path prefix.
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/oklog/ulid"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// Scope is an operation allowed by the credential
+type Scope string
+
+const (
+	// ScopeRead allows to read records and list them
+	ScopeRead Scope = "read"
+	// ScopeWrite allows to create, update and restore records
+	ScopeWrite Scope = "write"
+	// ScopeDelete allows to delete records
+	ScopeDelete Scope = "delete"
+)
+
+// Credential grants the scopes on records whose path starts with the prefix, an empty prefix
+// means any path. Tokens are kept as SHA-256 hashes, the token itself is only returned on creation.
+type Credential struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Scopes     []Scope `json:"scopes"`
+	Prefix     string  `json:"prefix,omitempty"`
+	SecretHash string  `json:"secretHash,omitempty"`
+	CreatedAt  int64   `json:"createdAt"`
+}
+
+// HasScope checks whether the credential allows the operation.
+func (c *Credential) HasScope(scope Scope) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsPath checks whether the path is within the credential prefix.
+func (c *Credential) AllowsPath(path string) bool {
+	return strings.HasPrefix(path, c.Prefix)
+}
+
+var (
+	// ErrNotFound to be thrown when credential doesn't exist
+	ErrNotFound = errors.New("credential not found")
+	// ErrInvalidToken to be thrown when token is malformed or doesn't match any credential
+	ErrInvalidToken = errors.New("invalid API token")
+	// ErrInvalidCredential to be thrown when credential has no scopes, unknown ones or invalid prefix
+	ErrInvalidCredential = errors.New("credential must have read, write or delete scopes and a prefix starting with /")
+)
+
+// Manager keeps the credentials in the state store.
+type Manager struct {
+	ss state.IndexedStore
+}
+
+// NewManager creates a credential manager using the state store.
+func NewManager(ss state.IndexedStore) *Manager {
+	return &Manager{
+		ss: ss,
+	}
+}
+
+// Create stores a new credential and returns it along with the token, that is "<id>.<secret>".
+func (m *Manager) Create(name string, scopes []Scope, prefix string) (*Credential, string, error) {
+	if len(scopes) == 0 || (len(prefix) > 0 && !strings.HasPrefix(prefix, "/")) {
+		return nil, "", ErrInvalidCredential
+	}
+	for _, s := range scopes {
+		switch s {
+		case ScopeRead, ScopeWrite, ScopeDelete:
+		default:
+			return nil, "", ErrInvalidCredential
+		}
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := hex.EncodeToString(buf)
+	cred := &Credential{
+		ID:         proto.NewID(),
+		Name:       name,
+		Scopes:     scopes,
+		Prefix:     prefix,
+		SecretHash: hashSecret(secret),
+		CreatedAt:  time.Now().UnixNano(),
+	}
+	if err := m.ss.Update(state.NewKey(state.BucketCredentials, []byte(cred.ID)),
+		func(k *state.Key, v []byte) ([]byte, error) {
+			return json.Marshal(cred)
+		}); err != nil {
+		return nil, "", err
+	}
+	return withoutSecret(cred), cred.ID + "." + secret, nil
+}
+
+// Authenticate returns the credential of the token.
+func (m *Manager) Authenticate(token string) (*Credential, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidToken
+	} else if _, err := ulid.Parse(parts[0]); err != nil {
+		return nil, ErrInvalidToken
+	}
+	cred, err := m.get(parts[0])
+	if err == ErrNotFound {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(parts[1])), []byte(cred.SecretHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	return withoutSecret(cred), nil
+}
+
+func (m *Manager) get(id string) (*Credential, error) {
+	var cred *Credential
+	if err := m.ss.View(state.NewKey(state.BucketCredentials, []byte(id)), func(k *state.Key, v []byte) error {
+		return json.Unmarshal(v, &cred)
+	}); err == state.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// Revoke removes the credential, its token is rejected right away.
+func (m *Manager) Revoke(id string) error {
+	if _, err := m.get(id); err != nil {
+		return err
+	}
+	return m.ss.Delete(state.NewKey(state.BucketCredentials, []byte(id)))
+}
+
+// List returns all credentials, secret hashes are omitted.
+func (m *Manager) List() ([]*Credential, error) {
+	list := []*Credential{}
+	b := state.NewBucket(state.BucketCredentials)
+	if _, err := m.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+		var cred *Credential
+		if err := json.Unmarshal(v, &cred); err != nil || cred == nil {
+			return nil
+		}
+		list = append(list, withoutSecret(cred))
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func withoutSecret(cred *Credential) *Credential {
+	c := *cred
+	c.SecretHash = ""
+	return &c
+}
+
+// ParseScopes parses a comma-separated list of scopes, e.g. "read,write".
+func ParseScopes(s string) ([]Scope, error) {
+	var scopes []Scope
+	for _, v := range strings.Split(s, ",") {
+		switch scope := Scope(strings.TrimSpace(v)); scope {
+		case ScopeRead, ScopeWrite, ScopeDelete:
+			scopes = append(scopes, scope)
+		case "":
+		default:
+			return nil, ErrInvalidCredential
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, ErrInvalidCredential
+	}
+	return scopes, nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package credentials
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+func TestCredentials(t *testing.T) {
+	require := require.New(t)
+
+	ss := state.NewIndexedStoreMemory()
+	defer ss.Close()
+	m := NewManager(ss)
+
+	_, _, err := m.Create("bad", []Scope{"admin"}, "")
+	require.Equal(ErrInvalidCredential, err)
+	_, _, err = m.Create("bad", []Scope{ScopeRead}, "docs/")
+	require.Equal(ErrInvalidCredential, err)
+
+	cred, token, err := m.Create("docs", []Scope{ScopeRead, ScopeWrite}, "/docs/")
+	require.NoError(err)
+	require.Empty(cred.SecretHash)
+
+	authed, err := m.Authenticate(token)
+	require.NoError(err)
+	require.Equal(cred.ID, authed.ID)
+	require.True(authed.HasScope(ScopeWrite))
+	require.False(authed.HasScope(ScopeDelete))
+	require.True(authed.AllowsPath("/docs/a.pdf"))
+	require.False(authed.AllowsPath("/legal/a.pdf"))
+
+	_, err = m.Authenticate(cred.ID + ".wrong")
+	require.Equal(ErrInvalidToken, err)
+	_, err = m.Authenticate("garbage")
+	require.Equal(ErrInvalidToken, err)
+
+	list, err := m.List()
+	require.NoError(err)
+	require.Len(list, 1)
+	require.Empty(list[0].SecretHash)
+
+	require.NoError(m.Revoke(cred.ID))
+	require.Equal(ErrNotFound, m.Revoke(cred.ID))
+	_, err = m.Authenticate(token)
+	require.Equal(ErrInvalidToken, err)
+
+	scopes, err := ParseScopes("read, delete")
+	require.NoError(err)
+	require.Equal([]Scope{ScopeRead, ScopeDelete}, scopes)
+	_, err = ParseScopes("")
+	require.Equal(ErrInvalidCredential, err)
+}
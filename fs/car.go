@@ -0,0 +1,215 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	log "github.com/sirupsen/logrus"
+)
+
+// carHeader is the header of CAR v1 archive, see https://ipld.io/specs/transport/car/carv1/
+type carHeader struct {
+	Roots   []cid.Cid `refmt:"roots"`
+	Version uint64    `refmt:"version"`
+}
+
+func init() {
+	cbor.RegisterCborType(carHeader{})
+}
+
+// maxCarSection limits the size of a single block within an archive.
+const maxCarSection = 32 << 20
+
+// ErrBlockMismatch is returned when the data of a block in an archive doesn't match its CID.
+var ErrBlockMismatch = errors.New("block data doesn't match its CID")
+
+// ExportBlocks writes all recursively pinned DAGs as a CAR v1 archive, pinned CIDs are the roots.
+func (s *ipfsStore) ExportBlocks(ctx context.Context, w io.Writer) (int, error) {
+	roots := s.node.Pinning.RecursiveKeys()
+	header, err := cbor.DumpObject(&carHeader{
+		Roots:   roots,
+		Version: 1,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode CAR header: %v", err)
+	}
+	bw := bufio.NewWriter(w)
+	if err := writeCarSection(bw, header); err != nil {
+		return 0, err
+	}
+	var count int
+	seen := make(map[string]struct{})
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if _, ok := seen[c.KeyString()]; ok {
+			return nil
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		seen[c.KeyString()] = struct{}{}
+		b, err := s.node.Blockstore.Get(c)
+		if err != nil {
+			return fmt.Errorf("failed to get block %s: %v", c, err)
+		}
+		if err := writeCarSection(bw, c.Bytes(), b.RawData()); err != nil {
+			return err
+		}
+		count++
+		n, err := s.node.DAG.Get(ctx, c)
+		if err != nil {
+			return fmt.Errorf("failed to decode block %s: %v", c, err)
+		}
+		for _, link := range n.Links() {
+			if err := walk(link.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, root := range roots {
+		if err := walk(root); err != nil {
+			return count, err
+		}
+	}
+	return count, bw.Flush()
+}
+
+// ImportBlocks reads a CAR v1 archive into the blockstore, every block is checked against its CID.
+// Only the archive roots listed in versions are pinned, other blocks are left to the GC.
+func (s *ipfsStore) ImportBlocks(ctx context.Context, r io.Reader, versions []string) (int, error) {
+	br := bufio.NewReader(r)
+	data, err := readCarSection(br)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read CAR header: %v", err)
+	}
+	var header carHeader
+	if err := cbor.DecodeInto(data, &header); err != nil {
+		return 0, fmt.Errorf("failed to decode CAR header: %v", err)
+	} else if header.Version != 1 {
+		return 0, fmt.Errorf("unsupported CAR version: %d", header.Version)
+	}
+	var count int
+	for {
+		data, err := readCarSection(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return count, err
+		}
+		b, err := parseCarBlock(data)
+		if err != nil {
+			return count, err
+		}
+		if err := s.node.Blockstore.Put(b); err != nil {
+			return count, err
+		}
+		count++
+	}
+	allowed := make(map[string]struct{}, len(versions))
+	for _, v := range versions {
+		allowed[v] = struct{}{}
+	}
+	for _, root := range header.Roots {
+		if _, ok := allowed[root.String()]; !ok {
+			log.Debugf("skipping CAR root %s not referenced by imported records", root)
+			continue
+		}
+		n, err := s.node.DAG.Get(ctx, root)
+		if err != nil {
+			return count, fmt.Errorf("failed to get root %s: %v", root, err)
+		}
+		if err := s.node.Pinning.Pin(ctx, n, true); err != nil {
+			return count, fmt.Errorf("failed to pin root %s: %v", root, err)
+		}
+	}
+	return count, s.node.Pinning.Flush()
+}
+
+// parseCarBlock reads the block of a CAR section and verifies that its data hashes to the CID.
+func parseCarBlock(data []byte) (blocks.Block, error) {
+	c, n, err := parseCidPrefix(data)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := c.Prefix().Sum(data[n:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid block %s: %v", c, err)
+	} else if !sum.Equals(c) {
+		return nil, fmt.Errorf("%v: %s", ErrBlockMismatch, c)
+	}
+	return blocks.NewBlockWithCid(data[n:], c)
+}
+
+func writeCarSection(w io.Writer, parts ...[]byte) error {
+	var size int
+	for _, p := range parts {
+		size += len(p)
+	}
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(size))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readCarSection(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	} else if size > maxCarSection {
+		return nil, fmt.Errorf("CAR section is too large: %d", size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseCidPrefix reads a binary CID from the beginning of data, returns it with its length.
+func parseCidPrefix(data []byte) (cid.Cid, int, error) {
+	var n int
+	if len(data) > 2 && data[0] == 0x12 && data[1] == 0x20 {
+		// CIDv0 is a bare sha2-256 multihash
+		n = 34
+	} else {
+		// CIDv1: version, codec, then multihash code, length and digest
+		for i := 0; i < 3; i++ {
+			_, l := binary.Uvarint(data[n:])
+			if l <= 0 {
+				return cid.Cid{}, 0, errors.New("invalid CID in CAR section")
+			}
+			n += l
+		}
+		size, l := binary.Uvarint(data[n:])
+		if l <= 0 {
+			return cid.Cid{}, 0, errors.New("invalid CID in CAR section")
+		}
+		n += l + int(size)
+	}
+	if n > len(data) {
+		return cid.Cid{}, 0, errors.New("truncated CID in CAR section")
+	}
+	c, err := cid.Cast(data[:n])
+	if err != nil {
+		return cid.Cid{}, 0, err
+	}
+	return c, n, nil
+}
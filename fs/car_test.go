@@ -0,0 +1,38 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCarBlock(t *testing.T) {
+	require := require.New(t)
+
+	v0 := blocks.NewBlock([]byte("hello"))
+	v1, err := cid.Prefix{
+		Version:  1,
+		Codec:    cid.Raw,
+		MhType:   0x12, // sha2-256
+		MhLength: -1,
+	}.Sum([]byte("hello"))
+	require.NoError(err)
+
+	for _, c := range []cid.Cid{v0.Cid(), v1} {
+		b, err := parseCarBlock(append(c.Bytes(), "hello"...))
+		require.NoError(err)
+		require.True(c.Equals(b.Cid()))
+		require.Equal("hello", string(b.RawData()))
+
+		// a tampered block is refused
+		_, err = parseCarBlock(append(c.Bytes(), "hellO"...))
+		require.Error(err)
+		require.Contains(err.Error(), ErrBlockMismatch.Error())
+	}
+}
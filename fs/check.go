@@ -0,0 +1,94 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"context"
+	"fmt"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// ObjectStatus reports whether an object version is pinned and fully present in the local repo.
+type ObjectStatus struct {
+	Version string `json:"version"`
+	Pinned  bool   `json:"pinned"`
+	Blocks  int    `json:"blocks"`
+	Missing int    `json:"missing"`
+}
+
+// Complete is true when all blocks of the object DAG are present locally.
+func (o *ObjectStatus) Complete() bool {
+	return o.Missing == 0
+}
+
+// StatObject checks the pin and walks the object DAG in the local blockstore, without
+// fetching anything from peers.
+func (s *ipfsStore) StatObject(ctx context.Context, ref ObjectRef) (*ObjectStatus, error) {
+	root, err := cid.Parse(ref.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse object CID: %v", err)
+	}
+	status := &ObjectStatus{
+		Version: ref.Version,
+	}
+	if _, ok, err := s.node.Pinning.IsPinned(root); err != nil {
+		return nil, err
+	} else if ok {
+		status.Pinned = true
+	}
+	localDAG := dag.NewDAGService(bserv.New(s.node.Blockstore, offline.Exchange(s.node.Blockstore)))
+	seen := make(map[string]struct{})
+	var walk func(c cid.Cid) error
+	walk = func(c cid.Cid) error {
+		if _, ok := seen[c.KeyString()]; ok {
+			return nil
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		seen[c.KeyString()] = struct{}{}
+		if ok, err := s.node.Blockstore.Has(c); err != nil {
+			return err
+		} else if !ok {
+			status.Missing++
+			return nil
+		}
+		status.Blocks++
+		n, err := localDAG.Get(ctx, c)
+		if err != nil {
+			return fmt.Errorf("failed to decode block %s: %v", c, err)
+		}
+		for _, link := range n.Links() {
+			if err := walk(link.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(root); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// RepairObject fetches the missing blocks of the object DAG from peers and pins it.
+func (s *ipfsStore) RepairObject(ctx context.Context, ref ObjectRef) error {
+	root, err := cid.Parse(ref.Version)
+	if err != nil {
+		return fmt.Errorf("failed to parse object CID: %v", err)
+	}
+	n, err := s.node.DAG.Get(ctx, root)
+	if err != nil {
+		return fmt.Errorf("failed to fetch object: %v", err)
+	}
+	// recursive pinning fetches the whole DAG
+	if err := s.node.Pinning.Pin(ctx, n, true); err != nil {
+		return fmt.Errorf("failed to pin object: %v", err)
+	}
+	return s.node.Pinning.Flush()
+}
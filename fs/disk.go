@@ -0,0 +1,24 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+//go:build !windows
+
+package fs
+
+import "syscall"
+
+// diskStats reads usage of the volume the path resides on, free bytes are the ones
+// available to unprivileged users.
+func diskStats(path string) (*DiskStats, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return nil, err
+	}
+	ds := &DiskStats{
+		BytesAll:  fs.Blocks * uint64(fs.Bsize),
+		BytesFree: fs.Bavail * uint64(fs.Bsize),
+	}
+	ds.BytesUsed = ds.BytesAll - fs.Bfree*uint64(fs.Bsize)
+	return ds, nil
+}
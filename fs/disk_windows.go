@@ -0,0 +1,11 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package fs
+
+import "errors"
+
+func diskStats(path string) (*DiskStats, error) {
+	return nil, errors.New("disk stats are not supported on windows")
+}
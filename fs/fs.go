@@ -44,11 +44,18 @@ type PlanetaryFileStore interface {
 	GetObject(ctx context.Context, ref ObjectRef) (*Object, error)
 	HeadObject(ctx context.Context, ref ObjectRef) (*ObjectRef, error)
 	ListObjects(ctx context.Context, ref ObjectRef) ([]ObjectRef, error)
+	ListPinnedObjects(ctx context.Context) ([]ObjectRef, error)
+	StatObject(ctx context.Context, ref ObjectRef) (*ObjectStatus, error)
+	RepairObject(ctx context.Context, ref ObjectRef) error
+
+	ExportBlocks(ctx context.Context, w io.Writer) (int, error)
+	ImportBlocks(ctx context.Context, r io.Reader, versions []string) (int, error)
 
 	DiskStats() (*DiskStats, error)
 	BandwidthStats() *BandwidthStats
 	RepoStats() *RepoStats
 	BitswapStats() *BitswapStats
+	PeerCount() int
 
 	Close() error
 }
@@ -92,6 +99,11 @@ type ObjectRef struct {
 	VersionPrevious string
 	VersionOffset   int
 
+	// CreatedAt overrides the creation time of a new object, so nodes can produce identical objects.
+	CreatedAt int64
+	// ExpiresAt is the time after which the record of the object is deleted, zero means never.
+	ExpiresAt int64
+
 	muxOnce sync.Once
 	metaMux *sync.RWMutex
 	meta    *proto.ObjectMeta
@@ -131,8 +143,13 @@ func (o *ObjectRef) ToProto() (proto.ObjectMeta, error) {
 	} else {
 		meta.SetSize(o.Size)
 	}
-	meta.SetCreatedAt(time.Now().UnixNano())
+	if o.CreatedAt > 0 {
+		meta.SetCreatedAt(o.CreatedAt)
+	} else {
+		meta.SetCreatedAt(time.Now().UnixNano())
+	}
 	meta.SetVersionPrevious(o.VersionPrevious)
+	meta.SetExpiresAt(o.ExpiresAt)
 	return meta, nil
 }
 
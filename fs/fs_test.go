@@ -5,6 +5,8 @@
 package fs
 
 import (
+	"io/ioutil"
+	"net"
 	"strings"
 	"testing"
 )
@@ -28,3 +30,54 @@ func TestNewPrivateKey(t *testing.T) {
 		t.Fatal("NewPrivateKey: expected valid private key, received: " + lines[2])
 	}
 }
+
+func TestDiskStats(t *testing.T) {
+	ds, err := diskStats(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.BytesAll == 0 || ds.BytesFree > ds.BytesAll {
+		t.Fatalf("diskStats: unexpected volume usage: %+v", ds)
+	}
+}
+
+func TestPeerListener(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := NewPeerListener(l)
+	defer pl.Close()
+
+	// a stream without the peer ID is dropped
+	bad, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Write([]byte("GET / HTTP/1.1\n"))
+	bad.Close()
+
+	const peerID = "QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ"
+	conn, err := net.Dial("tcp4", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(peerID + "\nhello"))
+	conn.Close()
+
+	accepted, err := pl.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer accepted.Close()
+	if addr := accepted.RemoteAddr().String(); addr != peerID {
+		t.Fatalf("PeerListener: expected remote address %s, got %s", peerID, addr)
+	}
+	data, err := ioutil.ReadAll(accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("PeerListener: expected stream data after peer ID, got %q", data)
+	}
+}
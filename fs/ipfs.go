@@ -125,7 +125,7 @@ func (s *ipfsStore) putObject(ctx context.Context, ref ObjectRef,
 		return nil, err
 	}
 	ref.Version = node.Cid().String()
-	if err := s.PinNewest(ref, 3); err != nil {
+	if err := s.PinNewest(ref, s.opts.PinDepth(ref.Path)); err != nil {
 		err = fmt.Errorf("failed to pin object file, it will be soon collected by GC: %v", err)
 		return nil, err
 	}
@@ -271,6 +271,21 @@ func (s *ipfsStore) ListObjects(ctx context.Context, ref ObjectRef) ([]ObjectRef
 	return list, nil
 }
 
+// ListPinnedObjects returns refs of all recursively pinned object versions, pins that are
+// not object directories are skipped.
+func (s *ipfsStore) ListPinnedObjects(ctx context.Context) ([]ObjectRef, error) {
+	var list []ObjectRef
+	for _, c := range s.node.Pinning.RecursiveKeys() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if obj := s.cidToObjectRef(ctx, c.String()); obj != nil {
+			list = append(list, *obj)
+		}
+	}
+	return list, nil
+}
+
 func (s *ipfsStore) PinObject(ref ObjectRef) error {
 	p, err := ipath.ParseCidToPath(ref.Version)
 	if err != nil {
@@ -309,24 +324,29 @@ func (s *ipfsStore) PinNewest(ref ObjectRef, depth int) error {
 
 	prevVer := ref.VersionPrevious
 	for prevVer != "" {
-		if depth--; depth < 0 {
-			objRef := s.cidToObjectRef(s.node.Context(), prevVer)
-			prevVer = objRef.VersionPrevious
-			id, err := cid.Parse(objRef.Version)
-			if err != nil {
-				return fmt.Errorf("failed to parse ID to CID: %v", err)
-			}
-			if _, ok, _ := s.node.Pinning.IsPinned(id); !ok {
-				continue
-			}
-			if err := s.node.Pinning.Unpin(s.node.Context(), id, true); err != nil {
-				return err
-			}
-			if _, ok, _ := s.node.Pinning.IsPinned(id); ok {
-				return fmt.Errorf("failed object unpinning: cid %s", id.String())
-			}
-			log.Debugf("successful unpinning cid: %s", id.String())
+		objRef := s.cidToObjectRef(s.node.Context(), prevVer)
+		if objRef == nil {
+			break
+		}
+		prevVer = objRef.VersionPrevious
+		if depth--; depth >= 0 {
+			continue
+		}
+		id, err := cid.Parse(objRef.Version)
+		if err != nil {
+			return fmt.Errorf("failed to parse ID to CID: %v", err)
+		}
+		if _, ok, _ := s.node.Pinning.IsPinned(id); !ok {
+			// older versions have been unpinned already
+			break
 		}
+		if err := s.node.Pinning.Unpin(s.node.Context(), id, true); err != nil {
+			return err
+		}
+		if _, ok, _ := s.node.Pinning.IsPinned(id); ok {
+			return fmt.Errorf("failed object unpinning: cid %s", id.String())
+		}
+		log.Debugf("successful unpinning cid: %s", id.String())
 	}
 	return s.node.Pinning.Flush()
 }
@@ -383,6 +403,7 @@ func (s *ipfsStore) cidToObjectRef(ctx context.Context, cid string) *ObjectRef {
 
 		Version:         cid,
 		VersionPrevious: meta.VersionPrevious(),
+		ExpiresAt:       meta.ExpiresAt(),
 
 		meta: &meta,
 	}
@@ -427,7 +448,7 @@ func newIpfsStore(prefix string, needInit bool, opts ...IpfsOpt) (*ipfsStore, er
 		}
 	}
 	cfg := &core.BuildCfg{
-		Online: true,
+		Online: s.opts.Online,
 		ExtraOpts: map[string]bool{
 			"pubsub": s.opts.PubSubEnabled,
 			"ipnsps": false,
@@ -636,16 +657,7 @@ func (s *ipfsStore) nodesForPaths(ctx context.Context, paths []string) ([]ipld.N
 }
 
 func (s *ipfsStore) DiskStats() (*DiskStats, error) {
-	// var fs syscall.Statfs_t
-	// if err := syscall.Statfs(s.prefix, &fs); err != nil {
-	// 	return nil, err
-	// }
-	ds := &DiskStats{
-		// BytesAll:  fs.Blocks * uint64(fs.Bsize),
-		// BytesFree: fs.Bfree * uint64(fs.Bsize),
-	}
-	ds.BytesUsed = ds.BytesAll - ds.BytesFree
-	return ds, nil
+	return diskStats(s.prefix)
 }
 
 func (s *ipfsStore) BandwidthStats() *BandwidthStats {
@@ -699,6 +711,13 @@ func (s *ipfsStore) BitswapStats() *BitswapStats {
 	}
 }
 
+func (s *ipfsStore) PeerCount() int {
+	if s.node.PeerHost == nil {
+		return 0
+	}
+	return len(s.node.PeerHost.Network().Peers())
+}
+
 func (s *ipfsStore) SignData(nodeID string, data []byte) ([]byte, error) {
 	pk := s.node.PrivateKey.GetPublic()
 	id, err := peer.IDFromEd25519PublicKey(pk)
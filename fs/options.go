@@ -16,6 +16,7 @@ type PlanetaryCache interface{}
 
 type ipfsOptions struct {
 	StoreEnabled   bool
+	Online         bool
 	RelayEnabled   bool
 	PubSubEnabled  bool
 	NetworkProfile NetworkProfile
@@ -23,6 +24,7 @@ type ipfsOptions struct {
 	ListenHost     string
 	ListenPort     int
 	Cache          PlanetaryCache
+	PinDepth       func(path string) int
 }
 
 // IpfsOpt handler for options
@@ -31,12 +33,16 @@ type IpfsOpt func(o *ipfsOptions)
 func defaultIpfsOptions() *ipfsOptions {
 	return &ipfsOptions{
 		StoreEnabled:   true,
+		Online:         true,
 		RelayEnabled:   false,
 		PubSubEnabled:  true,
 		NetworkProfile: NetworkDefault,
 		BootstrapPeers: []config.BootstrapPeer{},
 		ListenHost:     "0.0.0.0",
 		ListenPort:     33770,
+		PinDepth: func(path string) int {
+			return 3
+		},
 	}
 }
 
@@ -47,6 +53,13 @@ func UseStoreOpt(v bool) IpfsOpt {
 	}
 }
 
+// UseOnlineOpt handler to start IPFS node without networking, when v is false
+func UseOnlineOpt(v bool) IpfsOpt {
+	return func(o *ipfsOptions) {
+		o.Online = v
+	}
+}
+
 // UseCacheOpt handler for Cache IPFS config option
 func UseCacheOpt(cache PlanetaryCache) IpfsOpt {
 	return func(o *ipfsOptions) {
@@ -54,6 +67,15 @@ func UseCacheOpt(cache PlanetaryCache) IpfsOpt {
 	}
 }
 
+// PinDepthOpt handler to set the number of previous object versions kept pinned, negative means all
+func PinDepthOpt(fn func(path string) int) IpfsOpt {
+	return func(o *ipfsOptions) {
+		if fn != nil {
+			o.PinDepth = fn
+		}
+	}
+}
+
 // UseRelayOpt handler for RelayEnabled IPFS config option
 func UseRelayOpt(v bool) IpfsOpt {
 	return func(o *ipfsOptions) {
@@ -5,11 +5,15 @@
 package fs
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -86,6 +90,105 @@ func (l *p2pListener) IsRunning() bool {
 	return len(l.node.P2P.ListenersP2P.Listeners) > 0
 }
 
+// peerHeaderTimeout limits the time to receive the remote peer ID of a forwarded stream.
+const peerHeaderTimeout = 10 * time.Second
+
+// PeerAddr is the address of a remote peer, that is its base58 ID.
+type PeerAddr string
+
+// Network returns the name of the network
+func (a PeerAddr) Network() string { return "p2p" }
+
+func (a PeerAddr) String() string { return string(a) }
+
+// NewPeerListener wraps the listener that PlanetaryListener forwards streams to. Each forwarded
+// stream starts with the ID of the remote peer, it is consumed and reported as a PeerAddr by
+// RemoteAddr of the connection. Connections that don't start with a valid peer ID are closed.
+func NewPeerListener(l net.Listener) net.Listener {
+	pl := &peerListener{
+		Listener: l,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	go pl.acceptLoop()
+	return pl
+}
+
+type peerListener struct {
+	net.Listener
+
+	conns chan net.Conn
+	done  chan struct{}
+	err   error
+}
+
+func (l *peerListener) acceptLoop() {
+	defer close(l.done)
+	for {
+		conn, err := l.Listener.Accept()
+		if ne, ok := err.(net.Error); ok && ne.Temporary() {
+			time.Sleep(5 * time.Millisecond)
+			continue
+		} else if err != nil {
+			l.err = err
+			return
+		}
+		// read headers concurrently, so a slow peer doesn't hold up others
+		go l.handshake(conn)
+	}
+}
+
+func (l *peerListener) handshake(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(peerHeaderTimeout))
+	r := bufio.NewReaderSize(conn, 128)
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		log.WithField("remoteAddr", conn.RemoteAddr()).Debugf("failed to read peer ID of a stream: %v", err)
+		conn.Close()
+		return
+	}
+	id, err := peer.IDB58Decode(strings.TrimSpace(string(line)))
+	if err != nil {
+		log.WithField("remoteAddr", conn.RemoteAddr()).Debugf("failed to parse peer ID of a stream: %v", err)
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+	select {
+	case l.conns <- &peerConn{
+		Conn: conn,
+		r:    r,
+		addr: PeerAddr(id.Pretty()),
+	}:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *peerListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+type peerConn struct {
+	net.Conn
+
+	r    *bufio.Reader
+	addr PeerAddr
+}
+
+func (c *peerConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *peerConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
 // PlanetaryClient http client for PlanetaryListener
 type PlanetaryClient interface {
 	// Do performs a HTTP request over the pipe to PlanetaryListener, e.g.
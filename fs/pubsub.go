@@ -30,6 +30,7 @@ var (
 type PlanetaryPubSub interface {
 	Publish(topic string, data []byte) error
 	Subscribe(fn MessagePeekFunc, topics ...string) error
+	ListPeers(topic string) []string
 	Close() error
 	Config() (*config.PubsubConfig, error)
 }
@@ -54,6 +55,19 @@ func (p *ipfsPubSub) Publish(topic string, data []byte) error {
 	return p.node.PubSub.Publish(topic, data)
 }
 
+// ListPeers returns IDs of the peers known to be subscribed to the topic.
+func (p *ipfsPubSub) ListPeers(topic string) []string {
+	if p.node == nil || p.node.PubSub == nil {
+		return nil
+	}
+	ids := p.node.PubSub.ListPeers(topic)
+	peers := make([]string, 0, len(ids))
+	for _, id := range ids {
+		peers = append(peers, id.Pretty())
+	}
+	return peers
+}
+
 // TODO(max):
 // RegisterTopicValidator
 // WithValidatorConcurrency
@@ -5,7 +5,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -25,10 +29,12 @@ import (
 	"github.com/AtlantPlatform/atlant-go/api"
 	"github.com/AtlantPlatform/atlant-go/authcenter"
 	"github.com/AtlantPlatform/atlant-go/contracts"
+	"github.com/AtlantPlatform/atlant-go/credentials"
 	"github.com/AtlantPlatform/atlant-go/fs"
 	"github.com/AtlantPlatform/atlant-go/rs"
 	"github.com/AtlantPlatform/atlant-go/state"
 	"github.com/AtlantPlatform/atlant-go/version"
+	"github.com/AtlantPlatform/atlant-go/webhooks"
 	"github.com/ipfs/go-ipfs/plugin/loader"
 )
 
@@ -38,9 +44,12 @@ var (
 	ipfsConfigFile    = "config"
 	ipfsKeyFile       = "swarm.key"
 	ipfsKeyDataPrefix = "/key/swarm/psk/1.0.0/\n/base16/\n"
+	adminTokenFile    = "admin.token"
 )
 var (
 	testingCommands []testingCmd
+	// retention is the version retention policy of the node, nil means default
+	retention rs.RetentionPolicy
 )
 
 type testingCmd struct {
@@ -53,6 +62,12 @@ func main() {
 	app.Command("init", "Initialize node and its IPFS repo.", nodeInitCmd)
 	app.Command("version", "Show version info.", versionCmd)
 	app.Command("verify", "Verify node.", verify)
+	app.Command("reindex", "Rebuild the path index of the record store.", reindexCmd)
+	app.Command("recover", "Rebuild the record store from objects pinned in IPFS.", recoverCmd)
+	app.Command("fsck", "Verify that records are signed and their versions are pinned.", fsckCmd)
+	app.Command("export", "Export records into a signed snapshot file.", exportCmd)
+	app.Command("import", "Import records from a snapshot file.", importCmd)
+	app.Command("credentials", "Manage API credentials of a running node via admin API.", credentialsCmd)
 	for _, cmd := range testingCommands {
 		if len(cmd.Name) == 0 {
 			panic("found an unnamed testing command")
@@ -98,35 +113,20 @@ func main() {
 		}
 	}
 	app.Action = func() {
-		var hasTestnetMark bool
-		if info, err := os.Stat(filepath.Join(*fsDir, "testnet")); err == nil && !info.IsDir() {
-			hasTestnetMark = true
+		initNetwork()
+		policy, err := rs.ParseRetentionPolicy(*fsRetention)
+		if err != nil {
+			log.Fatalln(err)
 		}
-		if hasTestnetMark {
-			*envTestnet = true
+		retention = policy
+		authMode := api.AuthMode(*apiAuth)
+		switch authMode {
+		case api.AuthOff, api.AuthWrite, api.AuthAll:
+		default:
+			log.Fatalln("unknown --api-auth mode:", *apiAuth)
 		}
-		if *envTestnet {
-			if !hasTestnetMark {
-				log.Fatalln("refusing to start in a testnet mode: not initialized for testnet.")
-			}
-			// if *envTestnetKey != testKey {
-			// 	log.Warningln("overriding testnet key works only upon initialization, no effect now.")
-			// }
-			if len(*envTestnetUrls) > 0 {
-				authcenter.InitWithURLs(*envTestnetUrls)
-			} else {
-				domains := append(*envTestnetDomains, authcenter.DefaultTestDomains...)
-				authcenter.InitWithDomains(domains)
-			}
-			log.Println("ATLANT TestNet welcomes you!")
-		} else {
-			if len(*envTestnetDomains) > 0 {
-				log.Warningln("overriding DNS auth domains works only within testnet, no effect now.")
-			}
-			if *envTestnetKey != testKey {
-				log.Warningln("overriding testnet key works only within testnet, no effect now.")
-			}
-			log.Println("ATLANT MainNet welcomes you!")
+		if authMode == api.AuthOff {
+			log.Warningln("public API accepts writes without credentials, consider --api-auth write")
 		}
 		runWithPlanetaryContext(func(ctx PlanetaryContext) {
 			defer catcher.Catch(catcher.RecvWrite(logger, true))
@@ -135,12 +135,20 @@ func main() {
 			// if len(*clusterName) == 0 {
 			// 	*clusterName = ctx.SessionID()
 			// }
-			if err := rs.GC(ctx.FileStore(), ctx.StateStore(), 3); err != nil {
+			if n, err := rs.RebuildPathIndex(ctx.StateStore(), false); err != nil {
+				log.Warningln("Path index rebuild failed with:", err)
+			} else if n > 0 {
+				log.Infof("Path index rebuilt for %d records", n)
+			}
+			if err := rs.GC(ctx.FileStore(), ctx.StateStore(), retention); err != nil {
 				log.Warningln("Record GC failed with:", err)
 			} else {
 				log.Debugln("Record GC completed")
 			}
-			store, err := rs.NewPlanetaryRecordStore(ctx.NodeID(), ctx.FileStore(), ctx.StateStore())
+			store, err := rs.NewPlanetaryRecordStore(ctx.NodeID(), ctx.FileStore(), ctx.StateStore(),
+				rs.RetentionOpt(retention),
+				rs.ClockSkewOpt(duration(*fsClockSkew, 10*time.Minute)),
+				rs.AnnounceFanoutOpt(toNatural(*fsAnnounceFanout, 8)))
 			if err != nil {
 				log.Fatalln(err)
 			}
@@ -159,14 +167,20 @@ func main() {
 				}()
 				go func() {
 					defer wg.Done()
-					store.WaitOutbound(2 * time.Minute)
+					if n := store.WaitOutbound(2 * time.Minute); n > 0 {
+						log.Warningf("%d record announces left unsent, they will be published on the next start", n)
+					}
 				}()
 				wg.Wait()
 			})
 
 			*ethAddress = strings.ToLower(*ethAddress)
 			mgr := contracts.NewManager(ctx.SessionID(), store, *envTestnet)
-			apiCtx := api.NewContext(ctx, store, mgr, *ethAddress, *logDir)
+			hooks := webhooks.NewManager(ctx.StateStore(), store,
+				webhooks.AllowPrivateOpt(*webhookAllowPrivate))
+			creds := credentials.NewManager(ctx.StateStore())
+			apiCtx := api.NewContext(context.WithValue(context.WithValue(ctx,
+				"webhooks", hooks), "credentials", creds), store, mgr, *ethAddress, *logDir)
 			privateServer := api.NewPrivateServer()
 			privateServer.RouteAPI(apiCtx)
 			privAddr, err := privateServer.Listen("127.0.0.1:0")
@@ -178,28 +192,52 @@ func main() {
 			if err := ctx.FileStore().Listener().Listen(privMultiAddr); err != nil {
 				log.Fatalln(err)
 			}
+			if len(*adminListenAddr) > 0 {
+				token, err := adminToken(*adminTokenOpt, filepath.Join(*fsDir, adminTokenFile))
+				if err != nil {
+					log.Fatalln(err)
+				}
+				adminServer := api.NewAdminServer(token)
+				adminServer.RouteAPI(apiCtx)
+				adminAddr, err := adminServer.Listen(*adminListenAddr)
+				if err != nil {
+					log.Fatalln(err)
+				}
+				log.Infoln("admin API listens on", adminAddr)
+			}
+
+			// serve while syncing, so /readyz reports the progress to load balancers
+			publicServer := api.NewPublicServer(api.ReadinessOpt(api.ReadinessOpts{
+				MinPeers:    toNatural(*readyMinPeers, 1),
+				MaxAuthAge:  duration(*readyAuthAge, 10*time.Minute),
+				MinDiskFree: uint64(toNatural(*readyDiskFree, 1024)) * api.MB,
+			}), api.AuthOpt(authMode))
+			publicServer.RouteAPI(apiCtx)
+			go func() {
+				if err := publicServer.ListenAndServe(*webListenAddr); err != nil {
+					log.Fatalln(err)
+				}
+			}()
 
 			time.Sleep(duration(*fsWarmupDur, 5*time.Second))
 			if err := store.Sync(duration(*fsSyncTimeout, 10*time.Minute)); err != nil {
 				log.Errorln(err)
 				closer.Fatalln(err)
 			}
+			go store.AntiEntropy(ctx, duration(*fsSyncInterval, 5*time.Minute))
+			go hooks.Run(ctx, 4)
+			go store.RunGC(ctx, duration(*fsGCInterval, time.Hour))
+			go store.ExpireRecords(ctx, time.Minute)
+			go store.RetryPendingFetches(ctx, 30*time.Second, time.Minute)
 			if len(*ethAddress) > 0 && len(*ethAddress) < 64 {
 				go store.SendBeats(ctx, 10*time.Minute, 60*time.Minute, *ethAddress)
 			}
 			if authcenter.Default.HasPermissions(ctx.NodeID(), authcenter.RecordWritePermission) {
 				log.Infoln("this node has interplanetary write permissions")
 				go store.CommitBeatReports(ctx, 60*time.Minute)
+				go store.AnnounceHeads(ctx, duration(*fsHeadsInterval, time.Hour))
 			}
 
-			publicServer := api.NewPublicServer()
-			publicServer.RouteAPI(apiCtx)
-			go func() {
-				if err := publicServer.ListenAndServe(*webListenAddr); err != nil {
-					log.Fatalln(err)
-				}
-			}()
-
 			closer.Hold()
 		})
 	}
@@ -208,6 +246,40 @@ func main() {
 	}
 }
 
+// initNetwork detects the network of the node and initializes the auth center for testnet.
+func initNetwork() {
+	var hasTestnetMark bool
+	if info, err := os.Stat(filepath.Join(*fsDir, "testnet")); err == nil && !info.IsDir() {
+		hasTestnetMark = true
+	}
+	if hasTestnetMark {
+		*envTestnet = true
+	}
+	if *envTestnet {
+		if !hasTestnetMark {
+			log.Fatalln("refusing to start in a testnet mode: not initialized for testnet.")
+		}
+		// if *envTestnetKey != testKey {
+		// 	log.Warningln("overriding testnet key works only upon initialization, no effect now.")
+		// }
+		if len(*envTestnetUrls) > 0 {
+			authcenter.InitWithURLs(*envTestnetUrls)
+		} else {
+			domains := append(*envTestnetDomains, authcenter.DefaultTestDomains...)
+			authcenter.InitWithDomains(domains)
+		}
+		log.Println("ATLANT TestNet welcomes you!")
+	} else {
+		if len(*envTestnetDomains) > 0 {
+			log.Warningln("overriding DNS auth domains works only within testnet, no effect now.")
+		}
+		if *envTestnetKey != testKey {
+			log.Warningln("overriding testnet key works only within testnet, no effect now.")
+		}
+		log.Println("ATLANT MainNet welcomes you!")
+	}
+}
+
 func runWithPlanetaryContext(fn func(ctx PlanetaryContext)) {
 	defer closer.Close()
 	closer.Bind(func() {
@@ -247,12 +319,7 @@ func runWithPlanetaryContext(fn func(ctx PlanetaryContext)) {
 		"peers":   len(*fsBootstrapPeers),
 	}).Println("IPFS node warmup in progress")
 
-	// the following block is required to initialize badgerds via plugin loader
-	ldr, err := loader.NewPluginLoader("")
-	if err != nil {
-		log.Fatalln("NewPluginLoader failed:", err)
-	}
-	ldr.Inject()
+	injectPlugins()
 
 	fileStore, err := fs.NewPlanetaryFileStore(*fsDir,
 		fs.UseBootstrapPeersOpt(*fsBootstrapPeers),
@@ -260,6 +327,7 @@ func runWithPlanetaryContext(fn func(ctx PlanetaryContext)) {
 		fs.ListenHostOpt(fsHost),
 		fs.ListenPortOpt(fsPort),
 		fs.UseNetworkProfileOpt(fs.NetworkProfile(*fsNetworkProfile)),
+		fs.PinDepthOpt(retention.PinDepth),
 	)
 	if err != nil {
 		closer.Fatalln("NewPlanetaryFileStore failed:", err)
@@ -269,11 +337,14 @@ func runWithPlanetaryContext(fn func(ctx PlanetaryContext)) {
 			log.Warningf("failed to close IPFS store: %v", err)
 		}
 	})
-	log.Debugln("NewIndexedStoreBadger open state DB")
-	stateStore, err := state.NewIndexedStoreBadger(*stateDir,
+	log.Debugf("NewIndexedStore open state DB (engine: %s)", *stateEngine)
+	if *stateEngine == state.EngineMemory {
+		log.Warningln("state DB is kept in memory, records will be synced from peers again after restart")
+	}
+	stateStore, err := state.NewIndexedStore(*stateEngine, *stateDir,
 		state.GCIntervalOption(duration(*stateGcInterval, 5*time.Minute)))
 	if err != nil {
-		closer.Fatalln("NewIndexedStoreBadger failed:", err)
+		closer.Fatalln("NewIndexedStore failed:", err)
 	}
 	closer.Bind(func() {
 		if err := stateStore.Close(); err != nil {
@@ -312,6 +383,73 @@ func verify(cmd *cli.Cmd) {
 	}
 }
 
+func reindexCmd(c *cli.Cmd) {
+	c.Action = func() {
+		log.Debugf("using %s as state dir", *stateDir)
+		stateStore, err := state.NewIndexedStore(*stateEngine, *stateDir)
+		if err != nil {
+			log.Fatalln("NewIndexedStore failed:", err)
+		}
+		defer stateStore.Close()
+		n, err := rs.RebuildPathIndex(stateStore, true)
+		if err != nil {
+			log.Fatalln("path index rebuild failed:", err)
+		}
+		log.Infof("path index rebuilt for %d records", n)
+	}
+}
+
+func recoverCmd(c *cli.Cmd) {
+	c.Action = func() {
+		withOfflineStores(func(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore) {
+			stats, err := rs.RecoverRecords(context.Background(), fileStore, stateStore)
+			if err != nil {
+				log.Fatalln("record store recovery failed:", err)
+			}
+			log.WithFields(log.Fields{
+				"objects":  stats.Objects,
+				"existing": stats.Existing,
+				"forks":    stats.Forks,
+			}).Infof("recovered %d records, they will be completed by a sync", stats.Records)
+		})
+	}
+}
+
+func fsckCmd(c *cli.Cmd) {
+	c.Spec = "[--repair] [--timeout]"
+	repair := c.BoolOpt("repair", false, "Re-fetch missing versions from peers and pin them.")
+	timeout := c.StringOpt("timeout", "1m", "Timeout to repair a single version.")
+	c.Action = func() {
+		policy, err := rs.ParseRetentionPolicy(*fsRetention)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		run := func(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore) {
+			report, err := rs.Fsck(context.Background(), fileStore, stateStore, rs.FsckOptions{
+				Retention:     policy,
+				Repair:        *repair,
+				RepairTimeout: duration(*timeout, time.Minute),
+			})
+			if err != nil {
+				log.Fatalln("fsck failed:", err)
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "    ")
+			enc.Encode(report)
+			log.Infof("fsck checked %d records: %d broken, %d repaired", report.Records, report.Broken, report.Repaired)
+		}
+		if !*repair {
+			withOfflineStores(run)
+			return
+		}
+		initNetwork()
+		runWithPlanetaryContext(func(ctx PlanetaryContext) {
+			time.Sleep(duration(*fsWarmupDur, 5*time.Second))
+			run(ctx.FileStore(), ctx.StateStore())
+		})
+	}
+}
+
 func versionCmd(c *cli.Cmd) {
 	c.Action = func() {
 		fmt.Fprintf(os.Stdout, "atlant-go version %s\n", version.Version)
@@ -374,12 +512,7 @@ func nodeInitCmd(c *cli.Cmd) {
 			}).Println("generated new private key for IPFS swarm")
 		}
 
-		// the following block is required to initialize badgerds via plugin loader
-		ldr, err := loader.NewPluginLoader("")
-		if err != nil {
-			log.Fatalln("NewPluginLoader failed:", err)
-		}
-		ldr.Inject()
+		injectPlugins()
 
 		log.WithFields(log.Fields{
 			"Dir":      *fsDir,
@@ -396,6 +529,35 @@ func nodeInitCmd(c *cli.Cmd) {
 	}
 }
 
+// injectPlugins is required to initialize badgerds via plugin loader.
+func injectPlugins() {
+	ldr, err := loader.NewPluginLoader("")
+	if err != nil {
+		log.Fatalln("NewPluginLoader failed:", err)
+	}
+	ldr.Inject()
+}
+
+// adminToken returns the configured admin API token, otherwise the one kept in the file.
+// A random token is generated and saved into the file when it doesn't exist.
+func adminToken(token, path string) (string, error) {
+	if len(token) > 0 {
+		return token, nil
+	} else if data, err := ioutil.ReadFile(path); err == nil && len(bytes.TrimSpace(data)) > 0 {
+		return string(bytes.TrimSpace(data)), nil
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(buf)
+	if err := ioutil.WriteFile(path, []byte(token), 0600); err != nil {
+		return "", fmt.Errorf("failed to save admin token: %v", err)
+	}
+	log.Infoln("admin API token has been generated and saved into", path)
+	return token, nil
+}
+
 func fileNotEmpty(path string) bool {
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
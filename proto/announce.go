@@ -7,8 +7,10 @@ package proto
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	capn "github.com/glycerine/go-capnproto"
+	"github.com/oklog/ulid"
 
 	"github.com/AtlantPlatform/atlant-go/state"
 )
@@ -252,3 +254,130 @@ func UnpackEnvelopeRecordUpdate(data []byte) (EnvelopeRecordUpdate, error) {
 	v := ReadRootEnvelopeRecordUpdate(seg)
 	return v, nil
 }
+
+type EnvelopeRecordBatchPeekFunc func(key *state.Key, v *EnvelopeRecordBatch) error
+
+func EnvelopeRecordBatchPeek(fn EnvelopeRecordBatchPeekFunc) state.PeekFunc {
+	return func(k *state.Key, v []byte) error {
+		if v == nil {
+			return fn(k, nil)
+		}
+		multiBuffer := capn.NewSingleSegmentMultiBuffer()
+		read, err := capn.ReadFromMemoryZeroCopyNoAlloc(v, multiBuffer)
+		if err != nil {
+			return err
+		} else if read != int64(len(v)) {
+			panic(fmt.Sprintf("wrong read: %d != %d", read, len(v)))
+		}
+		vv := ReadRootEnvelopeRecordBatch(multiBuffer.Segments[0])
+		return fn(k, &vv)
+	}
+}
+
+type EnvelopeRecordBatchModifyFunc func(key *state.Key, v *EnvelopeRecordBatch) (*EnvelopeRecordBatch, error)
+
+func EnvelopeRecordBatchModify(fn EnvelopeRecordBatchModifyFunc) state.ModifyFunc {
+	return func(k *state.Key, v []byte) ([]byte, error) {
+		if v == nil {
+			ret, err := fn(k, nil)
+			if err != nil || ret == nil {
+				return nil, err
+			}
+			buf := new(bytes.Buffer)
+			if _, err := ret.Segment.WriteTo(buf); err != nil {
+				return v, err
+			}
+			return buf.Bytes(), nil
+		}
+		seg, err := capn.ReadFromStream(bytes.NewReader(v), nil)
+		if err != nil {
+			return nil, err
+		}
+		vv := ReadRootEnvelopeRecordBatch(seg)
+		ret, err := fn(k, &vv)
+		if err != nil || ret == nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		if _, err := ret.Segment.WriteTo(buf); err != nil {
+			return v, err
+		}
+		return buf.Bytes(), nil
+	}
+}
+
+func UnpackEnvelopeRecordBatch(data []byte) (EnvelopeRecordBatch, error) {
+	seg, err := capn.ReadFromPackedStream(bytes.NewReader(data), nil)
+	if err != nil {
+		return EnvelopeRecordBatch{}, err
+	}
+	v := ReadRootEnvelopeRecordBatch(seg)
+	return v, nil
+}
+
+func UnpackEnvelopeRecordHeads(data []byte) (EnvelopeRecordHeads, error) {
+	seg, err := capn.ReadFromPackedStream(bytes.NewReader(data), nil)
+	if err != nil {
+		return EnvelopeRecordHeads{}, err
+	}
+	v := ReadRootEnvelopeRecordHeads(seg)
+	return v, nil
+}
+
+// EnvelopeSignedAt returns the time covered by the signature of the announce envelope in
+// nanoseconds: the signing time of a record update, or the time of the envelope ID for other
+// announce types. Zero means the envelope carries no signed time.
+func EnvelopeSignedAt(typ AnnounceType, envelope []byte) int64 {
+	var id string
+	switch typ {
+	case ANNOUNCETYPE_RECORDUPDATE:
+		e, err := UnpackEnvelopeRecordUpdate(envelope)
+		if err != nil {
+			return 0
+		}
+		return e.SignedAt()
+	case ANNOUNCETYPE_RECORDBATCH:
+		e, err := UnpackEnvelopeRecordBatch(envelope)
+		if err != nil {
+			return 0
+		}
+		id = e.Id()
+	case ANNOUNCETYPE_RECORDHEADS:
+		e, err := UnpackEnvelopeRecordHeads(envelope)
+		if err != nil {
+			return 0
+		}
+		id = e.Id()
+	case ANNOUNCETYPE_BEATTICK:
+		e, err := UnpackEnvelopeBeatTick(envelope)
+		if err != nil {
+			return 0
+		}
+		id = e.Id()
+	case ANNOUNCETYPE_BEATINFO:
+		e, err := UnpackEnvelopeBeatInfo(envelope)
+		if err != nil {
+			return 0
+		}
+		id = e.Id()
+	default:
+		return 0
+	}
+	u, err := ulid.Parse(id)
+	if err != nil {
+		return 0
+	}
+	return int64(u.Time()) * int64(time.Millisecond)
+}
+
+// AnnounceSignedAt returns EnvelopeSignedAt of the announce. Record updates of nodes running older
+// versions carry no signed time, the unsigned announce timestamp is used for them instead, so
+// mixed-version networks keep accepting each other's writes during an upgrade.
+func AnnounceSignedAt(typ AnnounceType, ann Announce) int64 {
+	if ts := EnvelopeSignedAt(typ, ann.Envelope()); ts > 0 {
+		return ts
+	} else if typ == ANNOUNCETYPE_RECORDUPDATE {
+		return ann.Timestamp()
+	}
+	return 0
+}
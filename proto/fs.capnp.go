@@ -12,9 +12,9 @@ import (
 
 type ObjectMeta C.Struct
 
-func NewObjectMeta(s *C.Segment) ObjectMeta      { return ObjectMeta(s.NewStruct(24, 5)) }
-func NewRootObjectMeta(s *C.Segment) ObjectMeta  { return ObjectMeta(s.NewRootStruct(24, 5)) }
-func AutoNewObjectMeta(s *C.Segment) ObjectMeta  { return ObjectMeta(s.NewStructAR(24, 5)) }
+func NewObjectMeta(s *C.Segment) ObjectMeta      { return ObjectMeta(s.NewStruct(32, 5)) }
+func NewRootObjectMeta(s *C.Segment) ObjectMeta  { return ObjectMeta(s.NewRootStruct(32, 5)) }
+func AutoNewObjectMeta(s *C.Segment) ObjectMeta  { return ObjectMeta(s.NewStructAR(32, 5)) }
 func ReadRootObjectMeta(s *C.Segment) ObjectMeta { return ObjectMeta(s.Root(0).ToStruct()) }
 func (s ObjectMeta) Id() string                  { return C.Struct(s).GetObject(0).ToText() }
 func (s ObjectMeta) IdBytes() []byte             { return C.Struct(s).GetObject(0).ToDataTrimLastByte() }
@@ -39,6 +39,8 @@ func (s ObjectMeta) SetSize(v int64)             { C.Struct(s).Set64(16, uint64(
 func (s ObjectMeta) UserMeta() string            { return C.Struct(s).GetObject(4).ToText() }
 func (s ObjectMeta) UserMetaBytes() []byte       { return C.Struct(s).GetObject(4).ToDataTrimLastByte() }
 func (s ObjectMeta) SetUserMeta(v string)        { C.Struct(s).SetObject(4, s.Segment.NewText(v)) }
+func (s ObjectMeta) ExpiresAt() int64            { return int64(C.Struct(s).Get64(24)) }
+func (s ObjectMeta) SetExpiresAt(v int64)        { C.Struct(s).Set64(24, uint64(v)) }
 func (s ObjectMeta) WriteJSON(w io.Writer) error {
 	b := bufio.NewWriter(w)
 	var err error
@@ -196,6 +198,25 @@ func (s ObjectMeta) WriteJSON(w io.Writer) error {
 			return err
 		}
 	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"expiresAt\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.ExpiresAt()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = b.WriteByte('}')
 	if err != nil {
 		return err
@@ -365,6 +386,25 @@ func (s ObjectMeta) WriteCapLit(w io.Writer) error {
 			return err
 		}
 	}
+	_, err = b.WriteString(", ")
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("expiresAt = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.ExpiresAt()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = b.WriteByte(')')
 	if err != nil {
 		return err
@@ -381,7 +421,7 @@ func (s ObjectMeta) MarshalCapLit() ([]byte, error) {
 type ObjectMeta_List C.PointerList
 
 func NewObjectMetaList(s *C.Segment, sz int) ObjectMeta_List {
-	return ObjectMeta_List(s.NewCompositeList(24, 5, sz))
+	return ObjectMeta_List(s.NewCompositeList(32, 5, sz))
 }
 func (s ObjectMeta_List) Len() int            { return C.PointerList(s).Len() }
 func (s ObjectMeta_List) At(i int) ObjectMeta { return ObjectMeta(C.PointerList(s).At(i).ToStruct()) }
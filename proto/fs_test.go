@@ -18,6 +18,8 @@ func TestObjectMetaCapn(t *testing.T) {
 	seg := capn.NewBuffer(nil)
 	meta := AutoNewObjectMeta(seg)
 	meta.SetPath("/test/hello.txt")
+	meta.SetSize(5)
+	meta.SetExpiresAt(1524308969465054914)
 	buf := new(bytes.Buffer)
 	meta.Segment.WriteToPacked(buf)
 
@@ -25,4 +27,6 @@ func TestObjectMetaCapn(t *testing.T) {
 	require.NoError(err)
 	metaOut := ReadRootObjectMeta(segIn)
 	require.Equal("/test/hello.txt", metaOut.Path())
+	require.EqualValues(5, metaOut.Size())
+	require.EqualValues(1524308969465054914, metaOut.ExpiresAt())
 }
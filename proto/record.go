@@ -7,6 +7,7 @@ package proto
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	capn "github.com/glycerine/go-capnproto"
 	"github.com/oklog/ulid"
@@ -15,10 +16,22 @@ import (
 )
 
 func (r *Record) AnnounceEnvelope() (*EnvelopeRecordUpdate, error) {
-	seg, err := capn.ReadFromPackedStream(bytes.NewReader(r.Current().Announce().Envelope()), nil)
+	ann := r.Current().Announce()
+	seg, err := capn.ReadFromPackedStream(bytes.NewReader(ann.Envelope()), nil)
 	if err != nil {
 		return nil, err
 	}
+	if ann.Type() == ANNOUNCETYPE_RECORDBATCH {
+		// the record has been updated within a batch, find its own update
+		batch := ReadRootEnvelopeRecordBatch(seg)
+		updates := batch.Updates()
+		for i := 0; i < updates.Len(); i++ {
+			if vv := updates.At(i); vv.Id() == r.Id() {
+				return &vv, nil
+			}
+		}
+		return nil, fmt.Errorf("record %s not found in batch %s", r.Id(), batch.Id())
+	}
 	vv := ReadRootEnvelopeRecordUpdate(seg)
 	return &vv, nil
 }
@@ -32,7 +45,7 @@ func (e *EnvelopeRecordUpdate) Compare(e2 *EnvelopeRecordUpdate) int {
 		return 1
 	}
 	id, err := ulid.Parse(e.Id())
-	id2, err2 := ulid.Parse(e.Id())
+	id2, err2 := ulid.Parse(e2.Id())
 	if err != nil && err2 != nil {
 		return 0
 	} else if err != nil && err2 == nil {
@@ -43,6 +56,22 @@ func (e *EnvelopeRecordUpdate) Compare(e2 *EnvelopeRecordUpdate) int {
 	return id.Compare(id2)
 }
 
+// CompareRecordVersions orders concurrent versions of a record deterministically: by the signed time
+// of the announce envelope, then by the announcing node ID, and then by the version itself. The announce
+// timestamp isn't signed, so it's used only for updates of older nodes, see AnnounceSignedAt.
+func CompareRecordVersions(a, b RecordVersion) int {
+	ann, ann2 := a.Announce(), b.Announce()
+	if ts, ts2 := AnnounceSignedAt(ann.Type(), ann), AnnounceSignedAt(ann2.Type(), ann2); ts < ts2 {
+		return -1
+	} else if ts > ts2 {
+		return 1
+	}
+	if cmp := strings.Compare(ann.NodeID(), ann2.NodeID()); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(a.Version(), b.Version())
+}
+
 type RecordPeekFunc func(key *state.Key, v *Record) error
 
 func RecordPeek(fn RecordPeekFunc) state.PeekFunc {
@@ -0,0 +1,93 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package proto
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordBatchAnnounceEnvelope(t *testing.T) {
+	require := require.New(t)
+
+	batch := AutoNewEnvelopeRecordBatch(capn.NewBuffer(nil))
+	batch.SetId(NewID())
+	updates := NewEnvelopeRecordUpdateList(batch.Segment, 2)
+	ids := []string{NewID(), NewID()}
+	for i, id := range ids {
+		updates.At(i).SetId(id)
+		updates.At(i).SetVersion("ver-" + id)
+	}
+	batch.SetUpdates(updates)
+	buf := new(bytes.Buffer)
+	_, err := batch.Segment.WriteToPacked(buf)
+	require.NoError(err)
+
+	ann := AutoNewAnnounce(capn.NewBuffer(nil))
+	ann.SetType(ANNOUNCETYPE_RECORDBATCH)
+	ann.SetEnvelope(buf.Bytes())
+	ver := AutoNewRecordVersion(capn.NewBuffer(nil))
+	ver.SetAnnounce(ann)
+	rec := AutoNewRecord(capn.NewBuffer(nil))
+	rec.SetCurrent(ver)
+
+	rec.SetId(ids[1])
+	upd, err := rec.AnnounceEnvelope()
+	require.NoError(err)
+	require.Equal("ver-"+ids[1], upd.Version())
+
+	rec.SetId(NewID())
+	_, err = rec.AnnounceEnvelope()
+	require.Error(err)
+}
+
+func TestCompareRecordVersions(t *testing.T) {
+	require := require.New(t)
+
+	newVersion := func(version, nodeID string, signedAt int64) RecordVersion {
+		e := AutoNewEnvelopeRecordUpdate(capn.NewBuffer(nil))
+		e.SetVersion(version)
+		e.SetSignedAt(signedAt)
+		buf := new(bytes.Buffer)
+		_, err := e.Segment.WriteToPacked(buf)
+		require.NoError(err)
+		ann := AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetType(ANNOUNCETYPE_RECORDUPDATE)
+		ann.SetEnvelope(buf.Bytes())
+		ann.SetNodeID(nodeID)
+		ann.SetTimestamp(signedAt)
+		ver := AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetAnnounce(ann)
+		ver.SetVersion(version)
+		return ver
+	}
+	require.Equal(1, CompareRecordVersions(newVersion("a", "node-a", 2), newVersion("b", "node-b", 1)))
+	require.Equal(-1, CompareRecordVersions(newVersion("a", "node-a", 1), newVersion("b", "node-b", 1)))
+	require.Equal(1, CompareRecordVersions(newVersion("b", "node-a", 1), newVersion("a", "node-a", 1)))
+	require.Equal(0, CompareRecordVersions(newVersion("a", "node-a", 1), newVersion("a", "node-a", 1)))
+
+	// a relay rewriting the unsigned timestamp doesn't change the winner
+	rewritten := newVersion("b", "node-b", 1)
+	rewritten.Announce().SetTimestamp(100)
+	require.Equal(1, CompareRecordVersions(newVersion("a", "node-a", 2), rewritten))
+
+	// versions of older nodes without a signed time are ordered by the announce timestamp
+	legacy := newVersion("c", "node-c", 0)
+	legacy.Announce().SetTimestamp(3)
+	require.Equal(1, CompareRecordVersions(legacy, newVersion("a", "node-a", 2)))
+	require.Equal(-1, CompareRecordVersions(legacy, newVersion("a", "node-a", 4)))
+
+	e, e2 := AutoNewEnvelopeRecordUpdate(capn.NewBuffer(nil)), AutoNewEnvelopeRecordUpdate(capn.NewBuffer(nil))
+	e.SetId(NewID())
+	// IDs of the same millisecond aren't ordered
+	time.Sleep(2 * time.Millisecond)
+	e2.SetId(NewID())
+	require.Equal(-1, e.Compare(&e2))
+	require.Equal(1, e2.Compare(&e))
+}
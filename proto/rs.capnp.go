@@ -721,6 +721,8 @@ const (
 	ANNOUNCETYPE_BEATTICK     AnnounceType = 1
 	ANNOUNCETYPE_BEATINFO     AnnounceType = 2
 	ANNOUNCETYPE_RECORDUPDATE AnnounceType = 3
+	ANNOUNCETYPE_RECORDBATCH  AnnounceType = 4
+	ANNOUNCETYPE_RECORDHEADS  AnnounceType = 5
 )
 
 func (c AnnounceType) String() string {
@@ -733,6 +735,10 @@ func (c AnnounceType) String() string {
 		return "beatInfo"
 	case ANNOUNCETYPE_RECORDUPDATE:
 		return "recordUpdate"
+	case ANNOUNCETYPE_RECORDBATCH:
+		return "recordBatch"
+	case ANNOUNCETYPE_RECORDHEADS:
+		return "recordHeads"
 	default:
 		return ""
 	}
@@ -748,6 +754,10 @@ func AnnounceTypeFromString(c string) AnnounceType {
 		return ANNOUNCETYPE_BEATINFO
 	case "recordUpdate":
 		return ANNOUNCETYPE_RECORDUPDATE
+	case "recordBatch":
+		return ANNOUNCETYPE_RECORDBATCH
+	case "recordHeads":
+		return ANNOUNCETYPE_RECORDHEADS
 	default:
 		return 0
 	}
@@ -1274,13 +1284,13 @@ func (s EnvelopeBeatInfo_List) Set(i int, item EnvelopeBeatInfo) {
 type EnvelopeRecordUpdate C.Struct
 
 func NewEnvelopeRecordUpdate(s *C.Segment) EnvelopeRecordUpdate {
-	return EnvelopeRecordUpdate(s.NewStruct(0, 3))
+	return EnvelopeRecordUpdate(s.NewStruct(16, 3))
 }
 func NewRootEnvelopeRecordUpdate(s *C.Segment) EnvelopeRecordUpdate {
-	return EnvelopeRecordUpdate(s.NewRootStruct(0, 3))
+	return EnvelopeRecordUpdate(s.NewRootStruct(16, 3))
 }
 func AutoNewEnvelopeRecordUpdate(s *C.Segment) EnvelopeRecordUpdate {
-	return EnvelopeRecordUpdate(s.NewStructAR(0, 3))
+	return EnvelopeRecordUpdate(s.NewStructAR(16, 3))
 }
 func ReadRootEnvelopeRecordUpdate(s *C.Segment) EnvelopeRecordUpdate {
 	return EnvelopeRecordUpdate(s.Root(0).ToStruct())
@@ -1298,6 +1308,10 @@ func (s EnvelopeRecordUpdate) VersionPrevBytes() []byte {
 	return C.Struct(s).GetObject(2).ToDataTrimLastByte()
 }
 func (s EnvelopeRecordUpdate) SetVersionPrev(v string) { C.Struct(s).SetObject(2, s.Segment.NewText(v)) }
+func (s EnvelopeRecordUpdate) ExpiresAt() int64       { return int64(C.Struct(s).Get64(0)) }
+func (s EnvelopeRecordUpdate) SetExpiresAt(v int64)   { C.Struct(s).Set64(0, uint64(v)) }
+func (s EnvelopeRecordUpdate) SignedAt() int64        { return int64(C.Struct(s).Get64(8)) }
+func (s EnvelopeRecordUpdate) SetSignedAt(v int64)    { C.Struct(s).Set64(8, uint64(v)) }
 func (s EnvelopeRecordUpdate) WriteJSON(w io.Writer) error {
 	b := bufio.NewWriter(w)
 	var err error
@@ -1360,6 +1374,44 @@ func (s EnvelopeRecordUpdate) WriteJSON(w io.Writer) error {
 			return err
 		}
 	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"expiresAt\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.ExpiresAt()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"signedAt\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.SignedAt()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = b.WriteByte('}')
 	if err != nil {
 		return err
@@ -1434,6 +1486,44 @@ func (s EnvelopeRecordUpdate) WriteCapLit(w io.Writer) error {
 			return err
 		}
 	}
+	_, err = b.WriteString(", ")
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("expiresAt = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.ExpiresAt()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = b.WriteString(", ")
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("signedAt = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.SignedAt()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
 	err = b.WriteByte(')')
 	if err != nil {
 		return err
@@ -1450,7 +1540,7 @@ func (s EnvelopeRecordUpdate) MarshalCapLit() ([]byte, error) {
 type EnvelopeRecordUpdate_List C.PointerList
 
 func NewEnvelopeRecordUpdateList(s *C.Segment, sz int) EnvelopeRecordUpdate_List {
-	return EnvelopeRecordUpdate_List(s.NewCompositeList(0, 3, sz))
+	return EnvelopeRecordUpdate_List(s.NewCompositeList(16, 3, sz))
 }
 func (s EnvelopeRecordUpdate_List) Len() int { return C.PointerList(s).Len() }
 func (s EnvelopeRecordUpdate_List) At(i int) EnvelopeRecordUpdate {
@@ -1467,3 +1557,369 @@ func (s EnvelopeRecordUpdate_List) ToArray() []EnvelopeRecordUpdate {
 func (s EnvelopeRecordUpdate_List) Set(i int, item EnvelopeRecordUpdate) {
 	C.PointerList(s).Set(i, C.Object(item))
 }
+
+type EnvelopeRecordBatch C.Struct
+
+func NewEnvelopeRecordBatch(s *C.Segment) EnvelopeRecordBatch {
+	return EnvelopeRecordBatch(s.NewStruct(0, 2))
+}
+func NewRootEnvelopeRecordBatch(s *C.Segment) EnvelopeRecordBatch {
+	return EnvelopeRecordBatch(s.NewRootStruct(0, 2))
+}
+func AutoNewEnvelopeRecordBatch(s *C.Segment) EnvelopeRecordBatch {
+	return EnvelopeRecordBatch(s.NewStructAR(0, 2))
+}
+func ReadRootEnvelopeRecordBatch(s *C.Segment) EnvelopeRecordBatch {
+	return EnvelopeRecordBatch(s.Root(0).ToStruct())
+}
+func (s EnvelopeRecordBatch) Id() string      { return C.Struct(s).GetObject(0).ToText() }
+func (s EnvelopeRecordBatch) IdBytes() []byte { return C.Struct(s).GetObject(0).ToDataTrimLastByte() }
+func (s EnvelopeRecordBatch) SetId(v string)  { C.Struct(s).SetObject(0, s.Segment.NewText(v)) }
+func (s EnvelopeRecordBatch) Updates() EnvelopeRecordUpdate_List {
+	return EnvelopeRecordUpdate_List(C.Struct(s).GetObject(1))
+}
+func (s EnvelopeRecordBatch) SetUpdates(v EnvelopeRecordUpdate_List) {
+	C.Struct(s).SetObject(1, C.Object(v))
+}
+func (s EnvelopeRecordBatch) WriteJSON(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	var err error
+	var buf []byte
+	_ = buf
+	err = b.WriteByte('{')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"id\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Id()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"updates\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Updates()
+		{
+			err = b.WriteByte('[')
+			if err != nil {
+				return err
+			}
+			for i, s := range s.ToArray() {
+				if i != 0 {
+					_, err = b.WriteString(", ")
+				}
+				if err != nil {
+					return err
+				}
+				err = s.WriteJSON(b)
+				if err != nil {
+					return err
+				}
+			}
+			err = b.WriteByte(']')
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte('}')
+	if err != nil {
+		return err
+	}
+	err = b.Flush()
+	return err
+}
+func (s EnvelopeRecordBatch) MarshalJSON() ([]byte, error) {
+	b := bytes.Buffer{}
+	err := s.WriteJSON(&b)
+	return b.Bytes(), err
+}
+func (s EnvelopeRecordBatch) WriteCapLit(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	var err error
+	var buf []byte
+	_ = buf
+	err = b.WriteByte('(')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("id = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Id()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = b.WriteString(", ")
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("updates = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Updates()
+		{
+			err = b.WriteByte('[')
+			if err != nil {
+				return err
+			}
+			for i, s := range s.ToArray() {
+				if i != 0 {
+					_, err = b.WriteString(", ")
+				}
+				if err != nil {
+					return err
+				}
+				err = s.WriteCapLit(b)
+				if err != nil {
+					return err
+				}
+			}
+			err = b.WriteByte(']')
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(')')
+	if err != nil {
+		return err
+	}
+	err = b.Flush()
+	return err
+}
+func (s EnvelopeRecordBatch) MarshalCapLit() ([]byte, error) {
+	b := bytes.Buffer{}
+	err := s.WriteCapLit(&b)
+	return b.Bytes(), err
+}
+
+type EnvelopeRecordBatch_List C.PointerList
+
+func NewEnvelopeRecordBatchList(s *C.Segment, sz int) EnvelopeRecordBatch_List {
+	return EnvelopeRecordBatch_List(s.NewCompositeList(0, 2, sz))
+}
+func (s EnvelopeRecordBatch_List) Len() int { return C.PointerList(s).Len() }
+func (s EnvelopeRecordBatch_List) At(i int) EnvelopeRecordBatch {
+	return EnvelopeRecordBatch(C.PointerList(s).At(i).ToStruct())
+}
+func (s EnvelopeRecordBatch_List) ToArray() []EnvelopeRecordBatch {
+	n := s.Len()
+	a := make([]EnvelopeRecordBatch, n)
+	for i := 0; i < n; i++ {
+		a[i] = s.At(i)
+	}
+	return a
+}
+func (s EnvelopeRecordBatch_List) Set(i int, item EnvelopeRecordBatch) {
+	C.PointerList(s).Set(i, C.Object(item))
+}
+
+type EnvelopeRecordHeads C.Struct
+
+func NewEnvelopeRecordHeads(s *C.Segment) EnvelopeRecordHeads {
+	return EnvelopeRecordHeads(s.NewStruct(0, 2))
+}
+func NewRootEnvelopeRecordHeads(s *C.Segment) EnvelopeRecordHeads {
+	return EnvelopeRecordHeads(s.NewRootStruct(0, 2))
+}
+func AutoNewEnvelopeRecordHeads(s *C.Segment) EnvelopeRecordHeads {
+	return EnvelopeRecordHeads(s.NewStructAR(0, 2))
+}
+func ReadRootEnvelopeRecordHeads(s *C.Segment) EnvelopeRecordHeads {
+	return EnvelopeRecordHeads(s.Root(0).ToStruct())
+}
+func (s EnvelopeRecordHeads) Id() string      { return C.Struct(s).GetObject(0).ToText() }
+func (s EnvelopeRecordHeads) IdBytes() []byte { return C.Struct(s).GetObject(0).ToDataTrimLastByte() }
+func (s EnvelopeRecordHeads) SetId(v string)  { C.Struct(s).SetObject(0, s.Segment.NewText(v)) }
+func (s EnvelopeRecordHeads) Announces() Announce_List {
+	return Announce_List(C.Struct(s).GetObject(1))
+}
+func (s EnvelopeRecordHeads) SetAnnounces(v Announce_List) {
+	C.Struct(s).SetObject(1, C.Object(v))
+}
+func (s EnvelopeRecordHeads) WriteJSON(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	var err error
+	var buf []byte
+	_ = buf
+	err = b.WriteByte('{')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"id\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Id()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(',')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("\"announces\":")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Announces()
+		{
+			err = b.WriteByte('[')
+			if err != nil {
+				return err
+			}
+			for i, s := range s.ToArray() {
+				if i != 0 {
+					_, err = b.WriteString(", ")
+				}
+				if err != nil {
+					return err
+				}
+				err = s.WriteJSON(b)
+				if err != nil {
+					return err
+				}
+			}
+			err = b.WriteByte(']')
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte('}')
+	if err != nil {
+		return err
+	}
+	err = b.Flush()
+	return err
+}
+func (s EnvelopeRecordHeads) MarshalJSON() ([]byte, error) {
+	b := bytes.Buffer{}
+	err := s.WriteJSON(&b)
+	return b.Bytes(), err
+}
+func (s EnvelopeRecordHeads) WriteCapLit(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	var err error
+	var buf []byte
+	_ = buf
+	err = b.WriteByte('(')
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("id = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Id()
+		buf, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		_, err = b.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = b.WriteString(", ")
+	if err != nil {
+		return err
+	}
+	_, err = b.WriteString("announces = ")
+	if err != nil {
+		return err
+	}
+	{
+		s := s.Announces()
+		{
+			err = b.WriteByte('[')
+			if err != nil {
+				return err
+			}
+			for i, s := range s.ToArray() {
+				if i != 0 {
+					_, err = b.WriteString(", ")
+				}
+				if err != nil {
+					return err
+				}
+				err = s.WriteCapLit(b)
+				if err != nil {
+					return err
+				}
+			}
+			err = b.WriteByte(']')
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = b.WriteByte(')')
+	if err != nil {
+		return err
+	}
+	err = b.Flush()
+	return err
+}
+func (s EnvelopeRecordHeads) MarshalCapLit() ([]byte, error) {
+	b := bytes.Buffer{}
+	err := s.WriteCapLit(&b)
+	return b.Bytes(), err
+}
+
+type EnvelopeRecordHeads_List C.PointerList
+
+func NewEnvelopeRecordHeadsList(s *C.Segment, sz int) EnvelopeRecordHeads_List {
+	return EnvelopeRecordHeads_List(s.NewCompositeList(0, 2, sz))
+}
+func (s EnvelopeRecordHeads_List) Len() int { return C.PointerList(s).Len() }
+func (s EnvelopeRecordHeads_List) At(i int) EnvelopeRecordHeads {
+	return EnvelopeRecordHeads(C.PointerList(s).At(i).ToStruct())
+}
+func (s EnvelopeRecordHeads_List) ToArray() []EnvelopeRecordHeads {
+	n := s.Len()
+	a := make([]EnvelopeRecordHeads, n)
+	for i := 0; i < n; i++ {
+		a[i] = s.At(i)
+	}
+	return a
+}
+func (s EnvelopeRecordHeads_List) Set(i int, item EnvelopeRecordHeads) {
+	C.PointerList(s).Set(i, C.Object(item))
+}
@@ -0,0 +1,402 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/logging"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// BatchOp describes a single record change within an atomic batch.
+type BatchOp struct {
+	Path     string
+	Body     io.ReadCloser
+	Size     int64
+	UserMeta []byte
+	// Delete marks the record as deleted, Body is ignored.
+	Delete bool
+	// IfVersion is the expected current version of the record, see UpdateOptions.
+	IfVersion string
+	// ExpiresAt is the expiry time of the new version, see CreateOptions.
+	ExpiresAt int64
+}
+
+var (
+	// ErrEmptyBatch to be thrown when batch contains no operations
+	ErrEmptyBatch = errors.New("batch is empty")
+	// ErrBatchDuplicatePath to be thrown when batch contains multiple operations on the same record
+	ErrBatchDuplicatePath = errors.New("batch contains duplicate paths")
+)
+
+// batchEntry is a planned change of a single record within a batch.
+type batchEntry struct {
+	id          string
+	path        string
+	versionPrev string
+	deleted     bool
+	expiresAt   int64
+	ref         *fs.ObjectRef
+	record      *proto.Record
+}
+
+// BatchApply puts all objects of the batch, then applies all record changes within a single state transaction
+// and emits one announce that carries every record update. If any operation fails, no records are changed.
+func (r *recordStore) BatchApply(ctx context.Context, ops []BatchOp) ([]*Record, error) {
+	if !isPublishAllowed(r.nodeID) {
+		return nil, ErrNotAuthorized
+	} else if len(ops) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	defer r.inboundWork()
+
+	entries := make([]*batchEntry, 0, len(ops))
+	// new records get a fresh ID each, so duplicates are found by the resolved path
+	seen := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		e, err := r.planBatchOp(ctx, op)
+		if err != nil {
+			return nil, err
+		} else if seen[e.path] {
+			return nil, ErrBatchDuplicatePath
+		}
+		seen[e.path] = true
+		e.deleted = op.Delete
+		if !op.Delete {
+			e.expiresAt = op.ExpiresAt
+		}
+		entries = append(entries, e)
+	}
+	unpinAll := func() {
+		for _, e := range entries {
+			if e.ref == nil {
+				continue
+			}
+			if err := r.fs.UnpinObject(fs.ObjectRef{
+				Version: e.ref.Version,
+			}); err != nil {
+				log.Debugln("failed to unpin after batch failure:", e.ref.Version, err)
+			}
+		}
+	}
+	for i, op := range ops {
+		e := entries[i]
+		var ref *fs.ObjectRef
+		var err error
+		if op.Delete {
+			ref, err = r.fs.DeleteObject(ctx, fs.ObjectRef{
+				ID:              e.id,
+				Path:            e.path,
+				VersionPrevious: e.versionPrev,
+			})
+		} else {
+			ref, err = r.fs.PutObject(ctx, fs.ObjectRef{
+				ID:              e.id,
+				Path:            e.path,
+				VersionPrevious: e.versionPrev,
+				Size:            op.Size,
+				ExpiresAt:       op.ExpiresAt,
+			}, op.UserMeta, op.Body)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"id":   e.id,
+				"path": e.path,
+			}).Errorf("IPFS error of PutObject (BatchApply): %v", err)
+			unpinAll()
+			return nil, err
+		}
+		e.ref = ref
+	}
+
+	ann := r.newRecordBatchAnnounce(entries)
+	keys := make([]*state.Key, 0, 2*len(entries))
+	byKey := make(map[string]*batchEntry, 2*len(entries))
+	for _, e := range entries {
+		k := state.NewKey(state.BucketRecords, []byte(e.id))
+		keys = append(keys, k)
+		byKey[string(k.Bytes())] = e
+	}
+	for _, e := range entries {
+		k := pathIndexKey(e.path)
+		keys = append(keys, k)
+		byKey[string(k.Bytes())] = e
+	}
+	err := r.ss.UpdateBatch(keys, func(k *state.Key, v []byte) ([]byte, error) {
+		e, ok := byKey[string(k.Bytes())]
+		if !ok {
+			return nil, state.ErrNoUpdate
+		}
+		if k.Bucket.ID == state.BucketPathIndex {
+			return pathIndexValue(e.id, e.path), nil
+		}
+		return proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+			if v == nil && len(e.versionPrev) > 0 {
+				return nil, ErrRecordNotFound
+			} else if v != nil && v.Current().Version() != e.versionPrev {
+				// the record has been changed since the batch has been planned
+				return nil, ErrVersionConflict
+			}
+			v = withRecordVersion(v, e.id, e.path, *ann, e.ref.Version)
+			e.record = v
+			return v, nil
+		})(k, v)
+	})
+	if err != nil {
+		log.Errorf("failed to apply batch: %v", err)
+		unpinAll()
+		return nil, err
+	}
+	r.EmitEventAnnounce(&EventAnnounce{
+		Type:     EventRecordBatch,
+		Announce: *ann,
+	})
+	records := make([]*Record, 0, len(entries))
+	for _, e := range entries {
+		switch {
+		case e.deleted:
+			r.recordChanged(ChangeDeleted, e.record)
+		case len(e.versionPrev) == 0:
+			r.recordChanged(ChangeCreated, e.record)
+		default:
+			r.recordChanged(ChangeUpdated, e.record)
+		}
+		records = append(records, &Record{
+			Record: *e.record,
+			Object: *e.ref,
+		})
+	}
+	return records, nil
+}
+
+// planBatchOp resolves the record of a batch operation and checks its preconditions.
+func (r *recordStore) planBatchOp(ctx context.Context, op BatchOp) (*batchEntry, error) {
+	if len(op.Path) == 0 {
+		return nil, ErrRecordNotFound
+	}
+	id, err := r.findRecordID(ctx, op.Path, "")
+	if err == ErrRecordNotFound {
+		if op.Delete || len(op.IfVersion) > 0 {
+			return nil, ErrRecordNotFound
+		}
+		return &batchEntry{
+			id:   proto.NewID(),
+			path: op.Path,
+		}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	e := &batchEntry{
+		id: id,
+	}
+	if err := r.ss.View(state.NewKey(state.BucketRecords, []byte(id)),
+		proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+			if v == nil {
+				return ErrRecordNotFound
+			}
+			e.path = v.Path()
+			e.versionPrev = v.Current().Version()
+			return nil
+		})); err == state.ErrNotFound {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if len(op.IfVersion) > 0 && e.versionPrev != op.IfVersion {
+		return nil, ErrVersionConflict
+	}
+	return e, nil
+}
+
+// withRecordVersion makes version the current one of the record, creating the record if v is nil.
+func withRecordVersion(v *proto.Record, id, path string, ann proto.Announce, version string) *proto.Record {
+	if v == nil {
+		vv := proto.AutoNewRecord(capn.NewBuffer(nil))
+		v = &vv
+		v.SetId(id)
+		v.SetPath(path)
+		v.SetCreatedAt(ann.Timestamp())
+	} else {
+		v.SetPrevious(proto.AppendRecordVersion(v.Previous(), v.Current()))
+	}
+	ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+	ver.SetAnnounce(ann)
+	ver.SetVersion(version)
+	v.SetCurrent(ver)
+	return v
+}
+
+func (r *recordStore) newRecordBatchAnnounce(entries []*batchEntry) *proto.Announce {
+	now := time.Now().UnixNano()
+	e := proto.AutoNewEnvelopeRecordBatch(capn.NewBuffer(nil))
+	e.SetId(proto.NewID())
+	updates := proto.NewEnvelopeRecordUpdateList(e.Segment, len(entries))
+	for i, entry := range entries {
+		upd := updates.At(i)
+		upd.SetId(entry.id)
+		upd.SetVersion(entry.ref.Version)
+		upd.SetVersionPrev(entry.versionPrev)
+		upd.SetExpiresAt(entry.expiresAt)
+		upd.SetSignedAt(now)
+	}
+	e.SetUpdates(updates)
+	buf := new(bytes.Buffer)
+	if _, err := e.Segment.WriteToPacked(buf); err != nil {
+		panic(fmt.Sprintf("failed to pack data: %v", err))
+	}
+	sig, err := r.fs.SignData(r.nodeID, buf.Bytes())
+	if err != nil {
+		panic(fmt.Sprintf("failed to use FS signer: %v", err))
+	}
+	a := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	a.SetId(proto.NewID())
+	a.SetType(proto.ANNOUNCETYPE_RECORDBATCH)
+	a.SetEnvelope(buf.Bytes())
+	a.SetSignature(hex.EncodeToString(sig))
+	a.SetTimestamp(now)
+	a.SetNodeID(r.nodeID)
+	return &a
+}
+
+// handleRecordBatch applies an announced batch of record updates, all-or-nothing. Batches that reference
+// objects unavailable on IPFS are skipped entirely with errContentUnavailable.
+func (r *recordStore) handleRecordBatch(ev *EventAnnounce, fields log.Fields, timeout time.Duration) error {
+	batch, err := proto.UnpackEnvelopeRecordBatch(ev.Announce.Envelope())
+	if err != nil {
+		log.WithFields(fields).Errorf("failed to unpack record batch: %v", err)
+		r.announces.countRejected(ev.Type, RejectMalformed)
+		return nil
+	}
+	batchFields := logging.WithMore(fields, log.Fields{
+		"Batch": batch.Id(),
+	})
+	updates := batch.Updates().ToArray()
+	if len(updates) == 0 {
+		log.WithFields(batchFields).Warningln("skipping empty record batch")
+		return nil
+	}
+	known := 0
+	for _, update := range updates {
+		if r.isKnownVersion(update.Id(), update.Version()) {
+			known++
+		}
+	}
+	if known == len(updates) {
+		log.WithFields(batchFields).Debugln("skipping already applied record batch")
+		return nil
+	}
+	refs := make(map[string]*fs.ObjectRef, len(updates))
+	keys := make([]*state.Key, 0, 2*len(updates))
+	byKey := make(map[string]*fs.ObjectRef, 2*len(updates))
+	type applied struct {
+		record  *proto.Record
+		created bool
+	}
+	changed := make(map[string]applied, len(updates))
+	versionPrevs := make(map[string]string, len(updates))
+	baseForked := make(map[string]bool, len(updates))
+	forks := make(map[string]*ForkedVersion)
+	var rejected []string
+	for _, update := range updates {
+		ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+		ref, err := r.fs.HeadObject(ctx, fs.ObjectRef{
+			Version: update.Version(),
+		})
+		cancelFn()
+		if err == fs.ErrNotFound {
+			log.WithFields(batchFields).Debugln("file not found on IPFS but announced in batch:", update.Version())
+			return errContentUnavailable
+		} else if err != nil {
+			log.WithFields(batchFields).Debugf("failed to retrieve object: %v", err)
+			return errContentUnavailable
+		} else if ref.ID != update.Id() {
+			log.WithFields(batchFields).Warningf("batch update ID mismatch: %s != %s", ref.ID, update.Id())
+			return nil
+		} else if _, ok := refs[ref.ID]; ok {
+			log.WithFields(batchFields).Warningln("skipping batch with duplicate records")
+			return nil
+		}
+		refs[ref.ID] = ref
+		versionPrevs[ref.ID] = update.VersionPrev()
+		baseForked[ref.ID] = r.isForkedVersion(ref.ID, update.VersionPrev())
+		k := state.NewKey(state.BucketRecords, []byte(ref.ID))
+		keys = append(keys, k)
+		byKey[string(k.Bytes())] = ref
+		if len(ref.Path) > 0 {
+			k := pathIndexKey(ref.Path)
+			keys = append(keys, k)
+			byKey[string(k.Bytes())] = ref
+		}
+	}
+	if err := r.ss.UpdateBatch(keys, func(k *state.Key, v []byte) ([]byte, error) {
+		ref, ok := byKey[string(k.Bytes())]
+		if !ok {
+			return nil, state.ErrNoUpdate
+		}
+		if k.Bucket.ID == state.BucketPathIndex {
+			return pathIndexValue(ref.ID, ref.Path), nil
+		}
+		return proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+			if hasRecordVersion(v, ref.Version) {
+				// already applied, possibly superseded by a newer version
+				return nil, state.ErrNoUpdate
+			}
+			res, fork := resolveUpdate(v, newRecordVersion(ev.Announce, ref.Version), versionPrevs[ref.ID], baseForked[ref.ID])
+			if fork != nil {
+				forks[ref.ID] = fork
+			}
+			if res == updateReject {
+				// the batch is all-or-nothing
+				rejected = append(rejected, ref.ID)
+				return nil, ErrVersionConflict
+			} else if res == updateRebase {
+				v = rewindRecord(v, versionPrevs[ref.ID])
+			}
+			created := v == nil
+			v = withRecordVersion(v, ref.ID, ref.Path, ev.Announce, ref.Version)
+			changed[ref.ID] = applied{
+				record:  v,
+				created: created,
+			}
+			return v, nil
+		})(k, v)
+	}); err == ErrVersionConflict {
+		for _, id := range rejected {
+			if fork, ok := forks[id]; ok {
+				r.addConflict(id, refs[id].Path, fork)
+			}
+		}
+		log.WithFields(batchFields).Warningln("skipping record batch not based on the current versions")
+		r.announces.countRejected(ev.Type, RejectVersionMismatch)
+		return nil
+	} else if err != nil {
+		log.WithFields(batchFields).Warningf("failed to apply record batch: %v", err)
+		return nil
+	}
+	for id, fork := range forks {
+		r.addConflict(id, refs[id].Path, fork)
+	}
+	for id, c := range changed {
+		r.recordChanged(changeTypeOf(c.created, refs[id]), c.record)
+	}
+	for _, ref := range refs {
+		if err := r.fs.PinNewest(*ref, r.retention.PinDepth(ref.Path)); err != nil {
+			log.WithFields(batchFields).Errorf("failed to pin object: %v", err)
+		}
+	}
+	return nil
+}
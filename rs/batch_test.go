@@ -0,0 +1,42 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestBatchDuplicatePaths(t *testing.T) {
+	require := require.New(t)
+
+	defaultAuth := authcenter.Default
+	authcenter.Default = testAuth{}
+	defer func() {
+		authcenter.Default = defaultAuth
+	}()
+	r := newTestStore(t)
+
+	id, path := proto.NewID(), "/existing"
+	putTestRecord(t, r, newTestRecord(id, path, nil))
+	require.NoError(indexRecordPath(r.ss, id, path))
+
+	for _, ops := range [][]BatchOp{
+		{{Path: "/new"}, {Path: "/new"}},
+		{{Path: path}, {Path: path, Delete: true}},
+		// the record addressed by its ID
+		{{Path: path}, {Path: id}},
+	} {
+		_, err := r.BatchApply(context.Background(), ops)
+		require.Equal(ErrBatchDuplicatePath, err)
+	}
+	_, err := lookupPathIndex(r.ss, "/new")
+	require.Equal(ErrRecordNotFound, err)
+}
@@ -0,0 +1,242 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// ChangeType describes what happened to the record
+type ChangeType string
+
+const (
+	// ChangeCreated - a new record has been created
+	ChangeCreated ChangeType = "created"
+	// ChangeUpdated - a new version of record has been written
+	ChangeUpdated ChangeType = "updated"
+	// ChangeDeleted - record has been marked as deleted
+	ChangeDeleted ChangeType = "deleted"
+)
+
+// RecordChange is an entry of the record change feed. Its ID is a ULID that can be
+// used as a cursor to resume watching.
+type RecordChange struct {
+	ID          string     `json:"id"`
+	Type        ChangeType `json:"type"`
+	RecordID    string     `json:"recordId"`
+	Path        string     `json:"path"`
+	Version     string     `json:"version"`
+	VersionPrev string     `json:"versionPrevious,omitempty"`
+	Timestamp   int64      `json:"timestamp"`
+}
+
+// defaultChangeLogTTL is the period during which watchers can resume from a cursor.
+var defaultChangeLogTTL = 7 * 24 * time.Hour
+
+// changeHub fans out record changes to in-process watchers.
+type changeHub struct {
+	mux  sync.Mutex
+	subs map[chan *RecordChange]struct{}
+
+	// logMux orders change IDs, so the change log is written in the order of IDs
+	logMux  sync.Mutex
+	entropy io.Reader
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{
+		subs:    make(map[chan *RecordChange]struct{}),
+		entropy: ulid.Monotonic(rand.New(rand.NewSource(time.Now().UnixNano())), 0),
+	}
+}
+
+// nextID returns a monotonically increasing ULID, must be called with logMux held.
+func (h *changeHub) nextID() string {
+	return ulid.MustNew(ulid.Timestamp(time.Now()), h.entropy).String()
+}
+
+func (h *changeHub) subscribe() chan *RecordChange {
+	ch := make(chan *RecordChange, 1024)
+	h.mux.Lock()
+	h.subs[ch] = struct{}{}
+	h.mux.Unlock()
+	return ch
+}
+
+func (h *changeHub) unsubscribe(ch chan *RecordChange) {
+	h.mux.Lock()
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+	h.mux.Unlock()
+}
+
+// publish never blocks, a watcher that can't keep up is dropped and should resume from its cursor.
+func (h *changeHub) publish(change *RecordChange) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- change:
+		default:
+			log.Warningln("dropping slow record change watcher")
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// changeTypeOf detects the type of change by the previous record state and the new object.
+func changeTypeOf(created bool, ref *fs.ObjectRef) ChangeType {
+	if created {
+		return ChangeCreated
+	} else if ref != nil {
+		if meta := ref.Meta(); meta != nil && meta.IsDeleted() {
+			return ChangeDeleted
+		}
+	}
+	return ChangeUpdated
+}
+
+// recordChanged writes the change into the change log and notifies watchers,
+// it also indexes the expiry of the record version.
+func (r *recordStore) recordChanged(typ ChangeType, record *proto.Record) {
+	if record == nil {
+		return
+	}
+	if err := indexRecordExpiry(r.ss, record); err != nil {
+		log.Warningf("failed to index record expiry: %v", err)
+	}
+	r.changes.logMux.Lock()
+	defer r.changes.logMux.Unlock()
+	change := &RecordChange{
+		ID:        r.changes.nextID(),
+		Type:      typ,
+		RecordID:  record.Id(),
+		Path:      record.Path(),
+		Version:   record.Current().Version(),
+		Timestamp: time.Now().UnixNano(),
+	}
+	if prev := record.Previous(); prev.Len() > 0 {
+		change.VersionPrev = prev.At(prev.Len() - 1).Version()
+	}
+	k := state.NewKey(state.BucketChanges, []byte(change.ID))
+	k.TTL = defaultChangeLogTTL
+	if err := r.ss.Update(k, func(k *state.Key, v []byte) ([]byte, error) {
+		return json.Marshal(change)
+	}); err != nil {
+		log.Warningf("failed to write record change: %v", err)
+	}
+	r.changes.publish(change)
+}
+
+// WatchRecords streams changes of records with path matching the prefix. If cursor is set,
+// changes logged after the cursor are replayed first. The channel is closed when ctx is done
+// or the watcher falls behind, in that case it should resume from the last received ID.
+func (r *recordStore) WatchRecords(ctx context.Context, prefix, cursor string) (<-chan *RecordChange, error) {
+	live := r.changes.subscribe()
+	var replay []*RecordChange
+	if len(cursor) > 0 {
+		b := state.NewBucket(state.BucketChanges, &state.RangeOptions{
+			Prefetch: 100,
+		})
+		// change IDs are ULIDs, so the log is ranged in order
+		if _, err := r.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+			var change *RecordChange
+			if err := json.Unmarshal(v, &change); err != nil {
+				return nil
+			} else if change.ID <= cursor {
+				return nil
+			}
+			replay = append(replay, change)
+			return nil
+		}); err != nil {
+			r.changes.unsubscribe(live)
+			return nil, err
+		}
+	}
+	out := make(chan *RecordChange, 100)
+	go func() {
+		defer close(out)
+		defer r.changes.unsubscribe(live)
+
+		send := func(change *RecordChange) bool {
+			if !strings.HasPrefix(change.Path, prefix) {
+				return true
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case out <- change:
+				return true
+			}
+		}
+		replayed := make(map[string]struct{}, len(replay))
+		for _, change := range replay {
+			replayed[change.ID] = struct{}{}
+			if !send(change) {
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change, ok := <-live:
+				if !ok {
+					return
+				} else if _, ok := replayed[change.ID]; ok {
+					continue
+				} else if !send(change) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// changedSince returns IDs of records changed locally since the timestamp in Unix nanoseconds,
+// as found in the change log. It returns false if the change log doesn't reach back that far.
+func (r *recordStore) changedSince(since int64) (map[string]struct{}, bool, error) {
+	if time.Unix(0, since).Before(time.Now().Add(-defaultChangeLogTTL)) {
+		return nil, false, nil
+	}
+	var offset ulid.ULID
+	if err := offset.SetTime(uint64(since / int64(time.Millisecond))); err != nil {
+		return nil, false, err
+	}
+	b := state.NewBucket(state.BucketChanges, &state.RangeOptions{
+		Prefetch: 100,
+		Offset:   []byte(offset.String()),
+	})
+	ids := make(map[string]struct{})
+	if _, err := r.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+		var change *RecordChange
+		if err := json.Unmarshal(v, &change); err != nil {
+			return nil
+		} else if change.Timestamp >= since {
+			ids[change.RecordID] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		return nil, false, err
+	}
+	return ids, true, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestWatchRecords(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	newRecord := func(path string) *proto.Record {
+		return newTestRecord(proto.NewID(), path, nil, "v1")
+	}
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+	changes, err := r.WatchRecords(ctx, "/docs/", "")
+	require.NoError(err)
+	r.recordChanged(ChangeCreated, newRecord("/other/a.txt"))
+	r.recordChanged(ChangeCreated, newRecord("/docs/a.txt"))
+	first := <-changes
+	require.Equal("/docs/a.txt", first.Path)
+	require.Equal(ChangeCreated, first.Type)
+
+	r.recordChanged(ChangeUpdated, newRecord("/docs/b.txt"))
+	<-changes
+	cancelFn()
+
+	// resume after the first change
+	ctx, cancelFn = context.WithCancel(context.Background())
+	defer cancelFn()
+	changes, err = r.WatchRecords(ctx, "/docs/", first.ID)
+	require.NoError(err)
+	resumed := <-changes
+	require.Equal("/docs/b.txt", resumed.Path)
+	require.Equal(ChangeUpdated, resumed.Type)
+}
+
+func TestExportRecordsSince(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	ann.SetTimestamp(time.Now().Add(-time.Hour).UnixNano())
+	// both records have been announced an hour ago, but only the late one has been received recently
+	stale := newTestRecord(proto.NewID(), "/stale.txt", &ann, "v1")
+	putTestRecord(t, r, stale)
+	since := time.Now().Add(-time.Minute).UnixNano()
+	late := newTestRecord(proto.NewID(), "/late.txt", &ann, "v1")
+	putTestRecord(t, r, late)
+	r.recordChanged(ChangeCreated, late)
+
+	exported := func(since int64) []string {
+		buf := new(bytes.Buffer)
+		require.NoError(r.ExportRecords(context.Background(), buf, ExportOptions{
+			Since: since,
+		}))
+		var ids []string
+		for {
+			seg, err := capn.ReadFromStream(buf, nil)
+			if err == io.EOF {
+				return ids
+			}
+			require.NoError(err)
+			ids = append(ids, proto.ReadRootRecord(seg).Id())
+		}
+	}
+	require.Equal([]string{late.Id()}, exported(since))
+	// the change log doesn't reach back that far
+	require.ElementsMatch([]string{stale.Id(), late.Id()},
+		exported(time.Now().Add(-2*defaultChangeLogTTL).UnixNano()))
+}
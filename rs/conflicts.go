@@ -0,0 +1,253 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// ForkedVersion is the head of a record history branch that has lost the fork resolution.
+type ForkedVersion struct {
+	Version string `json:"version"`
+	// Base is the last version shared with the winning branch, empty if unknown.
+	Base      string `json:"base,omitempty"`
+	NodeID    string `json:"nodeId"`
+	Timestamp int64  `json:"timestamp"`
+
+	// branch lists versions of the losing branch, forks with these heads are replaced.
+	branch []string
+}
+
+// RecordConflict lists the losing branches of a record whose history has diverged.
+type RecordConflict struct {
+	ID        string           `json:"id"`
+	Path      string           `json:"path"`
+	Forks     []*ForkedVersion `json:"forks"`
+	UpdatedAt int64            `json:"updatedAt"`
+}
+
+func newForkedVersion(head proto.RecordVersion, base string, branch ...string) *ForkedVersion {
+	return &ForkedVersion{
+		Version:   head.Version(),
+		Base:      base,
+		NodeID:    head.Announce().NodeID(),
+		Timestamp: head.Announce().Timestamp(),
+		branch:    branch,
+	}
+}
+
+func newRecordVersion(ann proto.Announce, version string) proto.RecordVersion {
+	ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+	ver.SetAnnounce(ann)
+	ver.SetVersion(version)
+	return ver
+}
+
+// versionChain lists versions of the record from the oldest one to the current.
+func versionChain(v *proto.Record) []proto.RecordVersion {
+	return append(v.Previous().ToArray(), v.Current())
+}
+
+func versionIndex(chain []proto.RecordVersion, version string) int {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].Version() == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func chainVersions(chain []proto.RecordVersion) []string {
+	versions := make([]string, 0, len(chain))
+	for _, ver := range chain {
+		versions = append(versions, ver.Version())
+	}
+	return versions
+}
+
+// rewindRecord drops versions after the specified one, which becomes the current version.
+func rewindRecord(v *proto.Record, version string) *proto.Record {
+	chain := versionChain(v)
+	i := versionIndex(chain, version)
+	if i < 0 {
+		return v
+	}
+	prev := proto.NewRecordVersionList(capn.NewBuffer(nil), i)
+	for j := 0; j < i; j++ {
+		prev.Set(j, chain[j])
+	}
+	v.SetPrevious(prev)
+	v.SetCurrent(newRecordVersion(chain[i].Announce(), chain[i].Version()))
+	return v
+}
+
+// updateResolution tells how an announced version fits into the local record history.
+type updateResolution int
+
+const (
+	// updateApply puts the version on top of the current one.
+	updateApply updateResolution = iota
+	// updateRebase replaces the local versions after the fork point with the announced one.
+	updateRebase
+	// updateReject drops the version, its branch has lost.
+	updateReject
+)
+
+// resolveUpdate places the announced version into the record history. An update based on a version
+// other than the current one forks the history: the branch whose first version is ordered higher by
+// proto.CompareRecordVersions wins, so all nodes pick the same branch regardless of the order updates
+// arrive in. Descendants of a losing version are rejected as well, baseForked tells whether versionPrev
+// is the head of a known losing branch. It's looked up by isForkedVersion before the record update
+// is opened, so the update transaction touches the record key only. The losing branch head is
+// returned if a fork has been detected.
+func resolveUpdate(v *proto.Record, ver proto.RecordVersion, versionPrev string, baseForked bool) (updateResolution, *ForkedVersion) {
+	if v == nil || v.Current().Version() == versionPrev {
+		return updateApply, nil
+	}
+	chain := versionChain(v)
+	if i := versionIndex(chain, versionPrev); i >= 0 {
+		if proto.CompareRecordVersions(ver, chain[i+1]) > 0 {
+			return updateRebase, newForkedVersion(v.Current(), versionPrev, chainVersions(chain[i+1:])...)
+		}
+		return updateReject, newForkedVersion(ver, versionPrev)
+	} else if baseForked {
+		return updateReject, newForkedVersion(ver, "", versionPrev)
+	}
+	// the base is not known locally, e.g. updates arrived out of order
+	if proto.CompareRecordVersions(ver, v.Current()) > 0 {
+		return updateApply, nil
+	}
+	return updateReject, nil
+}
+
+// resolveImport decides whether the incoming copy of the record replaces the local one. A copy that
+// contains the local current version is ahead, otherwise histories are forked and resolved at the fork
+// point in the same way as resolveUpdate does.
+func resolveImport(local, incoming *proto.Record) (bool, *ForkedVersion) {
+	localChain, incomingChain := versionChain(local), versionChain(incoming)
+	if i := versionIndex(localChain, incoming.Current().Version()); i >= 0 {
+		// same or behind, the same head with more versions retained is preferred
+		return i == len(localChain)-1 && len(incomingChain) > len(localChain), nil
+	} else if versionIndex(incomingChain, local.Current().Version()) >= 0 {
+		return true, nil
+	}
+	localFirst, incomingFirst := local.Current(), incoming.Current()
+	var base string
+	localFrom, incomingFrom := 0, 0
+	for j := len(incomingChain) - 2; j >= 0; j-- {
+		if i := versionIndex(localChain, incomingChain[j].Version()); i >= 0 {
+			base = incomingChain[j].Version()
+			localFirst, incomingFirst = localChain[i+1], incomingChain[j+1]
+			localFrom, incomingFrom = i+1, j+1
+			break
+		}
+	}
+	if proto.CompareRecordVersions(incomingFirst, localFirst) > 0 {
+		return true, newForkedVersion(local.Current(), base, chainVersions(localChain[localFrom:])...)
+	}
+	return false, newForkedVersion(incoming.Current(), base, chainVersions(incomingChain[incomingFrom:])...)
+}
+
+// addConflict records the losing branch of the record, a fork that extends an already known
+// losing branch replaces its head.
+func (r *recordStore) addConflict(id, path string, fork *ForkedVersion) {
+	inBranch := func(version string) bool {
+		for _, v := range fork.branch {
+			if v == version {
+				return true
+			}
+		}
+		return false
+	}
+	var added bool
+	if err := r.ss.Update(state.NewKey(state.BucketConflicts, []byte(id)), func(k *state.Key, v []byte) ([]byte, error) {
+		conflict := &RecordConflict{
+			ID:   id,
+			Path: path,
+		}
+		if v != nil {
+			if err := json.Unmarshal(v, conflict); err != nil {
+				return nil, err
+			}
+		}
+		extended := false
+		for i, f := range conflict.Forks {
+			if f.Version == fork.Version {
+				return nil, state.ErrNoUpdate
+			} else if inBranch(f.Version) {
+				if len(fork.Base) == 0 {
+					fork.Base = f.Base
+				}
+				conflict.Forks[i] = fork
+				extended = true
+				break
+			}
+		}
+		if !extended {
+			conflict.Forks = append(conflict.Forks, fork)
+		}
+		conflict.UpdatedAt = time.Now().UnixNano()
+		added = true
+		return json.Marshal(conflict)
+	}); err != nil {
+		log.WithField("record", id).Warningf("failed to record conflict: %v", err)
+		return
+	} else if !added {
+		return
+	}
+	log.WithFields(log.Fields{
+		"record":  id,
+		"version": fork.Version,
+		"base":    fork.Base,
+	}).Warningln("record history has diverged, the branch has lost")
+}
+
+// isForkedVersion checks if the version is the head of a losing branch of the record.
+func (r *recordStore) isForkedVersion(id, version string) bool {
+	var forked bool
+	if err := r.ss.View(state.NewKey(state.BucketConflicts, []byte(id)), func(k *state.Key, v []byte) error {
+		var conflict *RecordConflict
+		if err := json.Unmarshal(v, &conflict); err != nil || conflict == nil {
+			return nil
+		}
+		for _, f := range conflict.Forks {
+			if f.Version == version {
+				forked = true
+				break
+			}
+		}
+		return nil
+	}); err != nil && err != state.ErrNotFound {
+		log.WithField("record", id).Warningf("failed to check record conflicts: %v", err)
+	}
+	return forked
+}
+
+// Conflicts lists records whose history has diverged.
+func (r *recordStore) Conflicts(ctx context.Context) ([]*RecordConflict, error) {
+	conflicts := []*RecordConflict{}
+	if _, err := r.ss.RangePeek(state.NewBucket(state.BucketConflicts), func(k *state.Key, v []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var conflict *RecordConflict
+		if err := json.Unmarshal(v, &conflict); err != nil || conflict == nil {
+			return nil
+		}
+		conflicts = append(conflicts, conflict)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+type testUpdate struct {
+	version     string
+	versionPrev string
+	nodeID      string
+	timestamp   int64
+}
+
+func (u testUpdate) recordVersion() proto.RecordVersion {
+	e := proto.AutoNewEnvelopeRecordUpdate(capn.NewBuffer(nil))
+	e.SetVersion(u.version)
+	e.SetVersionPrev(u.versionPrev)
+	e.SetSignedAt(u.timestamp)
+	buf := new(bytes.Buffer)
+	if _, err := e.Segment.WriteToPacked(buf); err != nil {
+		panic(err)
+	}
+	ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	ann.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
+	ann.SetEnvelope(buf.Bytes())
+	ann.SetNodeID(u.nodeID)
+	ann.SetTimestamp(u.timestamp)
+	return newRecordVersion(ann, u.version)
+}
+
+func TestForkResolution(t *testing.T) {
+	require := require.New(t)
+
+	x := testUpdate{"x", "", "node-a", 1}
+	a := testUpdate{"a", "x", "node-a", 3}
+	b := testUpdate{"b", "x", "node-b", 2}
+	b2 := testUpdate{"b2", "b", "node-b", 4}
+
+	id := proto.NewID()
+	// apply mirrors the way applyRecordUpdate resolves announced versions
+	apply := func(r *recordStore, v *proto.Record, u testUpdate) *proto.Record {
+		ver := u.recordVersion()
+		res, fork := resolveUpdate(v, ver, u.versionPrev, r.isForkedVersion(id, u.versionPrev))
+		if fork != nil {
+			r.addConflict(id, "/path", fork)
+		}
+		if res == updateReject {
+			return v
+		} else if res == updateRebase {
+			v = rewindRecord(v, u.versionPrev)
+		}
+		return withRecordVersion(v, id, "/path", ver.Announce(), u.version)
+	}
+	versions := func(v *proto.Record) []string {
+		return chainVersions(versionChain(v))
+	}
+
+	// both nodes end up with the same history regardless of the order
+	r1, r2 := newTestStore(t), newTestStore(t)
+	v1 := apply(r1, apply(r1, apply(r1, nil, x), a), b)
+	v2 := apply(r2, apply(r2, apply(r2, nil, x), b), a)
+	require.Equal([]string{"x", "a"}, versions(v1))
+	require.Equal([]string{"x", "a"}, versions(v2))
+
+	// descendants of the losing branch are rejected, the fork head follows them
+	v1 = apply(r1, v1, b2)
+	v2 = apply(r2, v2, b2)
+	require.Equal([]string{"x", "a"}, versions(v1))
+	require.Equal([]string{"x", "a"}, versions(v2))
+	for _, r := range []*recordStore{r1, r2} {
+		conflicts, err := r.Conflicts(context.Background())
+		require.NoError(err)
+		require.Len(conflicts, 1)
+		require.Equal(id, conflicts[0].ID)
+		require.Len(conflicts[0].Forks, 1)
+		require.Equal("b2", conflicts[0].Forks[0].Version)
+		require.Equal("x", conflicts[0].Forks[0].Base)
+		require.Equal("node-b", conflicts[0].Forks[0].NodeID)
+	}
+
+	// full copies received on sync are resolved at the fork point as well
+	vb := apply(r1, apply(r1, nil, x), b)
+	replace, fork := resolveImport(v1, vb)
+	require.False(replace)
+	require.Equal("b", fork.Version)
+	require.Equal("x", fork.Base)
+	replace, fork = resolveImport(vb, v1)
+	require.True(replace)
+	require.Equal("b", fork.Version)
+	vx := apply(r1, nil, x)
+	replace, fork = resolveImport(vx, v1)
+	require.True(replace)
+	require.Nil(fork)
+	replace, fork = resolveImport(v1, vx)
+	require.False(replace)
+	require.Nil(fork)
+}
@@ -0,0 +1,53 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// syncCursorSkew is subtracted from sync watermarks to tolerate clock skew between nodes
+// and announces that have been in flight while the sync was running.
+const syncCursorSkew = 10 * time.Minute
+
+func syncCursorKey(nodeID string) *state.Key {
+	return state.NewHashedKey(state.BucketSyncCursors, []byte(nodeID))
+}
+
+// syncCursor returns the timestamp in Unix nanoseconds since which records of the peer
+// should be requested, or zero if the node has never been synced with the peer.
+func (r *recordStore) syncCursor(nodeID string) (int64, error) {
+	var since int64
+	err := r.ss.View(syncCursorKey(nodeID), func(k *state.Key, v []byte) error {
+		if len(v) != 8 {
+			return nil
+		}
+		since = int64(binary.BigEndian.Uint64(v))
+		return nil
+	})
+	if err == state.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return since, nil
+}
+
+// setSyncCursor stores a watermark for the peer, the next sync will request records
+// changed since the watermark, minus syncCursorSkew.
+func (r *recordStore) setSyncCursor(nodeID string, syncedAt time.Time) error {
+	since := syncedAt.Add(-syncCursorSkew).UnixNano()
+	return r.ss.Update(syncCursorKey(nodeID), func(k *state.Key, v []byte) ([]byte, error) {
+		if len(v) == 8 && int64(binary.BigEndian.Uint64(v)) >= since {
+			return nil, state.ErrNoUpdate
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(since))
+		return buf, nil
+	})
+}
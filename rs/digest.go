@@ -0,0 +1,183 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// DigestBuckets is the number of leaf buckets in a records digest.
+const DigestBuckets = 256
+
+// RecordsDigest is a two-level Merkle tree over IDs and current versions of all records.
+// Records are spread across buckets by their ID digest, so nodes can find the buckets
+// that differ and exchange only the records within them.
+type RecordsDigest struct {
+	Root    string   `json:"root"`
+	Buckets []string `json:"buckets"`
+	Records int      `json:"records"`
+}
+
+// Diff returns indices of buckets that differ between two digests.
+func (d *RecordsDigest) Diff(d2 *RecordsDigest) []int {
+	if d.Root == d2.Root {
+		return nil
+	}
+	var diff []int
+	for i := 0; i < DigestBuckets; i++ {
+		if i >= len(d.Buckets) || i >= len(d2.Buckets) || d.Buckets[i] != d2.Buckets[i] {
+			diff = append(diff, i)
+		}
+	}
+	return diff
+}
+
+func digestBucket(id []byte) int {
+	sum := sha256.Sum256(id)
+	return int(sum[0])
+}
+
+func (r *recordStore) RecordsDigest(ctx context.Context) (*RecordsDigest, error) {
+	defer r.inboundWork()
+	var count int
+	buckets := make([]hash.Hash, DigestBuckets)
+	for i := range buckets {
+		buckets[i] = sha256.New()
+	}
+	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	// records are ranged in the order of their IDs, so leaves are hashed in the same order on every node
+	if _, err := r.ss.RangePeek(b, proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+		if v == nil {
+			return nil
+		}
+		leaf := sha256.New()
+		leaf.Write(v.IdBytes())
+		leaf.Write([]byte{'|'})
+		leaf.Write(v.Current().VersionBytes())
+		buckets[digestBucket(v.IdBytes())].Write(leaf.Sum(nil))
+		count++
+		return nil
+	})); err != nil {
+		return nil, err
+	}
+	digest := &RecordsDigest{
+		Buckets: make([]string, DigestBuckets),
+		Records: count,
+	}
+	root := sha256.New()
+	for i, h := range buckets {
+		sum := h.Sum(nil)
+		root.Write(sum)
+		digest.Buckets[i] = hex.EncodeToString(sum)
+	}
+	digest.Root = hex.EncodeToString(root.Sum(nil))
+	return digest, nil
+}
+
+func (r *recordStore) getNodeDigest(ctx context.Context, nodeID string) (*RecordsDigest, error) {
+	u := fmt.Sprintf("http://%s/private/v1/digest", nodeID)
+	req, _ := http.NewRequest("GET", u, nil)
+	req = req.WithContext(ctx)
+	resp, err := r.fs.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		if len(body) == 0 {
+			return nil, fmt.Errorf("error %d: %s", resp.StatusCode, resp.Status)
+		}
+		return nil, fmt.Errorf("%s", string(body))
+	}
+	var digest *RecordsDigest
+	if err := json.NewDecoder(resp.Body).Decode(&digest); err != nil {
+		err = fmt.Errorf("failed to decode digest: %v", err)
+		return nil, err
+	}
+	return digest, nil
+}
+
+// AntiEntropy periodically compares the records digest with a random sync-permitted peer
+// and pulls the records from buckets that differ. It recovers updates that have been missed
+// while the node was offline or announces got lost.
+func (r *recordStore) AntiEntropy(ctx context.Context, dur time.Duration) {
+	t := time.NewTimer(dur)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := r.reconcile(ctx, dur); err != nil {
+				log.Warningf("anti-entropy failed: %v", err)
+			}
+			t.Reset(dur)
+		}
+	}
+}
+
+func (r *recordStore) reconcile(ctx context.Context, timeout time.Duration) error {
+	candidates := r.syncCandidates()
+	if len(candidates) == 0 {
+		return nil
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, timeout)
+	defer cancelFn()
+	var nodeID string
+	for _, i := range rand.Perm(len(candidates)) {
+		if r.pingNode(ctx, candidates[i]) == stateAlive {
+			nodeID = candidates[i]
+			break
+		}
+	}
+	if len(nodeID) == 0 {
+		log.Debugln("anti-entropy: no alive peers found")
+		return nil
+	}
+	r.outboundWork()
+	remote, err := r.getNodeDigest(ctx, nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to get digest of %s: %v", nodeID, err)
+	}
+	local, err := r.RecordsDigest(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to compute digest: %v", err)
+	}
+	diff := local.Diff(remote)
+	if len(diff) == 0 {
+		return nil
+	}
+	log.WithField("nodeID", nodeID).Debugf("anti-entropy: %d buckets differ", len(diff))
+	rC := make(chan *proto.Record, 100)
+	errC := make(chan error, 1)
+	go func() {
+		defer close(rC)
+		errC <- r.getNodeRecords(ctx, nodeID, ExportOptions{
+			Buckets: diff,
+		}, rC)
+	}()
+	for record := range rC {
+		if _, err := r.importRecord(record, "anti-entropy"); err != nil {
+			log.Warningf("failed to import record in anti-entropy: %v", err)
+		}
+	}
+	return <-errC
+}
@@ -0,0 +1,41 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestRecordsDigest(t *testing.T) {
+	require := require.New(t)
+
+	putRecord := func(r *recordStore, id, version string) {
+		putTestRecord(t, r, newTestRecord(id, "", nil, version))
+	}
+	r1, r2 := newTestStore(t), newTestStore(t)
+
+	ids := []string{proto.NewID(), proto.NewID(), proto.NewID()}
+	for _, id := range ids {
+		putRecord(r1, id, "v1")
+		putRecord(r2, id, "v1")
+	}
+	d1, err := r1.RecordsDigest(context.Background())
+	require.NoError(err)
+	d2, err := r2.RecordsDigest(context.Background())
+	require.NoError(err)
+	require.Equal(3, d1.Records)
+	require.Equal(d1.Root, d2.Root)
+	require.Empty(d1.Diff(d2))
+
+	putRecord(r2, ids[1], "v2")
+	d2, err = r2.RecordsDigest(context.Background())
+	require.NoError(err)
+	require.Equal([]int{digestBucket([]byte(ids[1]))}, d1.Diff(d2))
+}
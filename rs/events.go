@@ -20,6 +20,10 @@ const (
 	EventBeatInfo EventType = EventType(proto.ANNOUNCETYPE_BEATINFO)
 	// EventRecordUpdate - code for announcement of record update (3)
 	EventRecordUpdate EventType = EventType(proto.ANNOUNCETYPE_RECORDUPDATE)
+	// EventRecordBatch - code for announcement of atomic batch of record updates (4)
+	EventRecordBatch EventType = EventType(proto.ANNOUNCETYPE_RECORDBATCH)
+	// EventRecordHeads - code for re-announcement of current record versions (5)
+	EventRecordHeads EventType = EventType(proto.ANNOUNCETYPE_RECORDHEADS)
 	// EventStopAnnounce - code for stopping announcements
 	EventStopAnnounce EventType = 999
 )
@@ -32,6 +36,10 @@ func (e EventType) String() string {
 		return "beat-info"
 	case EventRecordUpdate:
 		return "record-update"
+	case EventRecordBatch:
+		return "record-batch"
+	case EventRecordHeads:
+		return "record-heads"
 	case EventStopAnnounce:
 		return "stop-announce"
 	default:
@@ -48,6 +56,10 @@ func EventFromTopic(topic string) EventType {
 		return EventBeatInfo
 	case EventRecordUpdate.String():
 		return EventRecordUpdate
+	case EventRecordBatch.String():
+		return EventRecordBatch
+	case EventRecordHeads.String():
+		return EventRecordHeads
 	default:
 		return EventUnknown
 	}
@@ -0,0 +1,167 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// expiryEntry is a record version that expires at the specified time.
+type expiryEntry struct {
+	ID        string `json:"id"`
+	Version   string `json:"version"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// expiryKey orders entries by the expiry time, so due entries are ranged first.
+func expiryKey(expiresAt int64, id string) *state.Key {
+	buf := make([]byte, 24)
+	binary.BigEndian.PutUint64(buf[:8], uint64(expiresAt))
+	sum := sha256.Sum256([]byte(id))
+	copy(buf[8:], sum[:16])
+	return state.NewKey(state.BucketExpiry, buf)
+}
+
+// indexRecordExpiry adds the current version of the record into the expiry index, if it
+// has been announced with an expiry time. Versions that are not current anymore by the
+// time of expiry are skipped by the sweeper.
+func indexRecordExpiry(ss state.IndexedStore, record *proto.Record) error {
+	upd, err := record.AnnounceEnvelope()
+	if err != nil {
+		return err
+	} else if upd.ExpiresAt() == 0 || upd.Version() != record.Current().Version() {
+		// the version is a tombstone of the expired one, see expireRecord
+		return nil
+	}
+	return addExpiryEntry(ss, &expiryEntry{
+		ID:        record.Id(),
+		Version:   record.Current().Version(),
+		ExpiresAt: upd.ExpiresAt(),
+	})
+}
+
+func addExpiryEntry(ss state.IndexedStore, entry *expiryEntry) error {
+	return ss.Update(expiryKey(entry.ExpiresAt, entry.ID), func(k *state.Key, v []byte) ([]byte, error) {
+		return json.Marshal(entry)
+	})
+}
+
+// ExpireRecords periodically deletes records which current version has expired. Every node
+// does that on its own and produces the same tombstone version, so expiry is consistent
+// across the network without any announces.
+func (r *recordStore) ExpireRecords(ctx context.Context, dur time.Duration) {
+	t := time.NewTimer(dur)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if n, err := r.expireRecords(ctx, time.Now()); err != nil {
+				log.Warningf("record expiry failed: %v", err)
+			} else if n > 0 {
+				log.Infof("expired %d records", n)
+			}
+			t.Reset(dur)
+		}
+	}
+}
+
+func (r *recordStore) expireRecords(ctx context.Context, now time.Time) (int, error) {
+	var due []*expiryEntry
+	b := state.NewBucket(state.BucketExpiry, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	if _, err := r.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+		var entry *expiryEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return nil
+		} else if entry.ExpiresAt > now.UnixNano() {
+			return state.ErrRangeStop
+		}
+		due = append(due, entry)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	var count int
+	for _, entry := range due {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		expired, err := r.expireRecord(ctx, entry)
+		if err != nil {
+			log.WithField("id", entry.ID).Warningf("failed to expire record: %v", err)
+			continue
+		} else if expired {
+			count++
+		}
+		if err := r.ss.Delete(expiryKey(entry.ExpiresAt, entry.ID)); err != nil {
+			log.Warningf("failed to remove expiry entry: %v", err)
+		}
+	}
+	return count, nil
+}
+
+// expireRecord marks the record as deleted if its current version is still the expired one,
+// then unpins the content of all its versions.
+func (r *recordStore) expireRecord(ctx context.Context, entry *expiryEntry) (bool, error) {
+	defer r.inboundWork()
+	k := state.NewKey(state.BucketRecords, []byte(entry.ID))
+	var removed []string
+	rec := &Record{}
+	if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+		if v == nil || v.Current().Version() != entry.Version {
+			return nil, state.ErrNoUpdate
+		}
+		// the tombstone has deterministic meta, so its CID is the same on every node
+		ref, err := r.fs.DeleteObject(ctx, fs.ObjectRef{
+			ID:              v.Id(),
+			Path:            v.Path(),
+			VersionPrevious: entry.Version,
+			CreatedAt:       entry.ExpiresAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+		removed = append(removed, entry.Version)
+		prev := v.Previous()
+		for i := 0; i < prev.Len(); i++ {
+			removed = append(removed, prev.At(i).Version())
+		}
+		// the tombstone carries the announce of the expired version, signed by its writer along
+		// with the expiry time, instead of a fresh one signed by this node: the version is the
+		// same on every node, so fork resolution agrees on it, and peers syncing the record
+		// accept it from any node, as the writer has the publish permission
+		expired := v.Current()
+		v.SetPrevious(proto.AppendRecordVersion(v.Previous(), expired))
+		v.SetCurrent(newRecordVersion(expired.Announce(), ref.Version))
+		rec.Record = *v
+		rec.Object = *ref
+		return v, nil
+	})); err != nil {
+		return false, err
+	} else if len(removed) == 0 {
+		return false, nil
+	}
+	for _, version := range removed {
+		if err := r.fs.UnpinObject(fs.ObjectRef{
+			Version: version,
+		}); err != nil {
+			log.Debugln("failed to unpin expired version:", version, err)
+		}
+	}
+	r.recordChanged(ChangeDeleted, &rec.Record)
+	return true, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+func TestExpiryIndex(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	newRecord := func(expiresAt time.Time) *proto.Record {
+		id := proto.NewID()
+		ann := newTestUpdate(t, id, "v1", func(e proto.EnvelopeRecordUpdate) {
+			e.SetExpiresAt(expiresAt.UnixNano())
+		})
+		return newTestRecord(id, "", &ann, "v1")
+	}
+	countEntries := func() int {
+		var n int
+		_, err := r.ss.RangeKeys(state.NewBucket(state.BucketExpiry), func(k *state.Key) error {
+			n++
+			return nil
+		})
+		require.NoError(err)
+		return n
+	}
+
+	now := time.Now()
+	// records are not in the store, so due entries are dropped without changes
+	r.recordChanged(ChangeCreated, newRecord(now.Add(time.Hour)))
+	r.recordChanged(ChangeCreated, newRecord(now.Add(-time.Minute)))
+	r.recordChanged(ChangeCreated, newRecord(now.Add(-time.Hour)))
+	require.Equal(3, countEntries())
+
+	n, err := r.expireRecords(context.Background(), now)
+	require.NoError(err)
+	require.Zero(n)
+	require.Equal(1, countEntries())
+
+	// tombstones keep the announce of the expired version, they don't expire again
+	rec := newRecord(now.Add(-time.Hour))
+	expired := rec.Current()
+	rec.SetPrevious(proto.AppendRecordVersion(rec.Previous(), expired))
+	rec.SetCurrent(newRecordVersion(expired.Announce(), "tombstone"))
+	r.recordChanged(ChangeDeleted, rec)
+	require.Equal(1, countEntries())
+}
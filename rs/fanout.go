@@ -0,0 +1,254 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+)
+
+var (
+	defaultFanoutPeers = 8
+	fanoutAttempts     = 3
+	fanoutTimeout      = 10 * time.Second
+	minFanoutBackoff   = time.Second
+	// fanoutWorkers bounds the number of announces pushed directly at once.
+	fanoutWorkers = 4
+	// fanoutQueueSize bounds the announces waiting for the fanout, others rely on pubsub.
+	fanoutQueueSize = 256
+	// alivePeersTTL is how long the list of alive sync peers is reused for fanout.
+	alivePeersTTL = time.Minute
+	// recentAnnouncesSize bounds the number of received announces remembered for dedup.
+	recentAnnouncesSize = 4096
+)
+
+// errPeerRejected is returned when the peer refuses the announce, so it's not retried.
+var errPeerRejected = errors.New("peer rejected the announce")
+
+// AnnounceFanoutOpt sets the number of alive sync peers record announces are pushed to
+// directly, besides publishing them to pubsub. Zero disables the direct fanout.
+func AnnounceFanoutOpt(peers int) StoreOpt {
+	return func(r *recordStore) {
+		r.fanoutPeers = peers
+	}
+}
+
+// fanoutJob is a record announce to push directly, published tells whether pubsub has
+// delivered it already.
+type fanoutJob struct {
+	ev        *EventAnnounce
+	published bool
+}
+
+// processFanout runs the workers pushing announces to peers, so slow or hanging peers
+// don't hold up the outbound workers.
+func (r *recordStore) processFanout(workers int) {
+	for i := 0; i < workers; i++ {
+		r.outboundWg.Add(1)
+		go func() {
+			defer r.outboundWg.Done()
+			for {
+				select {
+				case <-r.outboundStop:
+					return
+				case job := <-r.fanoutJobs:
+					pushed := r.fanoutAnnounce(job.ev)
+					r.outboundPublished(job.ev, job.published || pushed > 0)
+				}
+			}
+		}()
+	}
+}
+
+// queueFanout passes the announce to the fanout workers, which report the publishing result.
+// Returns false if the announce isn't pushed directly, so the caller reports it.
+func (r *recordStore) queueFanout(ev *EventAnnounce, published bool) bool {
+	if r.fanoutPeers <= 0 || !isDurableEvent(ev) || r.fanoutJobs == nil {
+		return false
+	}
+	select {
+	case r.fanoutJobs <- &fanoutJob{
+		ev:        ev,
+		published: published,
+	}:
+		return true
+	default:
+		// the announce stays in the outbound queue if pubsub hasn't delivered it
+		log.WithField("type", ev.Type.String()).Debugln("fanout queue is full, skipping the direct push")
+		return false
+	}
+}
+
+// fanoutAnnounce pushes the record announce to alive sync peers over the private API, so it
+// propagates even when the pubsub mesh is thin or partitioned. Returns the number of peers
+// that have accepted the announce.
+func (r *recordStore) fanoutAnnounce(ev *EventAnnounce) int {
+	if r.fanoutPeers <= 0 || !isDurableEvent(ev) {
+		return 0
+	}
+	data, err := packAnnounce(ev.Announce)
+	if err != nil {
+		log.Warningf("failed to pack announce for fanout: %v", err)
+		return 0
+	}
+	var delivered int32
+	wg := new(sync.WaitGroup)
+	for _, nodeID := range r.fanoutTargets() {
+		wg.Add(1)
+		go func(nodeID string) {
+			defer wg.Done()
+			if err := r.pushAnnounce(nodeID, ev.Type, data); err != nil {
+				log.WithFields(log.Fields{
+					"nodeID": nodeID,
+					"type":   ev.Type.String(),
+				}).Debugf("failed to push announce: %v", err)
+				return
+			}
+			atomic.AddInt32(&delivered, 1)
+		}(nodeID)
+	}
+	wg.Wait()
+	return int(delivered)
+}
+
+// fanoutTargets returns up to fanoutPeers random alive peers that are permitted to sync.
+func (r *recordStore) fanoutTargets() []string {
+	if authcenter.Default == nil {
+		return nil
+	}
+	r.fanoutMux.Lock()
+	// a single worker probes the peers, others use the previous list meanwhile
+	refresh := time.Since(r.alivePeersAt) > alivePeersTTL && !r.alivePeersRefresh
+	if refresh {
+		r.alivePeersRefresh = true
+	}
+	peers := make([]string, len(r.alivePeers))
+	copy(peers, r.alivePeers)
+	r.fanoutMux.Unlock()
+
+	if refresh {
+		ctx, cancelFn := context.WithTimeout(context.Background(), fanoutTimeout)
+		peers = r.aliveNodes(ctx, r.syncCandidates())
+		cancelFn()
+		r.fanoutMux.Lock()
+		r.alivePeers = peers
+		r.alivePeersAt = time.Now()
+		r.alivePeersRefresh = false
+		peers = make([]string, len(r.alivePeers))
+		copy(peers, r.alivePeers)
+		r.fanoutMux.Unlock()
+	}
+
+	if len(peers) > r.fanoutPeers {
+		rand.Shuffle(len(peers), func(i, j int) {
+			peers[i], peers[j] = peers[j], peers[i]
+		})
+		peers = peers[:r.fanoutPeers]
+	}
+	return peers
+}
+
+// pushAnnounce posts the packed announce to the peer, retrying with backoff.
+func (r *recordStore) pushAnnounce(nodeID string, typ EventType, data []byte) error {
+	var err error
+	for attempt := 1; attempt <= fanoutAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(retryBackoff(attempt-1, minFanoutBackoff, fanoutTimeout))
+		}
+		if err = r.postAnnounce(nodeID, typ, data); err == nil || err == errPeerRejected {
+			return err
+		}
+	}
+	return err
+}
+
+func (r *recordStore) postAnnounce(nodeID string, typ EventType, data []byte) error {
+	r.outboundWork()
+	ctx, cancelFn := context.WithTimeout(context.Background(), fanoutTimeout)
+	defer cancelFn()
+	u := fmt.Sprintf("http://%s/private/v1/announce?type=%s", nodeID, typ.String())
+	req, _ := http.NewRequest("POST", u, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := r.fs.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusBadRequest, http.StatusForbidden:
+		return errPeerRejected
+	default:
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+}
+
+// recentAnnounces remembers validated announces received lately, so the ones delivered both
+// by pubsub and pushed directly by the writer are handled once. Announces are added only once
+// they have passed validation, so an invalid copy can't suppress the valid one.
+type recentAnnounces struct {
+	mux  sync.Mutex
+	seen map[[sha256.Size]byte]struct{}
+	ring [][sha256.Size]byte
+	next int
+}
+
+// recentKey identifies the announce the same way markAnnounceSeen does.
+func recentKey(ev *EventAnnounce) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write([]byte(ev.Type.String()))
+	h.Write(ev.Announce.Envelope())
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// contains reports whether the announce has been received recently.
+func (s *recentAnnounces) contains(ev *EventAnnounce) bool {
+	key := recentKey(ev)
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, ok := s.seen[key]
+	return ok
+}
+
+// add reports whether the announce hasn't been received recently, the oldest one is forgotten
+// when the set is full.
+func (s *recentAnnounces) add(ev *EventAnnounce) bool {
+	key := recentKey(ev)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[[sha256.Size]byte]struct{}, recentAnnouncesSize)
+		s.ring = make([][sha256.Size]byte, recentAnnouncesSize)
+	}
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+	if len(s.seen) >= len(s.ring) {
+		delete(s.seen, s.ring[s.next])
+	}
+	s.ring[s.next] = key
+	s.next = (s.next + 1) % len(s.ring)
+	s.seen[key] = struct{}{}
+	return true
+}
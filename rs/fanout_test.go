@@ -0,0 +1,78 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestRecentAnnounces(t *testing.T) {
+	require := require.New(t)
+
+	defer func(size int) {
+		recentAnnouncesSize = size
+	}(recentAnnouncesSize)
+	recentAnnouncesSize = 2
+
+	r := newTestStore(t)
+	newEvent := func(envelope string) *EventAnnounce {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetId(proto.NewID())
+		ann.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
+		ann.SetEnvelope([]byte(envelope))
+		return &EventAnnounce{
+			Type:     EventRecordUpdate,
+			Announce: ann,
+		}
+	}
+
+	// copies are queued until one of them passes validation, an invalid copy can't suppress
+	// the valid one
+	r.ReceiveEventAnnounce(newEvent("update-1"))
+	r.ReceiveEventAnnounce(newEvent("update-1"))
+	require.Len(r.inboundPump, 2)
+	require.True(r.markAnnounceSeen(<-r.inboundPump))
+
+	// the same announce received from pubsub and pushed directly is handled once
+	r.ReceiveEventAnnounce(newEvent("update-1"))
+	require.Len(r.inboundPump, 1)
+	require.False(r.markAnnounceSeen(<-r.inboundPump))
+	require.EqualValues(1, r.StoreMetrics().Rejected[EventRecordUpdate][RejectDuplicate])
+
+	// the oldest announce is forgotten when the set is full
+	require.True(r.recent.add(newEvent("update-2")))
+	require.True(r.recent.add(newEvent("update-3")))
+	require.False(r.recent.add(newEvent("update-3")))
+	require.True(r.recent.add(newEvent("update-1")))
+}
+
+func TestQueueFanout(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	r.fanoutPeers = 1
+	r.fanoutJobs = make(chan *fanoutJob, 1)
+	newEvent := func(typ EventType) *EventAnnounce {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetId(proto.NewID())
+		return &EventAnnounce{
+			Type:     typ,
+			Announce: ann,
+		}
+	}
+
+	// beats are not pushed directly, the outbound worker reports them
+	require.False(r.queueFanout(newEvent(EventBeatTick), true))
+	require.True(r.queueFanout(newEvent(EventRecordUpdate), false))
+	// a full queue doesn't block the outbound worker
+	require.False(r.queueFanout(newEvent(EventRecordUpdate), true))
+	job := <-r.fanoutJobs
+	require.False(job.published)
+}
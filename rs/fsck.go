@@ -0,0 +1,181 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// Problems found by Fsck.
+const (
+	FsckUnpinned      = "unpinned"
+	FsckMissingBlocks = "missing-blocks"
+	FsckBadSignature  = "bad-signature"
+	FsckStatFailed    = "stat-failed"
+)
+
+// FsckOptions configures Fsck.
+type FsckOptions struct {
+	// Retention specifies how many previous versions are expected to be pinned.
+	Retention RetentionPolicy
+	// Repair enables fetching missing DAGs from peers and pinning them.
+	Repair bool
+	// RepairTimeout limits the time to repair a single version.
+	RepairTimeout time.Duration
+}
+
+// FsckIssue is a problem with a record or its version.
+type FsckIssue struct {
+	RecordID string `json:"recordId"`
+	Path     string `json:"path"`
+	Version  string `json:"version,omitempty"`
+	Problem  string `json:"problem"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+// FsckReport is the machine-readable result of Fsck.
+type FsckReport struct {
+	Records   int          `json:"records"`
+	Versions  int          `json:"versions"`
+	Recovered int          `json:"recovered"`
+	Broken    int          `json:"broken"`
+	Repaired  int          `json:"repaired"`
+	Issues    []*FsckIssue `json:"issues"`
+}
+
+type fsckRecord struct {
+	id       string
+	path     string
+	current  string
+	previous []string
+}
+
+// Fsck walks all records and checks that their current and retained previous versions are
+// pinned and fully present in the blockstore, and that the announces are properly signed.
+// Versions of deleted records are not expected to be retained, only the tombstone is checked.
+func Fsck(ctx context.Context, fileStore fs.PlanetaryFileStore,
+	stateStore state.IndexedStore, opts FsckOptions) (*FsckReport, error) {
+	report := &FsckReport{
+		Issues: []*FsckIssue{},
+	}
+	var records []*fsckRecord
+	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	if _, err := stateStore.RangePeek(b, proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+		if v == nil {
+			return nil
+		}
+		if isRecoveredRecord(stateStore, v.Id()) {
+			// recovered records have no signed announces until synced
+			report.Recovered++
+		} else if err := validateRecord(v); err != nil {
+			report.Issues = append(report.Issues, &FsckIssue{
+				RecordID: v.Id(),
+				Path:     v.Path(),
+				Version:  v.Current().Version(),
+				Problem:  FsckBadSignature,
+				Detail:   err.Error(),
+			})
+		}
+		rec := &fsckRecord{
+			id:      v.Id(),
+			path:    v.Path(),
+			current: v.Current().Version(),
+		}
+		prev := v.Previous()
+		from := 0
+		if depth := opts.Retention.PinDepth(v.Path()); depth >= 0 && prev.Len() > depth {
+			from = prev.Len() - depth
+		}
+		for i := from; i < prev.Len(); i++ {
+			rec.previous = append(rec.previous, prev.At(i).Version())
+		}
+		records = append(records, rec)
+		return nil
+	})); err != nil {
+		return nil, err
+	}
+	report.Records = len(records)
+	for _, rec := range records {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Versions++
+		if ok := checkVersion(ctx, fileStore, rec, rec.current, report, opts); ok {
+			ref, err := fileStore.HeadObject(ctx, fs.ObjectRef{
+				Version: rec.current,
+			})
+			if err == nil && ref.Meta().IsDeleted() {
+				continue
+			}
+		}
+		for _, version := range rec.previous {
+			report.Versions++
+			checkVersion(ctx, fileStore, rec, version, report, opts)
+		}
+	}
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			report.Broken++
+		}
+	}
+	return report, nil
+}
+
+// checkVersion adds an issue into the report if the version is broken and repairs it if
+// requested. Returns true if the version is fine in the end.
+func checkVersion(ctx context.Context, fileStore fs.PlanetaryFileStore, rec *fsckRecord,
+	version string, report *FsckReport, opts FsckOptions) bool {
+	issue := &FsckIssue{
+		RecordID: rec.id,
+		Path:     rec.path,
+		Version:  version,
+	}
+	status, err := fileStore.StatObject(ctx, fs.ObjectRef{
+		Version: version,
+	})
+	if err != nil {
+		issue.Problem = FsckStatFailed
+		issue.Detail = err.Error()
+	} else if !status.Complete() {
+		issue.Problem = FsckMissingBlocks
+	} else if !status.Pinned {
+		issue.Problem = FsckUnpinned
+	} else {
+		return true
+	}
+	report.Issues = append(report.Issues, issue)
+	if !opts.Repair || issue.Problem == FsckStatFailed {
+		return false
+	}
+	if err := repairVersion(ctx, fileStore, version, opts.RepairTimeout); err != nil {
+		log.WithField("version", version).Warningf("fsck failed to repair version: %v", err)
+		issue.Detail = err.Error()
+		return false
+	}
+	issue.Repaired = true
+	report.Repaired++
+	return true
+}
+
+func repairVersion(ctx context.Context, fileStore fs.PlanetaryFileStore, version string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fileStore.RepairObject(ctx, fs.ObjectRef{
+		Version: version,
+	})
+}
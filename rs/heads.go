@@ -0,0 +1,217 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+var (
+	headsChunkSize  = 100
+	headsChunkPause = 5 * time.Second
+)
+
+// AnnounceHeads periodically re-announces the current versions of records written by this node,
+// so peers that have missed the original announces or joined later eventually learn about them.
+// The original signed announces are wrapped into chunks, pausing between chunks to keep the pubsub
+// load low.
+func (r *recordStore) AnnounceHeads(ctx context.Context, dur time.Duration) {
+	t := time.NewTimer(dur)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if n, err := r.announceHeads(ctx); err != nil {
+				log.Warningf("record heads announce failed: %v", err)
+			} else if n > 0 {
+				log.Debugf("re-announced %d record heads", n)
+			}
+			t.Reset(dur)
+		}
+	}
+}
+
+func (r *recordStore) announceHeads(ctx context.Context) (int, error) {
+	heads, err := r.ownHeads()
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(heads); i += headsChunkSize {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return i, ctx.Err()
+			case <-time.After(headsChunkPause):
+			}
+		}
+		end := i + headsChunkSize
+		if end > len(heads) {
+			end = len(heads)
+		}
+		// heads are announced again on the next round, so they're not persisted
+		ev := &EventAnnounce{
+			Type:     EventRecordHeads,
+			Announce: *r.newRecordHeadsAnnounce(heads[i:end]),
+		}
+		atomic.AddInt64(&r.outboundQueued, 1)
+		select {
+		case <-ctx.Done():
+			return i, ctx.Err()
+		case <-r.outboundStop:
+			return i, nil
+		case r.outboundPump <- ev:
+		}
+	}
+	return len(heads), nil
+}
+
+func (r *recordStore) newRecordHeadsAnnounce(heads []*EventAnnounce) *proto.Announce {
+	e := proto.AutoNewEnvelopeRecordHeads(capn.NewBuffer(nil))
+	e.SetId(proto.NewID())
+	announces := proto.NewAnnounceList(e.Segment, len(heads))
+	for i, head := range heads {
+		announces.Set(i, head.Announce)
+	}
+	e.SetAnnounces(announces)
+	buf := new(bytes.Buffer)
+	if _, err := e.Segment.WriteToPacked(buf); err != nil {
+		panic(fmt.Sprintf("failed to pack data: %v", err))
+	}
+	sig, err := r.fs.SignData(r.nodeID, buf.Bytes())
+	if err != nil {
+		panic(fmt.Sprintf("failed to use FS signer: %v", err))
+	}
+	a := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	a.SetId(proto.NewID())
+	a.SetType(proto.ANNOUNCETYPE_RECORDHEADS)
+	a.SetEnvelope(buf.Bytes())
+	a.SetSignature(hex.EncodeToString(sig))
+	a.SetTimestamp(time.Now().UnixNano())
+	a.SetNodeID(r.nodeID)
+	return &a
+}
+
+// unpackRecordHeads returns the re-announced record updates and batches, only the heads
+// of records written by the announcing node are accepted.
+func unpackRecordHeads(ev *EventAnnounce) ([]*EventAnnounce, error) {
+	e, err := proto.UnpackEnvelopeRecordHeads(ev.Announce.Envelope())
+	if err != nil {
+		return nil, err
+	}
+	announces := e.Announces().ToArray()
+	heads := make([]*EventAnnounce, 0, len(announces))
+	for _, ann := range announces {
+		typ := EventType(ann.Type())
+		if ann.NodeID() != ev.Announce.NodeID() {
+			continue
+		} else if typ != EventRecordUpdate && typ != EventRecordBatch {
+			continue
+		}
+		heads = append(heads, &EventAnnounce{
+			Type:     typ,
+			Announce: ann,
+		})
+	}
+	return heads, nil
+}
+
+// applyRecordHead applies a validated re-announced update, heads of known versions are no-op.
+func (r *recordStore) applyRecordHead(ev *EventAnnounce, fields log.Fields, timeout time.Duration) {
+	var err error
+	switch ev.Type {
+	case EventRecordBatch:
+		err = r.handleRecordBatch(ev, fields, timeout)
+	default:
+		err = r.applyRecordUpdate(ev, fields, timeout)
+	}
+	if err == errContentUnavailable {
+		log.WithFields(fields).Warningln("re-announced content is not available yet, queued for retry")
+		r.addPendingFetch(ev)
+	}
+}
+
+// ownHeads collects the signed announces of current versions of records written by this node.
+// A batch announce is listed once, even if it's the current one for multiple records.
+func (r *recordStore) ownHeads() ([]*EventAnnounce, error) {
+	var heads []*EventAnnounce
+	seen := make(map[string]struct{})
+	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	if _, err := r.ss.RangePeek(b, proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+		if v == nil {
+			return nil
+		}
+		ann := v.Current().Announce()
+		typ := EventType(ann.Type())
+		if ann.NodeID() != r.nodeID || len(ann.Signature()) == 0 {
+			// recovered records have unsigned announces
+			return nil
+		} else if typ != EventRecordUpdate && typ != EventRecordBatch {
+			return nil
+		} else if _, ok := seen[ann.Id()]; ok {
+			return nil
+		}
+		seen[ann.Id()] = struct{}{}
+		// the announce must outlive the range transaction
+		data, err := packAnnounce(ann)
+		if err != nil {
+			log.WithField("record", v.Id()).Warningf("failed to pack record head: %v", err)
+			return nil
+		}
+		head, err := proto.UnpackAnnounce(data)
+		if err != nil {
+			log.WithField("record", v.Id()).Warningf("failed to unpack record head: %v", err)
+			return nil
+		}
+		heads = append(heads, &EventAnnounce{
+			Type:     typ,
+			Announce: head,
+		})
+		return nil
+	})); err != nil {
+		return nil, err
+	}
+	return heads, nil
+}
+
+// hasRecordVersion checks if the version is the current or one of the previous versions of the record.
+func hasRecordVersion(v *proto.Record, version string) bool {
+	if v == nil {
+		return false
+	} else if v.Current().Version() == version {
+		return true
+	}
+	for _, ver := range v.Previous().ToArray() {
+		if ver.Version() == version {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownVersion checks if the record has the version already, so its announce is a no-op.
+func (r *recordStore) isKnownVersion(id, version string) bool {
+	var known bool
+	if err := r.ss.View(state.NewKey(state.BucketRecords, []byte(id)), proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+		known = hasRecordVersion(v, version)
+		return nil
+	})); err != nil && err != state.ErrNotFound {
+		log.WithField("record", id).Warningf("failed to check record version: %v", err)
+	}
+	return known
+}
@@ -0,0 +1,87 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestRecordHeads(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	r.nodeID = "self"
+	newAnnounce := func(id, nodeID string, typ proto.AnnounceType) proto.Announce {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetId(id)
+		ann.SetNodeID(nodeID)
+		ann.SetType(typ)
+		ann.SetSignature("signature")
+		return ann
+	}
+	putRecord := func(id string, versions []string, ann proto.Announce) {
+		putTestRecord(t, r, newTestRecord(id, "", &ann, versions...))
+	}
+	update := newAnnounce("update", "self", proto.ANNOUNCETYPE_RECORDUPDATE)
+	batch := newAnnounce("batch", "self", proto.ANNOUNCETYPE_RECORDBATCH)
+	unsigned := newAnnounce("unsigned", "self", proto.ANNOUNCETYPE_RECORDUPDATE)
+	unsigned.SetSignature("")
+	recordID := proto.NewID()
+	putRecord(recordID, []string{"v1", "v2"}, update)
+	putRecord(proto.NewID(), []string{"v1"}, batch)
+	putRecord(proto.NewID(), []string{"v1"}, batch)
+	putRecord(proto.NewID(), []string{"v1"}, newAnnounce("other", "peer", proto.ANNOUNCETYPE_RECORDUPDATE))
+	putRecord(proto.NewID(), []string{"v1"}, unsigned)
+
+	// only signed heads of own records, the batch is announced once
+	heads, err := r.ownHeads()
+	require.NoError(err)
+	ids := map[string]EventType{}
+	for _, ev := range heads {
+		ids[ev.Announce.Id()] = ev.Type
+	}
+	require.Equal(map[string]EventType{
+		"update": EventRecordUpdate,
+		"batch":  EventRecordBatch,
+	}, ids)
+
+	// receivers accept heads of records written by the announcing node only
+	e := proto.AutoNewEnvelopeRecordHeads(capn.NewBuffer(nil))
+	announces := proto.NewAnnounceList(e.Segment, 2)
+	announces.Set(0, heads[0].Announce)
+	announces.Set(1, newAnnounce("other", "peer", proto.ANNOUNCETYPE_RECORDUPDATE))
+	e.SetAnnounces(announces)
+	buf := new(bytes.Buffer)
+	_, err = e.Segment.WriteToPacked(buf)
+	require.NoError(err)
+	outer := newAnnounce(proto.NewID(), "self", proto.ANNOUNCETYPE_RECORDHEADS)
+	outer.SetEnvelope(buf.Bytes())
+	received, err := unpackRecordHeads(&EventAnnounce{
+		Type:     EventRecordHeads,
+		Announce: outer,
+	})
+	require.NoError(err)
+	require.Len(received, 1)
+	require.Equal(heads[0].Type, received[0].Type)
+	require.Equal(heads[0].Announce.Id(), received[0].Announce.Id())
+	require.Equal(heads[0].Announce.Signature(), received[0].Announce.Signature())
+
+	// an announce of a known version is a no-op and doesn't touch the file store
+	require.True(r.isKnownVersion(recordID, "v1"))
+	require.True(r.isKnownVersion(recordID, "v2"))
+	require.False(r.isKnownVersion(recordID, "v3"))
+	require.False(r.isKnownVersion(proto.NewID(), "v1"))
+	update.SetEnvelope(newTestUpdate(t, recordID, "v1", nil).Envelope())
+	require.NoError(r.applyRecordUpdate(&EventAnnounce{
+		Type:     EventRecordUpdate,
+		Announce: update,
+	}, nil, 0))
+}
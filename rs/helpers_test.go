@@ -0,0 +1,116 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// newTestStore returns a record store backed by an in-memory state store, without the file store
+// and background workers. The state store is closed when the test finishes.
+func newTestStore(t *testing.T) *recordStore {
+	ss := state.NewIndexedStoreMemory()
+	t.Cleanup(func() {
+		ss.Close()
+	})
+	return &recordStore{
+		ss:           ss,
+		stateMux:     new(sync.RWMutex),
+		changes:      newChangeHub(),
+		inboundPump:  make(chan *EventAnnounce, 10),
+		outboundPump: make(chan *EventAnnounce, 10),
+		outboundStop: make(chan struct{}),
+	}
+}
+
+// newTestRecord returns a record with the versions, the last one is current. Every version
+// carries the announce, if set.
+func newTestRecord(id, path string, ann *proto.Announce, versions ...string) *proto.Record {
+	rec := proto.AutoNewRecord(capn.NewBuffer(nil))
+	rec.SetId(id)
+	if len(path) > 0 {
+		rec.SetPath(path)
+	}
+	for i, version := range versions {
+		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetVersion(version)
+		if ann != nil {
+			ver.SetAnnounce(*ann)
+		}
+		if i > 0 {
+			rec.SetPrevious(proto.AppendRecordVersion(rec.Previous(), rec.Current()))
+		}
+		rec.SetCurrent(ver)
+	}
+	return &rec
+}
+
+// putTestRecord stores the record as is, without indexing it.
+func putTestRecord(t *testing.T, r *recordStore, rec *proto.Record) {
+	require.NoError(t, r.ss.Update(state.NewKey(state.BucketRecords, rec.IdBytes()),
+		proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+			return rec, nil
+		})))
+}
+
+// newTestUpdate returns an unsigned record update announce, edit sets other envelope fields.
+func newTestUpdate(t *testing.T, id, version string, edit func(e proto.EnvelopeRecordUpdate)) proto.Announce {
+	e := proto.AutoNewEnvelopeRecordUpdate(capn.NewBuffer(nil))
+	e.SetId(id)
+	e.SetVersion(version)
+	if edit != nil {
+		edit(e)
+	}
+	buf := new(bytes.Buffer)
+	_, err := e.Segment.WriteToPacked(buf)
+	require.NoError(t, err)
+	ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	ann.SetId(proto.NewID())
+	ann.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
+	ann.SetEnvelope(buf.Bytes())
+	return ann
+}
+
+// testAuth grants all permissions to every node.
+type testAuth struct{}
+
+func (testAuth) Entries() map[string]authcenter.Entry { return nil }
+
+func (testAuth) HasPermissions(key string, perms ...authcenter.Permission) bool { return true }
+
+func (testAuth) AllPermissions(key string) []authcenter.Permission {
+	return []authcenter.Permission{authcenter.RecordSyncPermission, authcenter.RecordWritePermission}
+}
+
+func (testAuth) LastRefresh() time.Time { return time.Now() }
+
+func (testAuth) StopUpdates() {}
+
+// testFileStore serves object refs from memory, other methods of the file store are not implemented.
+type testFileStore struct {
+	fs.PlanetaryFileStore
+
+	objects map[string]*fs.ObjectRef
+}
+
+func (s *testFileStore) HeadObject(ctx context.Context, ref fs.ObjectRef) (*fs.ObjectRef, error) {
+	obj, ok := s.objects[ref.Version]
+	if !ok {
+		return nil, fs.ErrNotFound
+	}
+	return obj, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// pathIndexMarker is the key within state.BucketMeta that marks the path index as complete.
+var pathIndexMarker = state.NewKey(state.BucketMeta, []byte("path-index"))
+
+// pathIndexKey returns the key of path-to-ID index entry for a record path. Paths are
+// longer than state keys, so the key is a digest of the path.
+func pathIndexKey(path string) *state.Key {
+	return state.NewHashedKey(state.BucketPathIndex, []byte(path))
+}
+
+// pathIndexValue packs record ID with its path, so digest collisions can be detected on lookup.
+func pathIndexValue(id, path string) []byte {
+	buf := make([]byte, 0, len(id)+1+len(path))
+	buf = append(buf, id...)
+	buf = append(buf, 0)
+	buf = append(buf, path...)
+	return buf
+}
+
+func parsePathIndexValue(v []byte) (id, path string, ok bool) {
+	i := bytes.IndexByte(v, 0)
+	if i <= 0 {
+		return "", "", false
+	}
+	return string(v[:i]), string(v[i+1:]), true
+}
+
+// lookupPathIndex finds a record ID by its path using the path index, it's a point read.
+func lookupPathIndex(ss state.IndexedStore, path string) (string, error) {
+	var id string
+	err := ss.View(pathIndexKey(path), func(k *state.Key, v []byte) error {
+		indexID, indexPath, ok := parsePathIndexValue(v)
+		if !ok || indexPath != path {
+			return nil
+		}
+		id = indexID
+		return nil
+	})
+	if err == state.ErrNotFound {
+		return "", ErrRecordNotFound
+	} else if err != nil {
+		return "", err
+	} else if len(id) == 0 {
+		return "", ErrRecordNotFound
+	}
+	return id, nil
+}
+
+// indexRecordPath sets the path index entry for a record, overwriting the previous one.
+func indexRecordPath(ss state.IndexedStore, id, path string) error {
+	if len(path) == 0 || len(id) == 0 {
+		return nil
+	}
+	value := pathIndexValue(id, path)
+	return ss.Update(pathIndexKey(path), func(k *state.Key, v []byte) ([]byte, error) {
+		if bytes.Equal(v, value) {
+			return nil, state.ErrNoUpdate
+		}
+		return value, nil
+	})
+}
+
+// RebuildPathIndex walks all records in the state and fills the path-to-ID index. Unless force is set,
+// it does nothing for a state that has the index built already.
+func RebuildPathIndex(stateStore state.IndexedStore, force bool) (int, error) {
+	if !force {
+		err := stateStore.View(pathIndexMarker, func(k *state.Key, v []byte) error {
+			return nil
+		})
+		if err == nil {
+			return 0, nil
+		} else if err != state.ErrNotFound {
+			return 0, err
+		}
+	}
+	type entry struct {
+		id   string
+		path string
+	}
+	var entries []entry
+	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	if _, err := stateStore.RangePeek(b, proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+		if v == nil {
+			return nil
+		}
+		entries = append(entries, entry{
+			id:   v.Id(),
+			path: v.Path(),
+		})
+		return nil
+	})); err != nil {
+		return 0, err
+	}
+	var indexed int
+	for _, e := range entries {
+		if err := indexRecordPath(stateStore, e.id, e.path); err != nil {
+			log.WithFields(log.Fields{
+				"id":   e.id,
+				"path": e.path,
+			}).Warningf("failed to index record path: %v", err)
+			continue
+		}
+		indexed++
+	}
+	if err := stateStore.Update(pathIndexMarker, func(k *state.Key, v []byte) ([]byte, error) {
+		return []byte(strconv.FormatInt(time.Now().UnixNano(), 10)), nil
+	}); err != nil {
+		return indexed, err
+	}
+	return indexed, nil
+}
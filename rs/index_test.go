@@ -0,0 +1,50 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+func TestPathIndex(t *testing.T) {
+	require := require.New(t)
+
+	ss := state.NewIndexedStoreMemory()
+	defer ss.Close()
+
+	id := proto.NewID()
+	path := "/properties/some/very/long/path/to/the/document.pdf"
+	rec := proto.AutoNewRecord(capn.NewBuffer(nil))
+	rec.SetId(id)
+	rec.SetPath(path)
+	err := ss.Update(state.NewKey(state.BucketRecords, []byte(id)),
+		proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+			return &rec, nil
+		}))
+	require.NoError(err)
+
+	_, err = lookupPathIndex(ss, path)
+	require.Equal(ErrRecordNotFound, err)
+
+	n, err := RebuildPathIndex(ss, false)
+	require.NoError(err)
+	require.Equal(1, n)
+	found, err := lookupPathIndex(ss, path)
+	require.NoError(err)
+	require.Equal(id, found)
+
+	n, err = RebuildPathIndex(ss, false)
+	require.NoError(err)
+	require.Equal(0, n, "index is built already")
+
+	_, err = lookupPathIndex(ss, path+".bak")
+	require.Equal(ErrRecordNotFound, err)
+}
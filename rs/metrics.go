@@ -0,0 +1,119 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Reasons of received announce rejections.
+const (
+	RejectUnauthorized     = "unauthorized"
+	RejectInvalidSignature = "invalid_signature"
+	RejectMalformed        = "malformed"
+	RejectReplayed         = "replayed"
+	RejectSkewed           = "skewed"
+	RejectVersionMismatch  = "version_mismatch"
+	// RejectDuplicate is an announce received both from pubsub and pushed directly.
+	RejectDuplicate = "duplicate"
+)
+
+// StoreMetrics is a snapshot of the record store internal counters.
+type StoreMetrics struct {
+	// State is the sync state of the store: inactive, sync or active.
+	State         string
+	InboundWork   uint64
+	OutboundWork  uint64
+	InboundQueue  int64
+	OutboundQueue int64
+	// Handled counts received announces processed by type, including the rejected ones.
+	Handled map[EventType]uint64
+	// Rejected counts received announces rejected by type and reason.
+	Rejected map[EventType]map[string]uint64
+}
+
+type announceCounters struct {
+	mux      sync.Mutex
+	handled  map[EventType]uint64
+	rejected map[EventType]map[string]uint64
+}
+
+func (c *announceCounters) countHandled(typ EventType) {
+	c.mux.Lock()
+	if c.handled == nil {
+		c.handled = make(map[EventType]uint64)
+	}
+	c.handled[typ]++
+	c.mux.Unlock()
+}
+
+func (c *announceCounters) countRejected(typ EventType, reason string) {
+	c.mux.Lock()
+	if c.rejected == nil {
+		c.rejected = make(map[EventType]map[string]uint64)
+	}
+	if c.rejected[typ] == nil {
+		c.rejected[typ] = make(map[string]uint64)
+	}
+	c.rejected[typ][reason]++
+	c.mux.Unlock()
+}
+
+// rejectedTotal sums rejections with the reason over all event types.
+func (c *announceCounters) rejectedTotal(reason string) uint64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var n uint64
+	for _, reasons := range c.rejected {
+		n += reasons[reason]
+	}
+	return n
+}
+
+func (c *announceCounters) snapshot() (map[EventType]uint64, map[EventType]map[string]uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	handled := make(map[EventType]uint64, len(c.handled))
+	for typ, n := range c.handled {
+		handled[typ] = n
+	}
+	rejected := make(map[EventType]map[string]uint64, len(c.rejected))
+	for typ, reasons := range c.rejected {
+		rejected[typ] = make(map[string]uint64, len(reasons))
+		for reason, n := range reasons {
+			rejected[typ][reason] = n
+		}
+	}
+	return handled, rejected
+}
+
+func (s storeState) String() string {
+	switch s {
+	case storeSyncState:
+		return "sync"
+	case storeActiveState:
+		return "active"
+	default:
+		return "inactive"
+	}
+}
+
+// StoreMetrics returns the current values of the record store counters.
+func (r *recordStore) StoreMetrics() *StoreMetrics {
+	r.stateMux.RLock()
+	state := r.state
+	r.stateMux.RUnlock()
+	handled, rejected := r.announces.snapshot()
+	return &StoreMetrics{
+		State:         state.String(),
+		InboundWork:   atomic.LoadUint64(&r.inboundWorkCounter),
+		OutboundWork:  atomic.LoadUint64(&r.outboundWorkCounter),
+		InboundQueue:  atomic.LoadInt64(&r.inboundQueued),
+		OutboundQueue: atomic.LoadInt64(&r.outboundQueued),
+		Handled:       handled,
+		Rejected:      rejected,
+	}
+}
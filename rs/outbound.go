@@ -0,0 +1,224 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+var (
+	outboundRetryInterval = 5 * time.Second
+	minOutboundBackoff    = 5 * time.Second
+	maxOutboundBackoff    = 5 * time.Minute
+)
+
+// errNoTopicPeers is returned when an announce has been published to a topic without peers,
+// so nobody has received it.
+var errNoTopicPeers = errors.New("no pubsub peers on the topic")
+
+// outboundAnnounce is a record announce persisted until it has been published.
+type outboundAnnounce struct {
+	Type        EventType `json:"type"`
+	Announce    []byte    `json:"announce"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt int64     `json:"nextAttempt"`
+}
+
+// isDurableEvent reports whether the event is kept in the outbound queue until published.
+// Beats are periodic, so a lost beat is simply replaced by the next one.
+func isDurableEvent(ev *EventAnnounce) bool {
+	return ev.Type == EventRecordUpdate || ev.Type == EventRecordBatch
+}
+
+func outboundKey(ev *EventAnnounce) *state.Key {
+	return state.NewKey(state.BucketOutbound, ev.Announce.IdBytes())
+}
+
+// persistOutbound stores the record announce before it's queued for publishing.
+func (r *recordStore) persistOutbound(ev *EventAnnounce) {
+	data, err := packAnnounce(ev.Announce)
+	if err != nil {
+		log.Warningf("failed to persist outbound announce: %v", err)
+		return
+	}
+	// the worker reschedules it on failure, until then it's not retried
+	entry := &outboundAnnounce{
+		Type:        ev.Type,
+		Announce:    data,
+		NextAttempt: time.Now().Add(maxOutboundBackoff).UnixNano(),
+	}
+	if err := r.ss.Update(outboundKey(ev), func(k *state.Key, v []byte) ([]byte, error) {
+		return json.Marshal(entry)
+	}); err != nil {
+		log.Warningf("failed to persist outbound announce: %v", err)
+	}
+}
+
+// outboundDone removes the announce from the queue once it has been published,
+// otherwise schedules the next attempt.
+func (r *recordStore) outboundDone(ev *EventAnnounce, published bool) {
+	if !isDurableEvent(ev) {
+		return
+	}
+	k := outboundKey(ev)
+	if published {
+		if err := r.ss.Delete(k); err != nil {
+			log.Warningf("failed to remove outbound announce: %v", err)
+		}
+		return
+	}
+	r.updateOutbound(k, func(entry *outboundAnnounce) {
+		entry.Attempts++
+		entry.NextAttempt = time.Now().Add(retryBackoff(entry.Attempts, minOutboundBackoff, maxOutboundBackoff)).UnixNano()
+	})
+}
+
+// confirmHeads removes queued announces that the delivered heads announce has carried to peers,
+// entries replaced by newer announces of the same record are kept.
+func (r *recordStore) confirmHeads(ev *EventAnnounce) {
+	heads, err := unpackRecordHeads(ev)
+	if err != nil {
+		log.Warningf("failed to unpack record heads: %v", err)
+		return
+	}
+	for _, head := range heads {
+		k := outboundKey(head)
+		var confirmed bool
+		if err := r.ss.View(k, func(k *state.Key, v []byte) error {
+			var entry *outboundAnnounce
+			if err := json.Unmarshal(v, &entry); err != nil || entry == nil {
+				return nil
+			}
+			ann, err := proto.UnpackAnnounce(entry.Announce)
+			if err != nil {
+				return nil
+			}
+			confirmed = ann.Signature() == head.Announce.Signature()
+			return nil
+		}); err != nil && err != state.ErrNotFound {
+			log.Warningf("failed to read outbound announce: %v", err)
+			continue
+		}
+		if !confirmed {
+			continue
+		}
+		if err := r.ss.Delete(k); err != nil {
+			log.Warningf("failed to remove outbound announce: %v", err)
+		}
+	}
+}
+
+func (r *recordStore) updateOutbound(k *state.Key, fn func(entry *outboundAnnounce)) {
+	if err := r.ss.Update(k, func(k *state.Key, v []byte) ([]byte, error) {
+		var entry *outboundAnnounce
+		if err := json.Unmarshal(v, &entry); err != nil || entry == nil {
+			return nil, state.ErrNoUpdate
+		}
+		fn(entry)
+		return json.Marshal(entry)
+	}); err != nil {
+		log.Warningf("failed to update outbound announce: %v", err)
+	}
+}
+
+// retryOutbound replays announces left unsent by the previous run, then periodically
+// re-queues the ones which publishing has failed.
+func (r *recordStore) retryOutbound() {
+	for !r.IsReady() {
+		select {
+		case <-r.outboundStop:
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if n := r.requeueOutbound(time.Time{}); n > 0 {
+		log.Infof("replaying %d unsent announces", n)
+	}
+	t := time.NewTicker(outboundRetryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.outboundStop:
+			return
+		case now := <-t.C:
+			r.requeueOutbound(now)
+		}
+	}
+}
+
+// requeueOutbound queues announces that are due at the time, zero time means all of them.
+func (r *recordStore) requeueOutbound(now time.Time) int {
+	var due []*EventAnnounce
+	var expired []*state.Key
+	if _, err := r.ss.RangePeek(state.NewBucket(state.BucketOutbound), func(k *state.Key, v []byte) error {
+		var entry *outboundAnnounce
+		if err := json.Unmarshal(v, &entry); err != nil || entry == nil {
+			return nil
+		} else if !now.IsZero() && entry.NextAttempt > now.UnixNano() {
+			return nil
+		}
+		seg, err := capn.ReadFromPackedStream(bytes.NewReader(entry.Announce), nil)
+		if err != nil {
+			log.Warningf("skipping malformed outbound announce: %v", err)
+			return nil
+		}
+		ev := &EventAnnounce{
+			Type:     entry.Type,
+			Announce: proto.ReadRootAnnounce(seg),
+		}
+		if signedAt := announceSignedAt(ev); !signedAt.IsZero() && time.Since(signedAt) > durableAnnounceAge {
+			// peers would reject it, the next heads round announces the record instead
+			log.Warningf("dropping outbound announce signed at %s", signedAt.Format(time.RFC3339))
+			expired = append(expired, k)
+			return nil
+		}
+		due = append(due, ev)
+		return nil
+	}); err != nil {
+		log.Warningf("failed to range outbound announces: %v", err)
+		return 0
+	}
+	for _, k := range expired {
+		if err := r.ss.Delete(k); err != nil {
+			log.Warningf("failed to remove outbound announce: %v", err)
+		}
+	}
+	lease := time.Now().Add(maxOutboundBackoff).UnixNano()
+	for i, ev := range due {
+		// postpone the next attempt, so the announce isn't queued twice while in flight
+		r.updateOutbound(outboundKey(ev), func(entry *outboundAnnounce) {
+			entry.NextAttempt = lease
+		})
+		atomic.AddInt64(&r.outboundQueued, 1)
+		select {
+		case <-r.outboundStop:
+			return i
+		case r.outboundPump <- ev:
+		}
+	}
+	return len(due)
+}
+
+// unsentOutbound returns the number of record announces that haven't been published yet.
+func (r *recordStore) unsentOutbound() int {
+	var n int
+	if _, err := r.ss.RangeKeys(state.NewBucket(state.BucketOutbound), func(k *state.Key) error {
+		n++
+		return nil
+	}); err != nil {
+		log.Warningf("failed to count outbound announces: %v", err)
+	}
+	return n
+}
@@ -0,0 +1,99 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestOutboundQueue(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	newEvent := func(typ EventType) *EventAnnounce {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetId(proto.NewID())
+		ann.SetType(proto.AnnounceType(typ))
+		ann.SetEnvelope([]byte("envelope"))
+		return &EventAnnounce{
+			Type:     typ,
+			Announce: ann,
+		}
+	}
+
+	sent, failed := newEvent(EventRecordUpdate), newEvent(EventRecordBatch)
+	r.persistOutbound(sent)
+	r.persistOutbound(failed)
+	require.Equal(2, r.unsentOutbound())
+
+	// in flight announces are not requeued until they fail
+	require.Zero(r.requeueOutbound(time.Now()))
+	r.outboundDone(sent, true)
+	r.outboundDone(failed, false)
+	require.Equal(1, r.unsentOutbound())
+	require.Zero(r.requeueOutbound(time.Now()))
+	require.Equal(1, r.requeueOutbound(time.Now().Add(minOutboundBackoff)))
+	ev := <-r.outboundPump
+	require.Equal(EventRecordBatch, ev.Type)
+	require.Equal(failed.Announce.Id(), ev.Announce.Id())
+	require.Equal([]byte("envelope"), ev.Announce.Envelope())
+
+	// on startup everything left is replayed
+	require.Equal(1, r.requeueOutbound(time.Time{}))
+	<-r.outboundPump
+}
+
+func TestOutboundConfirmHeads(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	newEvent := func(id, sig string) *EventAnnounce {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetId(id)
+		ann.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
+		ann.SetEnvelope([]byte("envelope"))
+		ann.SetSignature(sig)
+		ann.SetNodeID("node")
+		return &EventAnnounce{
+			Type:     EventRecordUpdate,
+			Announce: ann,
+		}
+	}
+	confirmed, replaced := newEvent(proto.NewID(), "a"), newEvent(proto.NewID(), "b")
+	r.persistOutbound(confirmed)
+	r.persistOutbound(replaced)
+	require.Equal(2, r.unsentOutbound())
+
+	e := proto.AutoNewEnvelopeRecordHeads(capn.NewBuffer(nil))
+	e.SetId(proto.NewID())
+	announces := proto.NewAnnounceList(e.Segment, 2)
+	announces.Set(0, confirmed.Announce)
+	// the head of an older version doesn't confirm the queued newer one
+	announces.Set(1, newEvent(replaced.Announce.Id(), "old").Announce)
+	e.SetAnnounces(announces)
+	buf := new(bytes.Buffer)
+	_, err := e.Segment.WriteToPacked(buf)
+	require.NoError(err)
+	heads := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	heads.SetId(proto.NewID())
+	heads.SetType(proto.ANNOUNCETYPE_RECORDHEADS)
+	heads.SetEnvelope(buf.Bytes())
+	heads.SetNodeID("node")
+
+	r.confirmHeads(&EventAnnounce{
+		Type:     EventRecordHeads,
+		Announce: heads,
+	})
+	require.Equal(1, r.unsentOutbound())
+	require.Equal(1, r.requeueOutbound(time.Time{}))
+	require.Equal(replaced.Announce.Signature(), (<-r.outboundPump).Announce.Signature())
+}
@@ -0,0 +1,269 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// errContentUnavailable is returned when an announced object can't be resolved in time.
+var errContentUnavailable = errors.New("announced content is not available")
+
+var (
+	minPendingFetchBackoff = 30 * time.Second
+	maxPendingFetchBackoff = time.Hour
+)
+
+// pendingFetch is an announced update that waits for its content to become available.
+type pendingFetch struct {
+	Type        EventType `json:"type"`
+	Announce    []byte    `json:"announce"`
+	SignedAt    int64     `json:"signedAt"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt int64     `json:"nextAttempt"`
+}
+
+func pendingFetchBackoff(attempts int) time.Duration {
+	return retryBackoff(attempts, minPendingFetchBackoff, maxPendingFetchBackoff)
+}
+
+// retryBackoff doubles the delay for every attempt after the first one.
+func retryBackoff(attempts int, min, max time.Duration) time.Duration {
+	backoff := min
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
+
+// pendingFetchID returns the ID the update is queued by: the record ID for a record update,
+// and the batch ID for a batch, so a newer announce replaces the queued one.
+func pendingFetchID(ev *EventAnnounce) (string, error) {
+	switch ev.Type {
+	case EventRecordUpdate:
+		update, err := proto.UnpackEnvelopeRecordUpdate(ev.Announce.Envelope())
+		if err != nil {
+			return "", err
+		}
+		return update.Id(), nil
+	case EventRecordBatch:
+		batch, err := proto.UnpackEnvelopeRecordBatch(ev.Announce.Envelope())
+		if err != nil {
+			return "", err
+		}
+		return batch.Id(), nil
+	default:
+		return "", errors.New("not a record event")
+	}
+}
+
+// pendingVersions lists versions announced by the update, by record ID.
+func pendingVersions(ev *EventAnnounce) (map[string]string, error) {
+	var updates []proto.EnvelopeRecordUpdate
+	switch ev.Type {
+	case EventRecordUpdate:
+		update, err := proto.UnpackEnvelopeRecordUpdate(ev.Announce.Envelope())
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, update)
+	case EventRecordBatch:
+		batch, err := proto.UnpackEnvelopeRecordBatch(ev.Announce.Envelope())
+		if err != nil {
+			return nil, err
+		}
+		updates = batch.Updates().ToArray()
+	default:
+		return nil, errors.New("not a record event")
+	}
+	versions := make(map[string]string, len(updates))
+	for _, update := range updates {
+		versions[update.Id()] = update.Version()
+	}
+	return versions, nil
+}
+
+func packAnnounce(ann proto.Announce) ([]byte, error) {
+	a := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	a.SetId(ann.Id())
+	a.SetType(ann.Type())
+	a.SetEnvelope(ann.Envelope())
+	a.SetSignature(ann.Signature())
+	a.SetTimestamp(ann.Timestamp())
+	a.SetNodeID(ann.NodeID())
+	buf := new(bytes.Buffer)
+	if _, err := a.Segment.WriteToPacked(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addPendingFetch queues the update for retries, unless one signed later is queued already.
+func (r *recordStore) addPendingFetch(ev *EventAnnounce) {
+	id, err := pendingFetchID(ev)
+	if err != nil {
+		log.Warningf("failed to queue pending fetch: %v", err)
+		return
+	}
+	data, err := packAnnounce(ev.Announce)
+	if err != nil {
+		log.Warningf("failed to queue pending fetch: %v", err)
+		return
+	}
+	entry := &pendingFetch{
+		Type:        ev.Type,
+		Announce:    data,
+		SignedAt:    announceSignedAt(ev).UnixNano(),
+		Attempts:    1,
+		NextAttempt: time.Now().Add(pendingFetchBackoff(1)).UnixNano(),
+	}
+	if err := r.ss.Update(state.NewKey(state.BucketPendingFetch, []byte(id)), func(k *state.Key, v []byte) ([]byte, error) {
+		var queued *pendingFetch
+		if err := json.Unmarshal(v, &queued); err == nil && queued != nil && queued.SignedAt > entry.SignedAt {
+			return nil, state.ErrNoUpdate
+		}
+		return json.Marshal(entry)
+	}); err != nil {
+		log.Warningf("failed to queue pending fetch: %v", err)
+	}
+}
+
+// PendingFetches returns the number of announced updates waiting for their content.
+func (r *recordStore) PendingFetches() int {
+	var n int
+	if _, err := r.ss.RangeKeys(state.NewBucket(state.BucketPendingFetch), func(k *state.Key) error {
+		n++
+		return nil
+	}); err != nil {
+		log.Warningf("failed to count pending fetches: %v", err)
+	}
+	return n
+}
+
+// RetryPendingFetches periodically retries updates which content hasn't been available when
+// they were announced, with exponential backoff. An update is dropped when it has been applied
+// or when the records got newer versions meanwhile.
+func (r *recordStore) RetryPendingFetches(ctx context.Context, dur, timeout time.Duration) {
+	t := time.NewTimer(dur)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if n, err := r.retryPendingFetches(ctx, time.Now(), timeout); err != nil {
+				log.Warningf("pending fetch retry failed: %v", err)
+			} else if n > 0 {
+				log.Infof("applied %d pending updates", n)
+			}
+			t.Reset(dur)
+		}
+	}
+}
+
+func (r *recordStore) retryPendingFetches(ctx context.Context, now time.Time, timeout time.Duration) (int, error) {
+	type dueFetch struct {
+		key   *state.Key
+		entry *pendingFetch
+	}
+	var due []dueFetch
+	if _, err := r.ss.RangePeek(state.NewBucket(state.BucketPendingFetch), func(k *state.Key, v []byte) error {
+		var entry *pendingFetch
+		if err := json.Unmarshal(v, &entry); err != nil || entry == nil {
+			return nil
+		} else if entry.NextAttempt > now.UnixNano() {
+			return nil
+		}
+		due = append(due, dueFetch{k, entry})
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	var applied int
+	for _, f := range due {
+		if ctx.Err() != nil {
+			return applied, ctx.Err()
+		}
+		seg, err := capn.ReadFromPackedStream(bytes.NewReader(f.entry.Announce), nil)
+		if err != nil {
+			log.Warningf("dropping malformed pending fetch: %v", err)
+			r.ss.Delete(f.key)
+			continue
+		}
+		ev := &EventAnnounce{
+			Type:     f.entry.Type,
+			Announce: proto.ReadRootAnnounce(seg),
+		}
+		if r.isUpdateSuperseded(ev) {
+			r.ss.Delete(f.key)
+			continue
+		}
+		fields := log.Fields{
+			"OwnerID":  ev.Announce.NodeID(),
+			"Attempts": f.entry.Attempts,
+		}
+		switch ev.Type {
+		case EventRecordBatch:
+			err = r.handleRecordBatch(ev, fields, timeout)
+		default:
+			err = r.applyRecordUpdate(ev, fields, timeout)
+		}
+		if err == errContentUnavailable {
+			f.entry.Attempts++
+			f.entry.NextAttempt = now.Add(pendingFetchBackoff(f.entry.Attempts)).UnixNano()
+			if err := r.ss.Update(f.key, func(k *state.Key, v []byte) ([]byte, error) {
+				return json.Marshal(f.entry)
+			}); err != nil {
+				log.Warningf("failed to update pending fetch: %v", err)
+			}
+			continue
+		}
+		if err := r.ss.Delete(f.key); err != nil {
+			log.Warningf("failed to remove pending fetch: %v", err)
+		}
+		applied++
+		r.inboundWork()
+	}
+	return applied, nil
+}
+
+// isUpdateSuperseded checks if all records of the update already have the announced versions
+// in their version chains, or have current versions signed after the update.
+func (r *recordStore) isUpdateSuperseded(ev *EventAnnounce) bool {
+	versions, err := pendingVersions(ev)
+	if err != nil {
+		return true
+	}
+	signedAt := announceSignedAt(ev).UnixNano()
+	for id, version := range versions {
+		var superseded bool
+		if err := r.ss.View(state.NewKey(state.BucketRecords, []byte(id)), proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+			if v == nil {
+				return nil
+			} else if hasRecordVersion(v, version) {
+				superseded = true
+				return nil
+			}
+			current := v.Current().Announce()
+			superseded = proto.AnnounceSignedAt(current.Type(), current) > signedAt
+			return nil
+		})); err != nil || !superseded {
+			return false
+		}
+	}
+	return true
+}
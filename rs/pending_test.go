@@ -0,0 +1,70 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestPendingFetches(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	id := proto.NewID()
+	newEvent := func(version string, signedAt int64) *EventAnnounce {
+		ann := newTestUpdate(t, id, version, func(e proto.EnvelopeRecordUpdate) {
+			e.SetSignedAt(signedAt)
+		})
+		return &EventAnnounce{
+			Type:     EventRecordUpdate,
+			Announce: ann,
+		}
+	}
+
+	// an update signed later for the same record replaces the queued one, earlier is ignored
+	r.addPendingFetch(newEvent("v2", 2))
+	r.addPendingFetch(newEvent("v3", 3))
+	r.addPendingFetch(newEvent("v1", 1))
+	require.Equal(1, r.PendingFetches())
+	require.False(r.isUpdateSuperseded(newEvent("v3", 3)))
+
+	// not due yet
+	n, err := r.retryPendingFetches(context.Background(), time.Now(), time.Second)
+	require.NoError(err)
+	require.Zero(n)
+	require.Equal(1, r.PendingFetches())
+
+	// the unsigned announce timestamp of the stored version doesn't supersede the update
+	ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+	ann.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
+	ann.SetEnvelope(newTestUpdate(t, id, "v2", func(e proto.EnvelopeRecordUpdate) {
+		e.SetSignedAt(2)
+	}).Envelope())
+	ann.SetTimestamp(time.Now().Add(time.Hour).UnixNano())
+	putTestRecord(t, r, newTestRecord(id, "", &ann, "v1", "v2"))
+	require.False(r.isUpdateSuperseded(newEvent("v3", 3)))
+	// the current version has been signed after the update
+	require.True(r.isUpdateSuperseded(newEvent("v0", 1)))
+
+	// the record has got the version from another announce meanwhile
+	putTestRecord(t, r, newTestRecord(id, "", &ann, "v1", "v2", "v3"))
+	require.True(r.isUpdateSuperseded(newEvent("v3", 3)))
+
+	n, err = r.retryPendingFetches(context.Background(), time.Now().Add(time.Hour), time.Second)
+	require.NoError(err)
+	require.Zero(n)
+	require.Zero(r.PendingFetches())
+
+	require.Equal(minPendingFetchBackoff, pendingFetchBackoff(1))
+	require.Equal(4*minPendingFetchBackoff, pendingFetchBackoff(3))
+	require.Equal(maxPendingFetchBackoff, pendingFetchBackoff(100))
+}
@@ -0,0 +1,190 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// recoveryMark is kept for records rebuilt from the pinset, their versions have no signed
+// announces until a valid copy of the record is received from peers.
+type recoveryMark struct {
+	ID          string `json:"id"`
+	Version     string `json:"version"`
+	RecoveredAt int64  `json:"recoveredAt"`
+}
+
+// RecoveryStats reports the result of RecoverRecords.
+type RecoveryStats struct {
+	// Objects is the number of pinned object versions found.
+	Objects int
+	// Records is the number of records rebuilt.
+	Records int
+	// Existing is the number of records skipped, because they are present in the state.
+	Existing int
+	// Forks is the number of records with diverged version chains, the longest chain is used.
+	Forks int
+}
+
+// RecoverRecords rebuilds records from object versions pinned in the file store, versions
+// of a record are chained by their VersionPrevious links. Records that exist in the state are
+// left intact. Rebuilt records lack signed announces, so they are marked as recovered and get
+// replaced by the first valid copy received from peers during sync.
+func RecoverRecords(ctx context.Context, fileStore fs.PlanetaryFileStore,
+	stateStore state.IndexedStore) (*RecoveryStats, error) {
+	objects, err := fileStore.ListPinnedObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := &RecoveryStats{
+		Objects: len(objects),
+	}
+	byID := make(map[string]map[string]*fs.ObjectRef)
+	for i := range objects {
+		obj := &objects[i]
+		if byID[obj.ID] == nil {
+			byID[obj.ID] = make(map[string]*fs.ObjectRef)
+		}
+		byID[obj.ID][obj.Version] = obj
+	}
+	now := time.Now().UnixNano()
+	for id, versions := range byID {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+		chain, forked := recoverVersionChain(versions)
+		if forked {
+			stats.Forks++
+		}
+		record := newRecoveredRecord(chain)
+		var created bool
+		k := state.NewKey(state.BucketRecords, []byte(id))
+		if err := stateStore.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+			if v != nil {
+				return nil, state.ErrNoUpdate
+			}
+			created = true
+			return record, nil
+		})); err != nil {
+			return stats, err
+		} else if !created {
+			stats.Existing++
+			continue
+		}
+		stats.Records++
+		if err := indexRecordPath(stateStore, id, record.Path()); err != nil {
+			log.Warningf("failed to index path of recovered record: %v", err)
+		}
+		head := chain[len(chain)-1]
+		mark := &recoveryMark{
+			ID:          id,
+			Version:     head.Version,
+			RecoveredAt: now,
+		}
+		if err := stateStore.Update(state.NewKey(state.BucketRecovered, []byte(id)), func(k *state.Key, v []byte) ([]byte, error) {
+			return json.Marshal(mark)
+		}); err != nil {
+			return stats, err
+		}
+		if head.ExpiresAt > 0 && !head.Meta().IsDeleted() {
+			if err := addExpiryEntry(stateStore, &expiryEntry{
+				ID:        id,
+				Version:   head.Version,
+				ExpiresAt: head.ExpiresAt,
+			}); err != nil {
+				log.Warningf("failed to index expiry of recovered record: %v", err)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// recoverVersionChain orders versions of a record from the oldest to the newest. Versions
+// not referenced by any other are heads, if there are many the longest chain wins, then the
+// newest one.
+func recoverVersionChain(versions map[string]*fs.ObjectRef) ([]*fs.ObjectRef, bool) {
+	referenced := make(map[string]bool, len(versions))
+	for _, obj := range versions {
+		referenced[obj.VersionPrevious] = true
+	}
+	var best []*fs.ObjectRef
+	var heads int
+	for version, obj := range versions {
+		if referenced[version] {
+			continue
+		}
+		heads++
+		var chain []*fs.ObjectRef
+		for obj != nil && len(chain) < len(versions) {
+			chain = append([]*fs.ObjectRef{obj}, chain...)
+			obj = versions[obj.VersionPrevious]
+		}
+		if best == nil || isBetterChain(chain, best) {
+			best = chain
+		}
+	}
+	if best == nil {
+		// all versions are referenced, that's a cycle which is not possible with CIDs
+		for _, obj := range versions {
+			if best == nil || obj.Version > best[0].Version {
+				best = []*fs.ObjectRef{obj}
+			}
+		}
+	}
+	return best, heads > 1
+}
+
+func isBetterChain(chain, than []*fs.ObjectRef) bool {
+	if len(chain) != len(than) {
+		return len(chain) > len(than)
+	}
+	head, thanHead := chain[len(chain)-1], than[len(than)-1]
+	if ts, thanTs := head.Meta().CreatedAt(), thanHead.Meta().CreatedAt(); ts != thanTs {
+		return ts > thanTs
+	}
+	return head.Version > thanHead.Version
+}
+
+func newRecoveredRecord(chain []*fs.ObjectRef) *proto.Record {
+	newVersion := func(obj *fs.ObjectRef) proto.RecordVersion {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
+		ann.SetTimestamp(obj.Meta().CreatedAt())
+		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetAnnounce(ann)
+		ver.SetVersion(obj.Version)
+		return ver
+	}
+	head := chain[len(chain)-1]
+	record := proto.AutoNewRecord(capn.NewBuffer(nil))
+	record.SetId(head.ID)
+	record.SetPath(head.Path)
+	record.SetCreatedAt(chain[0].Meta().CreatedAt())
+	record.SetCurrent(newVersion(head))
+	previous := proto.NewRecordVersionList(capn.NewBuffer(nil), len(chain)-1)
+	for i, obj := range chain[:len(chain)-1] {
+		previous.Set(i, newVersion(obj))
+	}
+	record.SetPrevious(previous)
+	return &record
+}
+
+// isRecoveredRecord checks whether the record has been rebuilt from the pinset and still waits
+// for a copy with signed announces.
+func isRecoveredRecord(ss state.IndexedStore, id string) bool {
+	err := ss.View(state.NewKey(state.BucketRecovered, []byte(id)), func(k *state.Key, v []byte) error {
+		return nil
+	})
+	return err == nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestRecoverVersionChain(t *testing.T) {
+	require := require.New(t)
+
+	id := proto.NewID()
+	versions := make(map[string]*fs.ObjectRef)
+	addVersion := func(version, prev string, createdAt int64) {
+		meta := proto.AutoNewObjectMeta(capn.NewBuffer(nil))
+		meta.SetCreatedAt(createdAt)
+		obj := &fs.ObjectRef{
+			ID:              id,
+			Path:            "/recover/test",
+			Version:         version,
+			VersionPrevious: prev,
+		}
+		obj.SetMeta(&meta)
+		versions[version] = obj
+	}
+	versionsOf := func(chain []*fs.ObjectRef) []string {
+		var list []string
+		for _, obj := range chain {
+			list = append(list, obj.Version)
+		}
+		return list
+	}
+
+	// the oldest version has been unpinned by retention
+	addVersion("b", "a", 2)
+	addVersion("c", "b", 3)
+	addVersion("d", "c", 4)
+	chain, forked := recoverVersionChain(versions)
+	require.False(forked)
+	require.Equal([]string{"b", "c", "d"}, versionsOf(chain))
+
+	// a fork of equal length is resolved by the newest head
+	addVersion("e", "c", 5)
+	chain, forked = recoverVersionChain(versions)
+	require.True(forked)
+	require.Equal([]string{"b", "c", "e"}, versionsOf(chain))
+
+	// the longest chain wins
+	addVersion("f", "d", 1)
+	chain, _ = recoverVersionChain(versions)
+	require.Equal([]string{"b", "c", "d", "f"}, versionsOf(chain))
+
+	record := newRecoveredRecord(chain)
+	require.Equal(id, record.Id())
+	require.Equal("f", record.Current().Version())
+	require.Equal(3, record.Previous().Len())
+	require.Equal(int64(2), record.CreatedAt())
+	require.Empty(record.Current().Announce().Signature())
+}
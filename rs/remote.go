@@ -10,6 +10,9 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -30,6 +33,7 @@ const (
 
 func (r *recordStore) aliveNodes(ctx context.Context, nodeIDs []string) []string {
 	alive := make(map[string]struct{}, 100)
+	aliveMux := new(sync.Mutex)
 	wg := new(sync.WaitGroup)
 	ctx, cancelFn := context.WithTimeout(ctx, 15*time.Second)
 	defer cancelFn()
@@ -39,7 +43,9 @@ func (r *recordStore) aliveNodes(ctx context.Context, nodeIDs []string) []string
 			defer wg.Done()
 			r.outboundWork()
 			if state := r.pingNode(ctx, nodeID); state == stateAlive {
+				aliveMux.Lock()
 				alive[nodeID] = struct{}{}
+				aliveMux.Unlock()
 			}
 		}(nodeID)
 	}
@@ -74,8 +80,22 @@ func (r *recordStore) pingNode(ctx context.Context, nodeID string) nodeState {
 	return stateAlive
 }
 
-func (r *recordStore) getNodeRecords(ctx context.Context, nodeID string, rC chan<- *proto.Record) error {
+func (r *recordStore) getNodeRecords(ctx context.Context, nodeID string, opt ExportOptions, rC chan<- *proto.Record) error {
 	u := fmt.Sprintf("http://%s/private/v1/records", nodeID)
+	query := url.Values{}
+	if opt.Since > 0 {
+		query.Set("since", strconv.FormatInt(opt.Since, 10))
+	}
+	if len(opt.Buckets) > 0 {
+		buckets := make([]string, 0, len(opt.Buckets))
+		for _, b := range opt.Buckets {
+			buckets = append(buckets, strconv.Itoa(b))
+		}
+		query.Set("buckets", strings.Join(buckets, ","))
+	}
+	if len(query) > 0 {
+		u = u + "?" + query.Encode()
+	}
 	req, _ := http.NewRequest("GET", u, nil)
 	req = req.WithContext(ctx)
 	resp, err := r.fs.Client().Do(req)
@@ -104,7 +124,9 @@ func (r *recordStore) getNodeRecords(ctx context.Context, nodeID string, rC chan
 	}
 }
 
-func (r *recordStore) collectRecords(ctx context.Context, peers []string, rC chan<- *proto.Record) {
+// collectRecords fetches records from peers, incrementally since the sync cursor of each peer.
+// IDs of peers that have been collected completely are sent to doneC.
+func (r *recordStore) collectRecords(ctx context.Context, peers []string, rC chan<- *proto.Record, doneC chan<- string) {
 	defer close(rC)
 	log.Debugln("collecting records from:", peers)
 
@@ -114,9 +136,19 @@ func (r *recordStore) collectRecords(ctx context.Context, peers []string, rC cha
 		go func(nodeID string) {
 			defer wg.Done()
 			r.outboundWork()
-			if err := r.getNodeRecords(ctx, nodeID, rC); err != nil {
+			since, err := r.syncCursor(nodeID)
+			if err != nil {
+				log.WithField("nodeID", nodeID).Warningf("failed to load sync cursor: %v", err)
+			} else if since > 0 {
+				log.WithField("nodeID", nodeID).Debugln("collecting records since", time.Unix(0, since))
+			}
+			if err := r.getNodeRecords(ctx, nodeID, ExportOptions{
+				Since: since,
+			}, rC); err != nil {
 				log.WithField("nodeID", nodeID).Warningf("failed to get node records: %v", err)
+				return
 			}
+			doneC <- nodeID
 		}(nodeID)
 	}
 	wg.Wait()
@@ -0,0 +1,116 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+var (
+	defaultClockSkew = 10 * time.Minute
+	// seenAnnounceTTL is used when the clock skew check is disabled.
+	seenAnnounceTTL = 24 * time.Hour
+	// durableAnnounceAge is how long ago record announces may have been signed, they are
+	// replayed from the outbound queue after restarts and publishing backoffs.
+	durableAnnounceAge = 24 * time.Hour
+)
+
+// ClockSkewOpt sets the maximum difference between the signed time of an announce and the local
+// clock, announces outside of the window are rejected. Zero disables the check.
+func ClockSkewOpt(skew time.Duration) StoreOpt {
+	return func(r *recordStore) {
+		r.clockSkew = skew
+	}
+}
+
+// AnnounceStats counts received announces rejected by the store.
+type AnnounceStats struct {
+	// Replayed is the number of announces that have been processed already.
+	Replayed uint64 `json:"replayed_total"`
+	// Skewed is the number of announces signed outside of the clock skew window.
+	Skewed uint64 `json:"skewed_total"`
+	// VersionMismatch is the number of updates not based on the local current version
+	// that lost the fork resolution.
+	VersionMismatch uint64 `json:"version_mismatch_total"`
+}
+
+// AnnounceStats returns the rejected announce counters.
+func (r *recordStore) AnnounceStats() *AnnounceStats {
+	return &AnnounceStats{
+		Replayed:        r.announces.rejectedTotal(RejectReplayed),
+		Skewed:          r.announces.rejectedTotal(RejectSkewed),
+		VersionMismatch: r.announces.rejectedTotal(RejectVersionMismatch),
+	}
+}
+
+// announceSignedAt returns the time covered by the announce signature, the announce timestamp
+// isn't signed, so it's taken from the envelope. Record updates of older nodes fall back to
+// the announce timestamp, see proto.AnnounceSignedAt. Zero time means there is none.
+func announceSignedAt(ev *EventAnnounce) time.Time {
+	ts := proto.AnnounceSignedAt(proto.AnnounceType(ev.Type), ev.Announce)
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ts)
+}
+
+// announceMaxAge returns how long ago the announce may have been signed to be accepted.
+func (r *recordStore) announceMaxAge(ev *EventAnnounce) time.Duration {
+	if isDurableEvent(ev) && durableAnnounceAge > r.clockSkew {
+		return durableAnnounceAge
+	}
+	return r.clockSkew
+}
+
+// isTimestampValid checks that the announce has been signed within the clock skew window,
+// record announces may be older, see durableAnnounceAge. Announces without a signed time
+// are rejected.
+func (r *recordStore) isTimestampValid(ev *EventAnnounce, now time.Time) bool {
+	if r.clockSkew <= 0 {
+		return true
+	}
+	signedAt := announceSignedAt(ev)
+	if signedAt.IsZero() || signedAt.Before(now.Add(-r.announceMaxAge(ev))) || signedAt.After(now.Add(r.clockSkew)) {
+		r.announces.countRejected(ev.Type, RejectSkewed)
+		return false
+	}
+	return true
+}
+
+// markAnnounceSeen remembers a validated announce and reports whether it's new. Announces are
+// identified by their signed envelope, because the announce ID and timestamp aren't signed.
+// Entries are kept until the signed time of the announce leaves the accepted window, so
+// a replay is rejected either as seen or by the timestamp check.
+func (r *recordStore) markAnnounceSeen(ev *EventAnnounce) bool {
+	data := append([]byte(ev.Type.String()), ev.Announce.Envelope()...)
+	k := state.NewHashedKey(state.BucketSeenAnnounces, data)
+	k.TTL = seenAnnounceTTL
+	if signedAt := announceSignedAt(ev); r.clockSkew > 0 && !signedAt.IsZero() {
+		// a minute on top covers the TTL granularity of the store
+		k.TTL = time.Until(signedAt.Add(r.announceMaxAge(ev))) + time.Minute
+	}
+	seen := false
+	if err := r.ss.Update(k, func(k *state.Key, v []byte) ([]byte, error) {
+		if v != nil {
+			seen = true
+			return nil, state.ErrNoUpdate
+		}
+		return []byte(strconv.FormatInt(ev.Announce.Timestamp(), 10)), nil
+	}); err != nil {
+		log.Warningf("failed to mark announce as seen: %v", err)
+	}
+	// the announce is valid, so further copies are not even queued
+	r.recent.add(ev)
+	if seen {
+		r.announces.countRejected(ev.Type, RejectReplayed)
+	}
+	return !seen
+}
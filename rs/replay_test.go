@@ -0,0 +1,117 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/oklog/ulid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestAnnounceReplay(t *testing.T) {
+	require := require.New(t)
+
+	r := newTestStore(t)
+	r.clockSkew = time.Minute
+	now := time.Now()
+	// the envelope ID is the signed time of a beat tick
+	newTick := func(session string, signedAt time.Time) []byte {
+		tick := proto.AutoNewEnvelopeBeatTick(capn.NewBuffer(nil))
+		tick.SetId(ulid.MustNew(ulid.Timestamp(signedAt), rand.Reader).String())
+		tick.SetSession(session)
+		buf := new(bytes.Buffer)
+		_, err := tick.Segment.WriteToPacked(buf)
+		require.NoError(err)
+		return buf.Bytes()
+	}
+	newEvent := func(envelope []byte, ts time.Time) *EventAnnounce {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetId(proto.NewID())
+		ann.SetType(proto.ANNOUNCETYPE_BEATTICK)
+		ann.SetEnvelope(envelope)
+		ann.SetTimestamp(ts.UnixNano())
+		return &EventAnnounce{
+			Type:     EventBeatTick,
+			Announce: ann,
+		}
+	}
+
+	require.True(r.isTimestampValid(newEvent(newTick("s", now.Add(-30*time.Second)), now), now))
+	require.False(r.isTimestampValid(newEvent(newTick("s", now.Add(-time.Hour)), now), now))
+	require.False(r.isTimestampValid(newEvent(newTick("s", now.Add(time.Hour)), now), now))
+	// the announce timestamp isn't signed, so it's not trusted
+	require.True(r.isTimestampValid(newEvent(newTick("s", now), now.Add(-time.Hour)), now))
+	require.False(r.isTimestampValid(newEvent(newTick("s", now.Add(-time.Hour)), now), now))
+
+	// a replay is detected by the signed envelope, even with a new ID and timestamp
+	tick := newTick("s1", now)
+	require.True(r.markAnnounceSeen(newEvent(tick, now)))
+	require.False(r.markAnnounceSeen(newEvent(tick, now.Add(time.Second))))
+	require.True(r.markAnnounceSeen(newEvent(newTick("s2", now), now)))
+
+	require.Equal(&AnnounceStats{
+		Replayed: 1,
+		Skewed:   3,
+	}, r.AnnounceStats())
+	require.Equal(map[string]uint64{
+		RejectReplayed: 1,
+		RejectSkewed:   3,
+	}, r.StoreMetrics().Rejected[EventBeatTick])
+
+	// record updates of older nodes have no signed time, the announce timestamp is checked instead
+	legacy := func(ts time.Time) *EventAnnounce {
+		ann := newTestUpdate(t, proto.NewID(), "", nil)
+		ann.SetTimestamp(ts.UnixNano())
+		return &EventAnnounce{
+			Type:     EventRecordUpdate,
+			Announce: ann,
+		}
+	}
+	require.True(r.isTimestampValid(legacy(now), now))
+	require.False(r.isTimestampValid(legacy(now.Add(-2*durableAnnounceAge)), now))
+	require.False(r.isTimestampValid(legacy(time.Unix(0, 0)), now))
+}
+
+func TestDurableAnnounceReplay(t *testing.T) {
+	require := require.New(t)
+
+	sender, receiver := newTestStore(t), newTestStore(t)
+	receiver.clockSkew = 10 * time.Minute
+	now := time.Now()
+	newUpdate := func(signedAt time.Time) *EventAnnounce {
+		ann := newTestUpdate(t, proto.NewID(), "version", func(e proto.EnvelopeRecordUpdate) {
+			e.SetSignedAt(signedAt.UnixNano())
+		})
+		ann.SetTimestamp(signedAt.UnixNano())
+		return &EventAnnounce{
+			Type:     EventRecordUpdate,
+			Announce: ann,
+		}
+	}
+
+	// left unsent for longer than the clock skew, e.g. across a restart
+	stale := newUpdate(now.Add(-30 * time.Minute))
+	expired := newUpdate(now.Add(-durableAnnounceAge - time.Hour))
+	sender.persistOutbound(stale)
+	sender.persistOutbound(expired)
+	require.Equal(1, sender.requeueOutbound(time.Time{}))
+	require.Equal(1, sender.unsentOutbound())
+	ev := <-sender.outboundPump
+	require.Equal(stale.Announce.Id(), ev.Announce.Id())
+
+	// the replayed announce is accepted once, even though its signed time is outside of the skew
+	require.True(receiver.isTimestampValid(ev, now))
+	require.True(receiver.markAnnounceSeen(ev))
+	require.False(receiver.markAnnounceSeen(ev))
+	require.False(receiver.isTimestampValid(expired, now))
+	require.False(receiver.isTimestampValid(newUpdate(now.Add(time.Hour)), now))
+}
@@ -0,0 +1,56 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+func TestRestoreCurrentVersion(t *testing.T) {
+	require := require.New(t)
+
+	defaultAuth := authcenter.Default
+	authcenter.Default = testAuth{}
+	defer func() {
+		authcenter.Default = defaultAuth
+	}()
+	id := proto.NewID()
+	ref := &fs.ObjectRef{
+		ID:      id,
+		Path:    "/restore/test",
+		Version: "v2",
+	}
+	meta := proto.AutoNewObjectMeta(capn.NewBuffer(nil))
+	ref.SetMeta(&meta)
+	r := newTestStore(t)
+	r.fs = &testFileStore{
+		objects: map[string]*fs.ObjectRef{
+			"v2": ref,
+		},
+	}
+	putTestRecord(t, r, newTestRecord(id, ref.Path, nil, "v1", "v2"))
+
+	// restoring the current version is a no-op
+	rec, err := r.RestoreRecord(context.Background(), id, "v2")
+	require.NoError(err)
+	require.Equal("v2", rec.Object.Version)
+	require.NoError(r.ss.View(state.NewKey(state.BucketRecords, []byte(id)),
+		proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+			require.NotNil(v)
+			require.Equal(id, v.Id())
+			require.Equal("v2", v.Current().Version())
+			require.Equal(1, v.Previous().Len())
+			return nil
+		})))
+}
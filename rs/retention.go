@@ -0,0 +1,187 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// RetentionRule specifies how many previous versions of records under the prefix are kept.
+type RetentionRule struct {
+	Prefix string
+	// MaxVersions is the number of previous versions to keep, the current version is always kept.
+	MaxVersions int
+	// MaxAge if set, removes previous versions that are older.
+	MaxAge time.Duration
+	// KeepAll disables removal of any versions.
+	KeepAll bool
+}
+
+// DefaultRetentionRule applies to records that don't match any rule of the policy.
+var DefaultRetentionRule = RetentionRule{
+	MaxVersions: 3,
+}
+
+// RetentionPolicy is a set of retention rules, the rule with the longest matching prefix wins.
+type RetentionPolicy []RetentionRule
+
+// ParseRetentionPolicy parses rules in form of "prefix:versions[:maxage]", versions
+// can be "all" to keep every version. An empty prefix overrides the default rule.
+func ParseRetentionPolicy(specs []string) (RetentionPolicy, error) {
+	policy := make(RetentionPolicy, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if len(spec) == 0 {
+			continue
+		}
+		parts := strings.Split(spec, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return nil, fmt.Errorf("invalid retention rule %s: expected prefix:versions[:maxage]", spec)
+		}
+		rule := RetentionRule{
+			Prefix: parts[0],
+		}
+		if parts[1] == "all" {
+			rule.KeepAll = true
+		} else if n, err := strconv.Atoi(parts[1]); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid retention rule %s: versions must be a non-negative number or all", spec)
+		} else {
+			rule.MaxVersions = n
+		}
+		if len(parts) == 3 {
+			if rule.KeepAll {
+				return nil, fmt.Errorf("invalid retention rule %s: max age can't be used with all", spec)
+			}
+			dur, err := time.ParseDuration(parts[2])
+			if err != nil || dur <= 0 {
+				return nil, fmt.Errorf("invalid retention rule %s: bad max age", spec)
+			}
+			rule.MaxAge = dur
+		}
+		policy = append(policy, rule)
+	}
+	return policy, nil
+}
+
+// Rule returns the retention rule for the record path.
+func (p RetentionPolicy) Rule(path string) RetentionRule {
+	rule := DefaultRetentionRule
+	matched := -1
+	for _, r := range p {
+		if len(r.Prefix) > matched && strings.HasPrefix(path, r.Prefix) {
+			rule = r
+			matched = len(r.Prefix)
+		}
+	}
+	return rule
+}
+
+// PinDepth returns the number of previous versions to keep pinned, negative means all.
+func (p RetentionPolicy) PinDepth(path string) int {
+	if rule := p.Rule(path); !rule.KeepAll {
+		return rule.MaxVersions
+	}
+	return -1
+}
+
+// retainVersions splits the previous versions (oldest first) into kept and removed.
+func retainVersions(list proto.RecordVersion_List, rule RetentionRule, now time.Time) (proto.RecordVersion_List, []string) {
+	if rule.KeepAll {
+		return list, nil
+	}
+	var cutoff int64
+	if rule.MaxAge > 0 {
+		cutoff = now.Add(-rule.MaxAge).UnixNano()
+	}
+	versions := list.ToArray()
+	kept := make([]proto.RecordVersion, 0, len(versions))
+	var removed []string
+	for i, ver := range versions {
+		newer := len(versions) - 1 - i
+		if newer >= rule.MaxVersions {
+			removed = append(removed, ver.Version())
+			continue
+		} else if ts := ver.Announce().Timestamp(); cutoff > 0 && ts > 0 && ts < cutoff {
+			removed = append(removed, ver.Version())
+			continue
+		}
+		kept = append(kept, ver)
+	}
+	if len(removed) == 0 {
+		return list, nil
+	}
+	newList := proto.NewRecordVersionList(capn.NewBuffer(nil), len(kept))
+	for i, ver := range kept {
+		newList.Set(i, ver)
+	}
+	return newList, removed
+}
+
+// GC removes previous versions of records according to the retention policy and unpins them.
+func GC(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore, policy RetentionPolicy) error {
+	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	now := time.Now()
+	_, err := stateStore.RangeModify(b, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+		newPrevious, removed := retainVersions(v.Previous(), policy.Rule(v.Path()), now)
+		if len(removed) == 0 {
+			return nil, state.ErrNoUpdate
+		}
+		rec := proto.AutoNewRecord(capn.NewBuffer(nil))
+		rec.SetId(v.Id())
+		rec.SetPath(v.Path())
+		rec.SetCreatedAt(v.CreatedAt())
+		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetAnnounce(v.Current().Announce())
+		ver.SetVersion(v.Current().Version())
+		rec.SetCurrent(ver)
+		rec.SetPrevious(newPrevious)
+		for _, versionID := range removed {
+			if err := fileStore.UnpinObject(fs.ObjectRef{
+				Version: versionID,
+			}); err != nil {
+				log.Debugln("failed to unpin during GC:", versionID, err)
+			}
+		}
+		return &rec, nil
+	}))
+	return err
+}
+
+// Retention returns the version retention policy of the store.
+func (r *recordStore) Retention() RetentionPolicy {
+	return r.retention
+}
+
+// RunGC periodically removes the versions that are out of the retention policy,
+// e.g. the ones that have exceeded max age.
+func (r *recordStore) RunGC(ctx context.Context, dur time.Duration) {
+	t := time.NewTimer(dur)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := GC(r.fs, r.ss, r.retention); err != nil {
+				log.Warningf("record GC failed: %v", err)
+			} else {
+				log.Debugln("record GC completed")
+			}
+			t.Reset(dur)
+		}
+	}
+}
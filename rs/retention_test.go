@@ -0,0 +1,80 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"testing"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	require := require.New(t)
+
+	policy, err := ParseRetentionPolicy([]string{
+		"/beat_reports/:0", "/legal/:all", "/legal/drafts/:5:24h", ":10",
+	})
+	require.NoError(err)
+	require.Equal(RetentionRule{Prefix: "/beat_reports/"}, policy.Rule("/beat_reports/0xabc.json"))
+	require.True(policy.Rule("/legal/contract.pdf").KeepAll)
+	require.Equal(-1, policy.PinDepth("/legal/contract.pdf"))
+	require.Equal(RetentionRule{
+		Prefix:      "/legal/drafts/",
+		MaxVersions: 5,
+		MaxAge:      24 * time.Hour,
+	}, policy.Rule("/legal/drafts/a.txt"))
+	require.Equal(10, policy.PinDepth("/other"))
+
+	var empty RetentionPolicy
+	require.Equal(DefaultRetentionRule, empty.Rule("/other"))
+
+	for _, spec := range []string{"/a/", "/a/:-1", "/a/:x", "/a/:all:1h", "/a/:1:bad", "/a/:1:1h:1"} {
+		_, err := ParseRetentionPolicy([]string{spec})
+		require.Error(err, spec)
+	}
+}
+
+func TestRetainVersions(t *testing.T) {
+	require := require.New(t)
+
+	now := time.Now()
+	seg := capn.NewBuffer(nil)
+	list := proto.NewRecordVersionList(seg, 4)
+	for i := 0; i < 4; i++ {
+		ann := proto.AutoNewAnnounce(capn.NewBuffer(nil))
+		ann.SetTimestamp(now.Add(-time.Duration(4-i) * time.Hour).UnixNano())
+		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetAnnounce(ann)
+		ver.SetVersion(string(rune('a' + i)))
+		list.Set(i, ver)
+	}
+	versionsOf := func(list proto.RecordVersion_List) []string {
+		var versions []string
+		for _, ver := range list.ToArray() {
+			versions = append(versions, ver.Version())
+		}
+		return versions
+	}
+
+	kept, removed := retainVersions(list, RetentionRule{MaxVersions: 2}, now)
+	require.Equal([]string{"c", "d"}, versionsOf(kept))
+	require.Equal([]string{"a", "b"}, removed)
+
+	kept, removed = retainVersions(list, RetentionRule{MaxVersions: 10, MaxAge: 150 * time.Minute}, now)
+	require.Equal([]string{"c", "d"}, versionsOf(kept))
+	require.Equal([]string{"a", "b"}, removed)
+
+	kept, removed = retainVersions(list, RetentionRule{}, now)
+	require.Empty(versionsOf(kept))
+	require.Len(removed, 4)
+
+	kept, removed = retainVersions(list, RetentionRule{KeepAll: true}, now)
+	require.Equal([]string{"a", "b", "c", "d"}, versionsOf(kept))
+	require.Empty(removed)
+}
@@ -42,19 +42,33 @@ type RecordCRUD interface {
 	CreateRecord(ctx context.Context, path string, body io.ReadCloser, opts ...CreateOptions) (*Record, error)
 	ReadRecord(ctx context.Context, path string, opts ...ReadOptions) (*Record, error)
 	UpdateRecord(ctx context.Context, path string, body io.ReadCloser, opts ...UpdateOptions) (*Record, error)
-	DeleteRecord(ctx context.Context, path string) (*Record, error)
+	DeleteRecord(ctx context.Context, path string, opts ...DeleteOptions) (*Record, error)
+	RestoreRecord(ctx context.Context, path, version string) (*Record, error)
 }
 
 // CreateOptions user meta
 type CreateOptions struct {
 	UserMeta []byte
 	Size     int64
+	// ExpiresAt is the time in nanoseconds after which the record gets deleted, zero means never.
+	ExpiresAt int64
 }
 
 // UpdateOptions structure to contain user meta and size
 type UpdateOptions struct {
 	UserMeta []byte
 	Size     int64
+	// IfVersion is the expected current version of the record, if set and the record
+	// has a different current version, the update fails with ErrVersionConflict.
+	IfVersion string
+	// ExpiresAt is the expiry time of the new version, see CreateOptions.
+	ExpiresAt int64
+}
+
+// DeleteOptions structure to contain delete preconditions
+type DeleteOptions struct {
+	// IfVersion is the expected current version of the record, see UpdateOptions.
+	IfVersion string
 }
 
 // ReadOptions structure - version
@@ -63,6 +77,16 @@ type ReadOptions struct {
 	NoContent bool
 }
 
+// ExportOptions structure to filter exported records
+type ExportOptions struct {
+	// Since is a timestamp in Unix nanoseconds, if set only records changed on this node
+	// since that time are exported. Records announced since that time are exported as well.
+	// If the change log doesn't reach back to Since, all records are exported.
+	Since int64
+	// Buckets limits exported records to those in the specified digest buckets, see RecordsDigest.
+	Buckets []int
+}
+
 // RecordWalkFunc handler to walk through path
 type RecordWalkFunc func(path string, r *Record) error
 
@@ -70,53 +94,48 @@ type RecordWalkFunc func(path string, r *Record) error
 type PlanetaryRecordStore interface {
 	RecordCRUD
 
-	ExportRecords(ctx context.Context, wr io.Writer) error
+	BatchApply(ctx context.Context, ops []BatchOp) ([]*Record, error)
+	ExportRecords(ctx context.Context, wr io.Writer, opts ...ExportOptions) error
+	RecordsDigest(ctx context.Context) (*RecordsDigest, error)
+	WatchRecords(ctx context.Context, prefix, cursor string) (<-chan *RecordChange, error)
 	WalkRecords(ctx context.Context, root string, fn RecordWalkFunc) error
+	Conflicts(ctx context.Context) ([]*RecordConflict, error)
 
 	Sync(timeout time.Duration) error
 	IsReady() bool
+	SyncProgress() *SyncProgress
 	WaitInbound(timeout time.Duration)
-	WaitOutbound(timeout time.Duration)
+	// WaitOutbound waits for the outbound queue and returns the number of record announces left unsent.
+	WaitOutbound(timeout time.Duration) int
 	ReceiveEventAnnounce(event *EventAnnounce)
 	EmitEventAnnounce(event *EventAnnounce)
 	SendBeats(ctx context.Context, tickDur, infoDur time.Duration, ethAddr string)
 	CommitBeatReports(ctx context.Context, dur time.Duration)
-
+	AntiEntropy(ctx context.Context, dur time.Duration)
+	ExpireRecords(ctx context.Context, dur time.Duration)
+	RunGC(ctx context.Context, dur time.Duration)
+	RetryPendingFetches(ctx context.Context, dur, timeout time.Duration)
+	AnnounceHeads(ctx context.Context, dur time.Duration)
+
+	Retention() RetentionPolicy
+	PendingFetches() int
+	AnnounceStats() *AnnounceStats
+	StoreMetrics() *StoreMetrics
 	BadgerStats() *BadgerStats
 	Close() error
 }
 
-func GC(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore, maxVersions int) error {
-	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
-		Prefetch: 100,
-	})
-	_, err := stateStore.RangeModify(b, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
-		if v.Previous().Len() <= maxVersions {
-			return nil, state.ErrNoUpdate
-		}
-		rec := proto.AutoNewRecord(capn.NewBuffer(nil))
-		rec.SetId(v.Id())
-		rec.SetPath(v.Path())
-		rec.SetCreatedAt(v.CreatedAt())
-		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
-		ver.SetAnnounce(v.Current().Announce())
-		ver.SetVersion(v.Current().Version())
-		rec.SetCurrent(ver)
-		newPrevious, removed := proto.CapRecordVersions(v.Previous(), maxVersions)
-		rec.SetPrevious(newPrevious)
-		for _, versionID := range removed {
-			if err := fileStore.UnpinObject(fs.ObjectRef{
-				Version: versionID,
-			}); err != nil {
-				log.Debugln("failed to unpin during GC:", versionID, err)
-			}
-		}
-		return &rec, nil
-	}))
-	return err
+// StoreOpt configures the record store
+type StoreOpt func(r *recordStore)
+
+// RetentionOpt sets the version retention policy used for pinning and GC
+func RetentionOpt(policy RetentionPolicy) StoreOpt {
+	return func(r *recordStore) {
+		r.retention = policy
+	}
 }
 
-func NewPlanetaryRecordStore(nodeID string, fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore) (PlanetaryRecordStore, error) {
+func NewPlanetaryRecordStore(nodeID string, fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore, opts ...StoreOpt) (PlanetaryRecordStore, error) {
 	outboundAnnounces := make(chan *EventAnnounce, 1024)
 	inboundAnnounces := make(chan *EventAnnounce, 1024)
 	r := &recordStore{
@@ -129,10 +148,20 @@ func NewPlanetaryRecordStore(nodeID string, fileStore fs.PlanetaryFileStore, sta
 		outboundWg:        new(sync.WaitGroup),
 		outboundPump:      pumpEventAnnounces(outboundAnnounces),
 		outboundAnnounces: outboundAnnounces,
+		outboundStop:      make(chan struct{}),
 
 		inboundWg:        new(sync.WaitGroup),
 		inboundPump:      pumpEventAnnounces(inboundAnnounces),
 		inboundAnnounces: inboundAnnounces,
+
+		changes:     newChangeHub(),
+		clockSkew:   defaultClockSkew,
+		fanoutPeers: defaultFanoutPeers,
+		fanoutJobs:  make(chan *fanoutJob, fanoutQueueSize),
+		fanoutMux:   new(sync.Mutex),
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
 	r.processInbound(4, 10*time.Minute)
 	r.processOutbound(4, 10*time.Minute)
@@ -152,6 +181,8 @@ func NewPlanetaryRecordStore(nodeID string, fileStore fs.PlanetaryFileStore, sta
 
 	topics := []string{
 		EventRecordUpdate.String(),
+		EventRecordBatch.String(),
+		EventRecordHeads.String(),
 		EventBeatInfo.String(),
 		EventBeatTick.String(),
 	}
@@ -167,15 +198,15 @@ func NewPlanetaryRecordStore(nodeID string, fileStore fs.PlanetaryFileStore, sta
 		switch event.Type {
 		case EventUnknown:
 			return nil
-		case EventRecordUpdate:
+		case EventRecordUpdate, EventRecordBatch, EventRecordHeads:
 			if !isPublishAllowed(m.From) {
-				log.WithField("from", m.From).Debugln("Ignoring EventRecordUpdate, unauthorized node")
+				log.WithField("from", m.From).Debugln("Ignoring record event, unauthorized node")
 				return nil
 			}
 			log.WithFields(log.Fields{
 				"from": m.From,
 				"type": event.Type.String(),
-			}).Debugln("EventRecordUpdate Received")
+			}).Debugln("Record event Received")
 
 			seg, err := capn.ReadFromPackedStream(bytes.NewReader(m.Data), nil)
 			if err != nil {
@@ -214,9 +245,10 @@ func NewPlanetaryRecordStore(nodeID string, fileStore fs.PlanetaryFileStore, sta
 }
 
 type recordStore struct {
-	nodeID   string
-	stateMux *sync.RWMutex
-	state    storeState
+	nodeID       string
+	stateMux     *sync.RWMutex
+	state        storeState
+	syncProgress SyncProgress
 
 	fs fs.PlanetaryFileStore
 	ss state.IndexedStore
@@ -224,12 +256,29 @@ type recordStore struct {
 	outboundWg          *sync.WaitGroup
 	outboundPump        chan *EventAnnounce
 	outboundAnnounces   chan *EventAnnounce
+	outboundStop        chan struct{}
 	outboundWorkCounter uint64
 
 	inboundWg          *sync.WaitGroup
 	inboundPump        chan *EventAnnounce
 	inboundAnnounces   chan *EventAnnounce
 	inboundWorkCounter uint64
+
+	changes   *changeHub
+	retention RetentionPolicy
+	clockSkew time.Duration
+	announces announceCounters
+
+	inboundQueued  int64
+	outboundQueued int64
+
+	fanoutPeers       int
+	fanoutJobs        chan *fanoutJob
+	fanoutMux         *sync.Mutex
+	alivePeers        []string
+	alivePeersAt      time.Time
+	alivePeersRefresh bool
+	recent            recentAnnounces
 }
 
 type storeState int
@@ -241,6 +290,7 @@ const (
 )
 
 func (r *recordStore) Close() error {
+	close(r.outboundStop)
 	r.inboundPump <- &EventAnnounce{
 		Type: EventStopAnnounce,
 	}
@@ -253,20 +303,34 @@ func (r *recordStore) Close() error {
 // ErrNotSynced to be thrown when not synced
 var ErrNotSynced = errors.New("not synced")
 
+// SyncProgress describes the initial record sync with peers.
+type SyncProgress struct {
+	State string `json:"state"`
+	// Peers is the number of alive peers the records are being collected from.
+	Peers      int   `json:"peers"`
+	Imported   int   `json:"imported"`
+	StartedAt  int64 `json:"startedAt,omitempty"`
+	FinishedAt int64 `json:"finishedAt,omitempty"`
+}
+
+func (r *recordStore) SyncProgress() *SyncProgress {
+	r.stateMux.RLock()
+	progress := r.syncProgress
+	progress.State = r.state.String()
+	r.stateMux.RUnlock()
+	return &progress
+}
+
 func (r *recordStore) Sync(timeout time.Duration) error {
-	var syncCandidates []string
-	entries := authcenter.Default.Entries()
-	for _, e := range entries {
-		log.WithField("key", e.Key).Debug("Sync Candidate")
-		if e.Key == r.nodeID {
-			continue
-		} else if e.HasPermissions(authcenter.RecordSyncPermission) {
-			syncCandidates = append(syncCandidates, e.Key)
-		}
+	r.stateMux.Lock()
+	r.syncProgress = SyncProgress{
+		StartedAt: time.Now().UnixNano(),
 	}
+	r.stateMux.Unlock()
+	syncCandidates := r.syncCandidates()
 	if len(syncCandidates) == 0 {
 		log.Warningln("no sync candidates found")
-		r.state = storeActiveState
+		r.setState(storeActiveState)
 		return nil
 	}
 	log.Debugf("found %d sync candidates", len(syncCandidates))
@@ -284,7 +348,7 @@ func (r *recordStore) Sync(timeout time.Duration) error {
 		}
 		if len(alive) == 0 {
 			log.Warningln("no alive sync candidates found")
-			r.state = storeActiveState
+			r.setState(storeActiveState)
 			return nil
 		}
 		log.Debugln("found alive sync candidates:", len(alive))
@@ -294,14 +358,44 @@ func (r *recordStore) Sync(timeout time.Duration) error {
 	if len(alive) > 2 {
 		alive = alive[:2]
 	}
+	r.stateMux.Lock()
+	r.syncProgress.Peers = len(alive)
+	r.stateMux.Unlock()
+	syncStarted := time.Now()
 	rC := make(chan *proto.Record, 100)
-	go r.collectRecords(ctx, alive, rC)
+	doneC := make(chan string, len(alive))
+	go r.collectRecords(ctx, alive, rC, doneC)
 	log.Infoln("sync has started with timeout", timeout)
 	if err := r.startSync(ctx, rC); err != nil {
 		err = fmt.Errorf("failed to sync store: %v", err)
 		return err
 	}
-	return nil
+	for {
+		select {
+		case nodeID := <-doneC:
+			// all records of this peer have been imported
+			if err := r.setSyncCursor(nodeID, syncStarted); err != nil {
+				log.WithField("nodeID", nodeID).Warningf("failed to save sync cursor: %v", err)
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// syncCandidates lists nodes that are permitted to serve records for sync, except this node.
+func (r *recordStore) syncCandidates() []string {
+	var syncCandidates []string
+	entries := authcenter.Default.Entries()
+	for _, e := range entries {
+		log.WithField("key", e.Key).Debug("Sync Candidate")
+		if e.Key == r.nodeID {
+			continue
+		} else if e.HasPermissions(authcenter.RecordSyncPermission) {
+			syncCandidates = append(syncCandidates, e.Key)
+		}
+	}
+	return syncCandidates
 }
 
 func (r *recordStore) startSync(ctx context.Context, rC <-chan *proto.Record) error {
@@ -320,55 +414,86 @@ func (r *recordStore) startSync(ctx context.Context, rC <-chan *proto.Record) er
 				log.Debugln("sync end")
 				r.setState(storeActiveState)
 				return nil
-			} else if err := validateRecord(record); err != nil {
-				vv, _ := record.MarshalJSON()
-				log.Debugf("failed to validate record in sync: %v, record: %s", err, string(vv))
-				continue
-			} else if ownerID := record.Current().Announce().NodeID(); !isPublishAllowed(ownerID) {
-				log.Debugf("publish not allowed for author of the announce in sync: %s", ownerID)
-				continue
-			}
-			k := state.NewKey(state.BucketRecords, record.IdBytes())
-			if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
-				if v == nil {
-					// if not exists, simply insert
-					log.Debugf("new record imported: %s", record.Id())
-					return record, nil
-				}
-				updNext, err := record.AnnounceEnvelope()
-				if err != nil {
-					log.Debugf("failed to decode record update envelope in sync: %v", err)
-					return nil, state.ErrNoUpdate
-				}
-				updCurrent, err := v.AnnounceEnvelope()
-				if err != nil {
-					log.Debugf("failed to decode current record in store: %v", err)
-					return nil, state.ErrNoUpdate
-				}
-				if updNext.Id() != updCurrent.Id() {
-					log.Warningf("announce envelope record ID mismatch: %s (next) != %s (prev)", updNext.Id(), updCurrent.Id())
-					return nil, state.ErrNoUpdate
-				}
-				if cmp := updNext.Compare(updCurrent); cmp > 0 {
-					// overwrite with new record, since its envelope is newer
-					log.Debugf("record imported, newer version: %s", record.Id())
-					return record, nil
-				} else if cmp == 0 {
-					// current envelopes are the same, compare lists
-					if record.Previous().Len() > v.Previous().Len() {
-						// overwrite if longer
-						log.Debugf("record imported, version chain longer: %s", record.Id())
-						return record, nil
-					}
-				}
-				return nil, state.ErrNoUpdate
-			})); err != nil {
+			} else if imported, err := r.importRecord(record, "sync"); err != nil {
 				return err
+			} else if imported {
+				r.stateMux.Lock()
+				r.syncProgress.Imported++
+				r.stateMux.Unlock()
 			}
 		}
 	}
 }
 
+// importRecord merges a record received from a peer into the state, the record is kept
+// if its current envelope is newer or its version chain is longer. Records that fail the
+// validation are skipped, source is used for logging. Returns whether the record was kept.
+func (r *recordStore) importRecord(record *proto.Record, source string) (bool, error) {
+	if err := validateRecord(record); err != nil {
+		vv, _ := record.MarshalJSON()
+		log.Debugf("failed to validate record in %s: %v, record: %s", source, err, string(vv))
+		return false, nil
+	} else if ownerID := record.Current().Announce().NodeID(); !isPublishAllowed(ownerID) {
+		log.Debugf("publish not allowed for author of the announce in %s: %s", source, ownerID)
+		return false, nil
+	}
+	k := state.NewKey(state.BucketRecords, record.IdBytes())
+	recovered := isRecoveredRecord(r.ss, record.Id())
+	var imported, created bool
+	var fork *ForkedVersion
+	if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+		if v == nil {
+			// if not exists, simply insert
+			log.Debugf("new record imported: %s", record.Id())
+			imported, created = true, true
+			return record, nil
+		} else if recovered {
+			// the record has been rebuilt from the pinset, a signed copy replaces it
+			log.Debugf("recovered record imported: %s", record.Id())
+			imported = true
+			return record, nil
+		}
+		updNext, err := record.AnnounceEnvelope()
+		if err != nil {
+			log.Debugf("failed to decode record update envelope in %s: %v", source, err)
+			return nil, state.ErrNoUpdate
+		}
+		updCurrent, err := v.AnnounceEnvelope()
+		if err != nil {
+			log.Debugf("failed to decode current record in store: %v", err)
+			return nil, state.ErrNoUpdate
+		}
+		if updNext.Id() != updCurrent.Id() {
+			log.Warningf("announce envelope record ID mismatch: %s (next) != %s (prev)", updNext.Id(), updCurrent.Id())
+			return nil, state.ErrNoUpdate
+		}
+		var replace bool
+		if replace, fork = resolveImport(v, record); replace {
+			log.Debugf("record imported, newer version or longer version chain: %s", record.Id())
+			imported = true
+			return record, nil
+		}
+		return nil, state.ErrNoUpdate
+	})); err != nil {
+		return false, err
+	}
+	if fork != nil {
+		r.addConflict(record.Id(), record.Path(), fork)
+	}
+	if err := indexRecordPath(r.ss, record.Id(), record.Path()); err != nil {
+		log.Warningf("failed to index record path in %s: %v", source, err)
+	}
+	if imported && recovered {
+		if err := r.ss.Delete(state.NewKey(state.BucketRecovered, record.IdBytes())); err != nil {
+			log.Warningf("failed to remove recovery mark in %s: %v", source, err)
+		}
+	}
+	if imported {
+		r.recordChanged(changeTypeOf(created, nil), record)
+	}
+	return imported, nil
+}
+
 func validateRecord(record *proto.Record) error {
 	if record == nil {
 		return errors.New("record is nil")
@@ -414,14 +539,33 @@ func (r *recordStore) processOutbound(workers int, emitTimeout time.Duration) {
 				time.Sleep(100 * time.Millisecond)
 			}
 			for ev := range r.outboundAnnounces {
-				if err := r.emitEvent(ev, emitTimeout); err != nil {
+				atomic.AddInt64(&r.outboundQueued, -1)
+				err := r.emitEvent(ev, emitTimeout)
+				if err == errNoTopicPeers {
+					log.WithField("type", ev.Type.String()).Debugln("no pubsub peers to deliver the event to")
+				} else if err != nil {
 					log.Warningln("error emitting event:", err)
-				} else {
-					r.outboundWork()
+				} else if ev.Type == EventRecordHeads {
+					r.confirmHeads(ev)
+				}
+				// record announces are also pushed to peers directly,
+				// delivery by either way counts as published
+				if !r.queueFanout(ev, err == nil) {
+					r.outboundPublished(ev, err == nil)
 				}
 			}
 		}()
 	}
+	r.processFanout(fanoutWorkers)
+	go r.retryOutbound()
+}
+
+// outboundPublished reports the result of publishing the announce.
+func (r *recordStore) outboundPublished(ev *EventAnnounce, published bool) {
+	r.outboundDone(ev, published)
+	if published {
+		r.outboundWork()
+	}
 }
 
 func (r *recordStore) processInbound(workers int, timeout time.Duration) {
@@ -434,6 +578,8 @@ func (r *recordStore) processInbound(workers int, timeout time.Duration) {
 				time.Sleep(100 * time.Millisecond)
 			}
 			for ev := range r.inboundAnnounces {
+				atomic.AddInt64(&r.inboundQueued, -1)
+				r.announces.countHandled(ev.Type)
 				if err := r.handleEvent(ev, timeout); err != nil {
 					log.Warningln("error handling event:", err)
 				} else {
@@ -560,48 +706,35 @@ func (r *recordStore) CommitBeatReports(ctx context.Context, dur time.Duration)
 	}
 }
 
+// emitEvent publishes the announce to pubsub, failed announces are retried by the caller.
 func (r *recordStore) emitEvent(ev *EventAnnounce, timeout time.Duration) error {
 	// ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
 	// defer cancelFn()
 
-	wg := new(sync.WaitGroup)
-	defer wg.Wait()
-
 	buf := new(bytes.Buffer)
 	if _, err := ev.Announce.Segment.WriteToPacked(buf); err != nil {
-
-		log.WithFields(log.Fields{
-			"type":   ev.Type.String(),
-			"nodeID": r.nodeID,
-		}).Warningf("Failed to pack announce: %v", err)
 		err = fmt.Errorf("Failed to pack announce: %v", err)
 		return err
 	}
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		pub, err := r.fs.PubSub()
-		if err != nil {
-			log.WithFields(log.Fields{
-				"type":   ev.Type.String(),
-				"nodeID": r.nodeID,
-			}).Warningf("Failed to use pubsub: %v", err)
-			return
-		}
-		// topic := EventToTopic(r.nodeID, ev.Type)
-		log.WithFields(log.Fields{
-			"type":   ev.Type.String(),
-			"nodeID": r.nodeID,
-		}).Debugf("Emitting event to pubsub")
-
-		if err = pub.Publish(ev.Type.String(), buf.Bytes()); err != nil {
-			log.WithFields(log.Fields{
-				"type":   ev.Type.String(),
-				"nodeID": r.nodeID,
-			}).Warningf("Pubsub publish failed: %v", err)
-		}
-	}()
+	pub, err := r.fs.PubSub()
+	if err != nil {
+		err = fmt.Errorf("Failed to use pubsub: %v", err)
+		return err
+	}
+	// topic := EventToTopic(r.nodeID, ev.Type)
+	log.WithFields(log.Fields{
+		"type":   ev.Type.String(),
+		"nodeID": r.nodeID,
+	}).Debugf("Emitting event to pubsub")
+
+	if err := pub.Publish(ev.Type.String(), buf.Bytes()); err != nil {
+		err = fmt.Errorf("Pubsub publish of %s failed: %v", ev.Type.String(), err)
+		return err
+	}
+	// publishing succeeds without subscribers as well, the message is just dropped then
+	if len(pub.ListPeers(ev.Type.String())) == 0 {
+		return errNoTopicPeers
+	}
 	return nil
 }
 
@@ -641,71 +774,85 @@ func (r *recordStore) handleEvent(ev *EventAnnounce, timeout time.Duration) erro
 		}
 		return true
 	}
+	if !r.isTimestampValid(ev, time.Now()) {
+		log.WithFields(fields).Warningf("skipping %s event with timestamp outside of the clock skew window", ev.Type.String())
+		return nil
+	}
 	switch ev.Type {
 	case EventRecordUpdate:
 		if !isPublishAllowed(ownerID) {
 			log.WithFields(fields).Warningf("skipping record update event from an unauthorized source")
+			r.announces.countRejected(ev.Type, RejectUnauthorized)
 			return nil
 		} else if !validate(ev) {
 			log.WithFields(fields).Warningf("skipping invalid record update event")
+			r.announces.countRejected(ev.Type, RejectInvalidSignature)
 			return nil
-		}
-		update, err := proto.UnpackEnvelopeRecordUpdate(ev.Announce.Envelope())
-		if err != nil {
-			log.WithFields(fields).Errorf("failed to unpack record update: %v", err)
+		} else if !r.markAnnounceSeen(ev) {
+			log.WithFields(fields).Debugln("skipping replayed record update event")
 			return nil
 		}
-		ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
-		ref, err := r.fs.HeadObject(ctx, fs.ObjectRef{
-			Version: update.Version(),
-		})
-		cancelFn()
-		updateFields := logging.WithMore(fields, log.Fields{
-			"Version":     update.Version,
-			"VersionPrev": update.VersionPrev,
-		})
-		if err == fs.ErrNotFound {
-			log.WithFields(updateFields).Warningln("file not found on IPFS but announced")
+		if err := r.applyRecordUpdate(ev, fields, timeout); err == errContentUnavailable {
+			log.WithFields(fields).Warningln("announced content is not available yet, queued for retry")
+			r.addPendingFetch(ev)
+		}
+	case EventRecordBatch:
+		if !isPublishAllowed(ownerID) {
+			log.WithFields(fields).Warningf("skipping record batch event from an unauthorized source")
+			r.announces.countRejected(ev.Type, RejectUnauthorized)
 			return nil
-		} else if err != nil {
-			log.WithFields(updateFields).Errorf("failed to retrieve object: %v", err)
+		} else if !validate(ev) {
+			log.WithFields(fields).Warningf("skipping invalid record batch event")
+			r.announces.countRejected(ev.Type, RejectInvalidSignature)
+			return nil
+		} else if !r.markAnnounceSeen(ev) {
+			log.WithFields(fields).Debugln("skipping replayed record batch event")
 			return nil
 		}
-		k := state.NewKey(state.BucketRecords, []byte(ref.ID))
-		if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
-			if v == nil {
-				vv := proto.AutoNewRecord(capn.NewBuffer(nil))
-				v = &vv
-				v.SetId(ref.ID)
-				v.SetPath(ref.Path)
-				v.SetCreatedAt(ev.Announce.Timestamp())
-				ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
-				ver.SetAnnounce(ev.Announce)
-				ver.SetVersion(ref.Version)
-				v.SetCurrent(ver)
-				return v, nil
-			}
-			v.SetPrevious(proto.AppendRecordVersion(v.Previous(), v.Current()))
-			ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
-			ver.SetAnnounce(ev.Announce)
-			ver.SetVersion(ref.Version)
-			v.SetCurrent(ver)
-			return v, nil
-		})); err != nil {
-			log.Warningf("failed to update record: %v", err)
+		if err := r.handleRecordBatch(ev, fields, timeout); err == errContentUnavailable {
+			log.WithFields(fields).Warningln("announced batch content is not available yet, queued for retry")
+			r.addPendingFetch(ev)
 		}
-		if err := r.fs.PinNewest(*ref, 3); err != nil {
-			log.WithFields(updateFields).Errorf("failed to pin object: %v", err)
+	case EventRecordHeads:
+		if !isPublishAllowed(ownerID) {
+			log.WithFields(fields).Warningf("skipping record heads event from an unauthorized source")
+			r.announces.countRejected(ev.Type, RejectUnauthorized)
+			return nil
+		} else if !validate(ev) {
+			log.WithFields(fields).Warningf("skipping invalid record heads event")
+			r.announces.countRejected(ev.Type, RejectInvalidSignature)
+			return nil
+		} else if !r.markAnnounceSeen(ev) {
+			log.WithFields(fields).Debugln("skipping replayed record heads event")
 			return nil
 		}
+		heads, err := unpackRecordHeads(ev)
+		if err != nil {
+			log.WithFields(fields).Errorf("failed to unpack record heads: %v", err)
+			r.announces.countRejected(ev.Type, RejectMalformed)
+			return nil
+		}
+		for _, head := range heads {
+			if !validate(head) {
+				log.WithFields(fields).Warningf("skipping invalid record head")
+				r.announces.countRejected(head.Type, RejectInvalidSignature)
+				continue
+			}
+			r.applyRecordHead(head, fields, timeout)
+		}
 	case EventBeatTick:
 		if !validate(ev) {
 			log.WithFields(fields).Warningf("skipping invalid beat tick event")
+			r.announces.countRejected(ev.Type, RejectInvalidSignature)
+			return nil
+		} else if !r.markAnnounceSeen(ev) {
+			log.WithFields(fields).Debugln("skipping replayed beat tick event")
 			return nil
 		}
 		tick, err := proto.UnpackEnvelopeBeatTick(ev.Announce.Envelope())
 		if err != nil {
 			log.WithFields(fields).Errorf("failed to unpack beat tick: %v", err)
+			r.announces.countRejected(ev.Type, RejectMalformed)
 			return nil
 		}
 		k := state.NewKey(state.BucketBeatTicks, tick.IdBytes())
@@ -726,11 +873,16 @@ func (r *recordStore) handleEvent(ev *EventAnnounce, timeout time.Duration) erro
 	case EventBeatInfo:
 		if !validate(ev) {
 			log.WithFields(fields).Warningf("skipping invalid beat info event")
+			r.announces.countRejected(ev.Type, RejectInvalidSignature)
+			return nil
+		} else if !r.markAnnounceSeen(ev) {
+			log.WithFields(fields).Debugln("skipping replayed beat info event")
 			return nil
 		}
 		info, err := proto.UnpackEnvelopeBeatInfo(ev.Announce.Envelope())
 		if err != nil {
 			log.WithFields(fields).Errorf("failed to unpack beat info: %v", err)
+			r.announces.countRejected(ev.Type, RejectMalformed)
 			return nil
 		}
 		u, err := ulid.Parse(info.Id())
@@ -803,6 +955,100 @@ func (r *recordStore) handleEvent(ev *EventAnnounce, timeout time.Duration) erro
 	return nil
 }
 
+// applyRecordUpdate writes the announced version into the record, the announced object must be
+// resolved within the timeout, otherwise errContentUnavailable is returned.
+func (r *recordStore) applyRecordUpdate(ev *EventAnnounce, fields log.Fields, timeout time.Duration) error {
+	update, err := proto.UnpackEnvelopeRecordUpdate(ev.Announce.Envelope())
+	if err != nil {
+		log.WithFields(fields).Errorf("failed to unpack record update: %v", err)
+		r.announces.countRejected(ev.Type, RejectMalformed)
+		return nil
+	} else if r.isKnownVersion(update.Id(), update.Version()) {
+		// re-announced heads and duplicate deliveries
+		log.WithFields(fields).Debugln("skipping already known version", update.Version())
+		return nil
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	ref, err := r.fs.HeadObject(ctx, fs.ObjectRef{
+		Version: update.Version(),
+	})
+	cancelFn()
+	updateFields := logging.WithMore(fields, log.Fields{
+		"Version":     update.Version,
+		"VersionPrev": update.VersionPrev,
+	})
+	if err == fs.ErrNotFound {
+		log.WithFields(updateFields).Debugln("file not found on IPFS but announced")
+		return errContentUnavailable
+	} else if err != nil {
+		log.WithFields(updateFields).Debugf("failed to retrieve object: %v", err)
+		return errContentUnavailable
+	}
+	k := state.NewKey(state.BucketRecords, []byte(ref.ID))
+	baseForked := r.isForkedVersion(ref.ID, update.VersionPrev())
+	var recordPath string
+	var updated *proto.Record
+	var created, rejected bool
+	var fork *ForkedVersion
+	if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+		if hasRecordVersion(v, ref.Version) {
+			return nil, state.ErrNoUpdate
+		}
+		var res updateResolution
+		res, fork = resolveUpdate(v, newRecordVersion(ev.Announce, ref.Version), update.VersionPrev(), baseForked)
+		if res == updateReject {
+			rejected = true
+			return nil, state.ErrNoUpdate
+		} else if res == updateRebase {
+			v = rewindRecord(v, update.VersionPrev())
+		}
+		if v == nil {
+			created = true
+			vv := proto.AutoNewRecord(capn.NewBuffer(nil))
+			v = &vv
+			v.SetId(ref.ID)
+			v.SetPath(ref.Path)
+			v.SetCreatedAt(ev.Announce.Timestamp())
+			ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+			ver.SetAnnounce(ev.Announce)
+			ver.SetVersion(ref.Version)
+			v.SetCurrent(ver)
+			recordPath = v.Path()
+			updated = v
+			return v, nil
+		}
+		v.SetPrevious(proto.AppendRecordVersion(v.Previous(), v.Current()))
+		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetAnnounce(ev.Announce)
+		ver.SetVersion(ref.Version)
+		v.SetCurrent(ver)
+		recordPath = v.Path()
+		updated = v
+		return v, nil
+	})); err != nil {
+		log.Warningf("failed to update record: %v", err)
+	} else if rejected {
+		if fork != nil {
+			r.addConflict(ref.ID, ref.Path, fork)
+		}
+		log.WithFields(updateFields).Warningln("skipping record update not based on the current version")
+		r.announces.countRejected(ev.Type, RejectVersionMismatch)
+		return nil
+	} else if updated != nil {
+		if fork != nil {
+			r.addConflict(ref.ID, ref.Path, fork)
+		}
+		if err := indexRecordPath(r.ss, ref.ID, recordPath); err != nil {
+			log.WithFields(updateFields).Warningf("failed to index record path: %v", err)
+		}
+		r.recordChanged(changeTypeOf(created, ref), updated)
+	}
+	if err := r.fs.PinNewest(*ref, r.retention.PinDepth(ref.Path)); err != nil {
+		log.WithFields(updateFields).Errorf("failed to pin object: %v", err)
+	}
+	return nil
+}
+
 func (r *recordStore) IsReady() bool {
 	r.stateMux.RLock()
 	ready := r.state == storeActiveState
@@ -813,11 +1059,15 @@ func (r *recordStore) IsReady() bool {
 func (r *recordStore) setState(state storeState) {
 	r.stateMux.Lock()
 	r.state = state
+	if state == storeActiveState && r.syncProgress.FinishedAt == 0 {
+		r.syncProgress.FinishedAt = time.Now().UnixNano()
+	}
 	r.stateMux.Unlock()
 }
 
-func (r *recordStore) WaitOutbound(timeout time.Duration) {
+func (r *recordStore) WaitOutbound(timeout time.Duration) int {
 	waitWG(r.outboundWg, timeout)
+	return r.unsentOutbound()
 }
 
 func (r *recordStore) WaitInbound(timeout time.Duration) {
@@ -844,15 +1094,23 @@ func waitWG(wg *sync.WaitGroup, timeout time.Duration) {
 func (r *recordStore) ReceiveEventAnnounce(event *EventAnnounce) {
 	if event.Type == EventStopAnnounce {
 		return
+	} else if r.recent.contains(event) {
+		r.announces.countRejected(event.Type, RejectDuplicate)
+		return
 	}
+	atomic.AddInt64(&r.inboundQueued, 1)
 	r.inboundPump <- event
 }
 
-// EmitEventAnnounce never blocks. Internal workers will eventually handle the events to emit.
+// EmitEventAnnounce never blocks. Internal workers will eventually handle the events to emit,
+// record announces are persisted until published, so they survive restarts.
 func (r *recordStore) EmitEventAnnounce(event *EventAnnounce) {
 	if event.Type == EventStopAnnounce {
 		return
+	} else if isDurableEvent(event) {
+		r.persistOutbound(event)
 	}
+	atomic.AddInt64(&r.outboundQueued, 1)
 	r.outboundPump <- event
 }
 
@@ -863,6 +1121,10 @@ var (
 	ErrRecordExists = errors.New("record exists")
 	// ErrRecordNotFound to be thrown when record was not found
 	ErrRecordNotFound = errors.New("record not found")
+	// ErrVersionConflict to be thrown when the current version of record doesn't match the expected one
+	ErrVersionConflict = errors.New("record version conflict")
+	// ErrVersionNotFound to be thrown when the version is not in the record history or has no content
+	ErrVersionNotFound = errors.New("record version not found")
 )
 
 func (r *recordStore) CreateRecord(ctx context.Context, path string, body io.ReadCloser, opts ...CreateOptions) (*Record, error) {
@@ -880,9 +1142,11 @@ func (r *recordStore) CreateRecord(ctx context.Context, path string, body io.Rea
 	k := state.NewKey(state.BucketRecords, []byte(id))
 	var size int64
 	var userMeta []byte
+	var expiresAt int64
 	if len(opts) > 0 {
 		size = opts[0].Size
 		userMeta = opts[0].UserMeta
+		expiresAt = opts[0].ExpiresAt
 	}
 
 	var ann *proto.Announce
@@ -892,9 +1156,10 @@ func (r *recordStore) CreateRecord(ctx context.Context, path string, body io.Rea
 			return v, ErrRecordExists
 		}
 		ref, err := r.fs.PutObject(ctx, fs.ObjectRef{
-			ID:   id,
-			Path: path,
-			Size: size,
+			ID:        id,
+			Path:      path,
+			Size:      size,
+			ExpiresAt: expiresAt,
 		}, userMeta, body)
 
 		if err != nil {
@@ -913,7 +1178,7 @@ func (r *recordStore) CreateRecord(ctx context.Context, path string, body io.Rea
 			"userMeta": string(userMeta),
 		}).Info("IPFS PutObject on CreateRecord was successfull")
 
-		ann = r.newRecordUpdateAnnounce(id, ref.Version, "")
+		ann = r.newRecordUpdateAnnounce(id, ref.Version, "", expiresAt)
 		rec.Record = proto.AutoNewRecord(capn.NewBuffer(nil))
 		rec.Record.SetId(ref.ID)
 		rec.Record.SetPath(ref.Path)
@@ -927,7 +1192,12 @@ func (r *recordStore) CreateRecord(ctx context.Context, path string, body io.Rea
 	})); err != nil {
 		log.Errorf("failed to update record: %v", err)
 		return nil, err
-	} else if ann != nil {
+	}
+	if err := indexRecordPath(r.ss, id, path); err != nil {
+		log.Errorf("failed to index record path: %v", err)
+	}
+	r.recordChanged(ChangeCreated, &rec.Record)
+	if ann != nil {
 		r.EmitEventAnnounce(&EventAnnounce{
 			Type:     EventRecordUpdate,
 			Announce: *ann,
@@ -950,21 +1220,7 @@ func (r *recordStore) findRecordID(ctx context.Context, path, version string) (s
 		// path parsed as a valid ULID
 		return path, nil
 	}
-	b := state.NewBucket(state.BucketRecords)
-	var id string
-	_, err := r.ss.RangePeek(b, proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
-		if v.Path() == path {
-			id = v.Id()
-			return state.ErrRangeStop
-		}
-		return nil
-	}))
-	if err != nil {
-		return "", err
-	} else if len(id) == 0 {
-		return "", ErrRecordNotFound
-	}
-	return id, nil
+	return lookupPathIndex(r.ss, path)
 }
 
 func (r *recordStore) UpdateRecord(ctx context.Context, path string, body io.ReadCloser, opts ...UpdateOptions) (*Record, error) {
@@ -979,9 +1235,13 @@ func (r *recordStore) UpdateRecord(ctx context.Context, path string, body io.Rea
 	k := state.NewKey(state.BucketRecords, []byte(id))
 	var size int64
 	var userMeta []byte
+	var ifVersion string
+	var expiresAt int64
 	if len(opts) > 0 {
 		size = opts[0].Size
 		userMeta = opts[0].UserMeta
+		ifVersion = opts[0].IfVersion
+		expiresAt = opts[0].ExpiresAt
 	}
 
 	var ann *proto.Announce
@@ -989,12 +1249,15 @@ func (r *recordStore) UpdateRecord(ctx context.Context, path string, body io.Rea
 	if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
 		if v == nil {
 			return nil, ErrRecordNotFound
+		} else if len(ifVersion) > 0 && v.Current().Version() != ifVersion {
+			return nil, ErrVersionConflict
 		}
 		ref, err := r.fs.PutObject(ctx, fs.ObjectRef{
 			ID:              v.Id(),
 			Path:            path,
 			VersionPrevious: v.Current().Version(),
 			Size:            size,
+			ExpiresAt:       expiresAt,
 		}, userMeta, body)
 		if err != nil {
 			log.WithFields(log.Fields{
@@ -1012,7 +1275,7 @@ func (r *recordStore) UpdateRecord(ctx context.Context, path string, body io.Rea
 			"userMeta": string(userMeta),
 		}).Info("IPFS PutObject on UpdateRecord was successfull")
 
-		ann = r.newRecordUpdateAnnounce(id, ref.Version, v.Current().Version())
+		ann = r.newRecordUpdateAnnounce(id, ref.Version, v.Current().Version(), expiresAt)
 		v.SetPrevious(proto.AppendRecordVersion(v.Previous(), v.Current()))
 		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
 		ver.SetAnnounce(*ann)
@@ -1025,6 +1288,7 @@ func (r *recordStore) UpdateRecord(ctx context.Context, path string, body io.Rea
 		log.Errorf("failed to update record: %v", err)
 		return nil, err
 	} else if ann != nil {
+		r.recordChanged(ChangeUpdated, &rec.Record)
 		r.EmitEventAnnounce(&EventAnnounce{
 			Type:     EventRecordUpdate,
 			Announce: *ann,
@@ -1035,7 +1299,7 @@ func (r *recordStore) UpdateRecord(ctx context.Context, path string, body io.Rea
 	return rec, nil
 }
 
-func (r *recordStore) DeleteRecord(ctx context.Context, path string) (*Record, error) {
+func (r *recordStore) DeleteRecord(ctx context.Context, path string, opts ...DeleteOptions) (*Record, error) {
 	if !isPublishAllowed(r.nodeID) {
 		return nil, ErrNotAuthorized
 	}
@@ -1045,12 +1309,18 @@ func (r *recordStore) DeleteRecord(ctx context.Context, path string) (*Record, e
 		return nil, err
 	}
 	k := state.NewKey(state.BucketRecords, []byte(id))
+	var ifVersion string
+	if len(opts) > 0 {
+		ifVersion = opts[0].IfVersion
+	}
 
 	var ann *proto.Announce
 	rec := &Record{}
 	if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
 		if v == nil {
 			return nil, ErrRecordNotFound
+		} else if len(ifVersion) > 0 && v.Current().Version() != ifVersion {
+			return nil, ErrVersionConflict
 		}
 		if ref, err := r.fs.HeadObject(ctx, fs.ObjectRef{
 			Version: v.Current().Version(),
@@ -1071,7 +1341,7 @@ func (r *recordStore) DeleteRecord(ctx context.Context, path string) (*Record, e
 		if err != nil {
 			return nil, err
 		}
-		ann = r.newRecordUpdateAnnounce(id, ref.Version, v.Current().Version())
+		ann = r.newRecordUpdateAnnounce(id, ref.Version, v.Current().Version(), 0)
 		v.SetPrevious(proto.AppendRecordVersion(v.Previous(), v.Current()))
 		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
 		ver.SetAnnounce(*ann)
@@ -1085,6 +1355,103 @@ func (r *recordStore) DeleteRecord(ctx context.Context, path string) (*Record, e
 		return nil, err
 	}
 	if ann != nil {
+		r.recordChanged(ChangeDeleted, &rec.Record)
+		r.EmitEventAnnounce(&EventAnnounce{
+			Type:     EventRecordUpdate,
+			Announce: *ann,
+		})
+	}
+	return rec, nil
+}
+
+// RestoreRecord writes a new version of the record with the contents and user meta of
+// the specified previous version, this also undeletes a deleted record. Restoring the current
+// version is a no-op.
+func (r *recordStore) RestoreRecord(ctx context.Context, path, version string) (*Record, error) {
+	if !isPublishAllowed(r.nodeID) {
+		return nil, ErrNotAuthorized
+	}
+	defer r.inboundWork()
+	id, err := r.findRecordID(ctx, path, "")
+	if err != nil {
+		return nil, err
+	}
+	k := state.NewKey(state.BucketRecords, []byte(id))
+
+	var ann *proto.Announce
+	rec := &Record{}
+	if err := r.ss.Update(k, proto.RecordModify(func(k *state.Key, v *proto.Record) (*proto.Record, error) {
+		if v == nil {
+			return nil, ErrRecordNotFound
+		}
+		if v.Current().Version() == version {
+			ref, err := r.fs.HeadObject(ctx, fs.ObjectRef{
+				Version: version,
+			})
+			if err == fs.ErrNotFound {
+				return nil, ErrVersionNotFound
+			} else if err != nil {
+				return nil, err
+			} else if !ref.Meta().IsDeleted() {
+				rec.Record = *v
+				rec.Object = *ref
+				return nil, state.ErrNoUpdate
+			}
+			return nil, ErrVersionNotFound
+		}
+		var found bool
+		prev := v.Previous()
+		for i := 0; i < prev.Len(); i++ {
+			if prev.At(i).Version() == version {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrVersionNotFound
+		}
+		obj, err := r.fs.GetObject(ctx, fs.ObjectRef{
+			Version: version,
+		})
+		if err == fs.ErrNotFound {
+			return nil, ErrVersionNotFound
+		} else if err != nil {
+			return nil, err
+		} else if obj.Meta.IsDeleted() || obj.Body == nil {
+			return nil, ErrVersionNotFound
+		}
+		defer obj.Body.Close()
+		// the content is added again with the same chunking, so it resolves to the same CID
+		// and the new version links the old content instead of copying it.
+		ref, err := r.fs.PutObject(ctx, fs.ObjectRef{
+			ID:              v.Id(),
+			Path:            v.Path(),
+			VersionPrevious: v.Current().Version(),
+			Size:            obj.Meta.Size(),
+		}, []byte(obj.Meta.UserMeta()), obj.Body)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"id":      id,
+				"path":    v.Path(),
+				"version": version,
+			}).Errorf("IPFS error of PutObject (RestoreRecord): %v", err)
+			return nil, err
+		}
+		ann = r.newRecordUpdateAnnounce(id, ref.Version, v.Current().Version(), 0)
+		v.SetPrevious(proto.AppendRecordVersion(v.Previous(), v.Current()))
+		ver := proto.AutoNewRecordVersion(capn.NewBuffer(nil))
+		ver.SetAnnounce(*ann)
+		ver.SetVersion(ref.Version)
+		v.SetCurrent(ver)
+		rec.Record = *v
+		rec.Object = *ref
+		return v, nil
+	})); err != nil {
+		log.Errorf("failed to restore record: %v", err)
+		return nil, err
+	}
+	if ann != nil {
+		r.recordChanged(ChangeUpdated, &rec.Record)
 		r.EmitEventAnnounce(&EventAnnounce{
 			Type:     EventRecordUpdate,
 			Announce: *ann,
@@ -1141,11 +1508,14 @@ func (r *recordStore) newBeatInfoAnnounce(session string, ethAddr string, uptime
 	return &a
 }
 
-func (r *recordStore) newRecordUpdateAnnounce(id, ver, verPrev string) *proto.Announce {
+func (r *recordStore) newRecordUpdateAnnounce(id, ver, verPrev string, expiresAt int64) *proto.Announce {
+	now := time.Now().UnixNano()
 	e := proto.AutoNewEnvelopeRecordUpdate(capn.NewBuffer(nil))
 	e.SetId(id)
 	e.SetVersion(ver)
 	e.SetVersionPrev(verPrev)
+	e.SetExpiresAt(expiresAt)
+	e.SetSignedAt(now)
 	buf := new(bytes.Buffer)
 	if _, err := e.Segment.WriteToPacked(buf); err != nil {
 		panic(fmt.Sprintf("failed to pack data: %v", err))
@@ -1159,7 +1529,7 @@ func (r *recordStore) newRecordUpdateAnnounce(id, ver, verPrev string) *proto.An
 	a.SetType(proto.ANNOUNCETYPE_RECORDUPDATE)
 	a.SetEnvelope(buf.Bytes())
 	a.SetSignature(hex.EncodeToString(sig))
-	a.SetTimestamp(time.Now().UnixNano())
+	a.SetTimestamp(now)
 	a.SetNodeID(r.nodeID)
 	return &a
 }
@@ -1232,9 +1602,7 @@ var ErrWalkStop = errors.New("walk stop")
 
 func (r *recordStore) WalkRecords(ctx context.Context, root string, fn RecordWalkFunc) error {
 	defer r.inboundWork()
-	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
-		Offset: []byte(root),
-	})
+	b := state.NewBucket(state.BucketRecords)
 	_, err := r.ss.RangePeek(b, proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
 		if err := fn(v.Path(), &Record{
 			Record: *v,
@@ -1248,12 +1616,57 @@ func (r *recordStore) WalkRecords(ctx context.Context, root string, fn RecordWal
 	return err
 }
 
-func (r *recordStore) ExportRecords(ctx context.Context, wr io.Writer) error {
+func (r *recordStore) ExportRecords(ctx context.Context, wr io.Writer, opts ...ExportOptions) error {
+	var since int64
+	var buckets map[int]bool
+	if len(opts) > 0 {
+		since = opts[0].Since
+		if len(opts[0].Buckets) > 0 {
+			buckets = make(map[int]bool, len(opts[0].Buckets))
+			for _, b := range opts[0].Buckets {
+				buckets[b] = true
+			}
+		}
+	}
 	defer r.inboundWork()
+	var changed map[string]struct{}
+	if since > 0 {
+		// filter by the time records were stored locally, records signed long ago may
+		// have been received after the cursor of the peer
+		ids, ok, err := r.changedSince(since)
+		if err != nil {
+			return err
+		} else if ok {
+			changed = ids
+		} else {
+			since = 0
+		}
+	}
 	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
 		Prefetch: 100,
 	})
 	_, err := r.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+		if since > 0 || buckets != nil {
+			var matched bool
+			if err := proto.RecordPeek(func(k *state.Key, v *proto.Record) error {
+				if v == nil {
+					return nil
+				}
+				matched = true
+				if since > 0 {
+					_, matched = changed[v.Id()]
+					matched = matched || v.Current().Announce().Timestamp() >= since
+				}
+				if buckets != nil {
+					matched = matched && buckets[digestBucket(v.IdBytes())]
+				}
+				return nil
+			})(k, v); err != nil {
+				return err
+			} else if !matched {
+				return nil
+			}
+		}
 		_, err := io.Copy(wr, bytes.NewReader(v))
 		if err == io.EOF {
 			return state.ErrRangeStop
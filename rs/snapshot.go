@@ -0,0 +1,324 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	capn "github.com/glycerine/go-capnproto"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// SnapshotVersion is the version of the snapshot file format.
+const SnapshotVersion = 1
+
+// ErrInvalidSnapshot is returned when a snapshot is malformed or its signature doesn't match.
+var ErrInvalidSnapshot = errors.New("invalid snapshot")
+
+// ErrSnapshotSigner is returned when the node that has signed a snapshot has neither write
+// nor sync permission, so anyone can't feed a node with blocks signed by their own key.
+var ErrSnapshotSigner = errors.New("snapshot signer is not permitted")
+
+var snapshotMagic = []byte("ATLANT-SNAPSHOT\n")
+
+// A snapshot is the magic followed by frames of type byte, uvarint length and payload:
+// the header, one frame per record and the trailer. The trailer carries the digest of all
+// bytes before it, signed by the exporting node. A CAR archive of blocks may follow.
+const (
+	snapshotFrameHeader  byte = 'H'
+	snapshotFrameRecord  byte = 'R'
+	snapshotFrameTrailer byte = 'S'
+
+	maxSnapshotFrame = 16 << 20
+)
+
+// SnapshotHeader describes the snapshot and the node that has exported it.
+type SnapshotHeader struct {
+	Version    int    `json:"version"`
+	NodeID     string `json:"nodeId"`
+	Env        string `json:"env"`
+	AppVersion string `json:"appVersion"`
+	CreatedAt  int64  `json:"createdAt"`
+	Blocks     bool   `json:"blocks"`
+}
+
+type snapshotTrailer struct {
+	Records   int    `json:"records"`
+	Digest    string `json:"digest"`
+	Signature string `json:"signature"`
+}
+
+// SnapshotStats reports the contents of a snapshot and the result of an import.
+type SnapshotStats struct {
+	Header   SnapshotHeader
+	Records  int
+	Imported int
+	Blocks   int
+}
+
+// ExportSnapshot writes all records of the state store as a snapshot signed by the node key.
+// If header.Blocks is set, the pinned IPFS blocks are appended as a CAR archive.
+func ExportSnapshot(ctx context.Context, fileStore fs.PlanetaryFileStore,
+	stateStore state.IndexedStore, w io.Writer, header SnapshotHeader) (*SnapshotStats, error) {
+	header.Version = SnapshotVersion
+	header.NodeID = fileStore.NodeID()
+	if header.CreatedAt == 0 {
+		header.CreatedAt = time.Now().UnixNano()
+	}
+	b := state.NewBucket(state.BucketRecords, &state.RangeOptions{
+		Prefetch: 100,
+	})
+	forEach := func(fn func(data []byte) error) error {
+		_, err := stateStore.RangePeek(b, func(k *state.Key, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(v)
+		})
+		return err
+	}
+	sign := func(digest []byte) ([]byte, error) {
+		return fileStore.SignData(header.NodeID, digest)
+	}
+	stats, err := writeSnapshot(w, header, forEach, sign)
+	if err != nil {
+		return nil, err
+	}
+	if header.Blocks {
+		if stats.Blocks, err = fileStore.ExportBlocks(ctx, w); err != nil {
+			return stats, fmt.Errorf("failed to export blocks: %v", err)
+		}
+	}
+	return stats, nil
+}
+
+// VerifySnapshot reads the snapshot and checks its records and the signature, blocks are not read.
+func VerifySnapshot(r io.Reader) (*SnapshotStats, error) {
+	return readSnapshot(bufio.NewReader(r), nil)
+}
+
+// ImportSnapshot verifies the snapshot and its signer permissions, then merges its records into
+// the state store the same way as records synced from peers: each record is checked by
+// validateRecord and the publish permissions of its author. Blocks are imported into the file
+// store, if present, only versions of the valid records are pinned.
+func ImportSnapshot(ctx context.Context, fileStore fs.PlanetaryFileStore,
+	stateStore state.IndexedStore, r io.ReadSeeker) (*SnapshotStats, error) {
+	verified, err := VerifySnapshot(r)
+	if err != nil {
+		return nil, err
+	} else if !isSnapshotSignerAllowed(verified.Header.NodeID) {
+		return nil, fmt.Errorf("%v: %s", ErrSnapshotSigner, verified.Header.NodeID)
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	store := &recordStore{
+		nodeID:  fileStore.NodeID(),
+		fs:      fileStore,
+		ss:      stateStore,
+		changes: newChangeHub(),
+	}
+	br := bufio.NewReader(r)
+	var imported int
+	var versions []string
+	stats, err := readSnapshot(br, func(record *proto.Record) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if validateRecord(record) == nil && isPublishAllowed(record.Current().Announce().NodeID()) {
+			versions = append(versions, recordVersions(record)...)
+		}
+		ok, err := store.importRecord(record, "snapshot")
+		if ok {
+			imported++
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.Imported = imported
+	if stats.Header.Blocks {
+		if stats.Blocks, err = fileStore.ImportBlocks(ctx, br, versions); err != nil {
+			return stats, fmt.Errorf("failed to import blocks: %v", err)
+		}
+	}
+	return stats, nil
+}
+
+func isSnapshotSignerAllowed(nodeID string) bool {
+	if authcenter.Default == nil {
+		return false
+	}
+	return authcenter.Default.HasPermissions(nodeID, authcenter.RecordWritePermission) ||
+		authcenter.Default.HasPermissions(nodeID, authcenter.RecordSyncPermission)
+}
+
+// recordVersions lists the current and previous versions of the record.
+func recordVersions(record *proto.Record) []string {
+	versions := []string{record.Current().Version()}
+	for _, v := range record.Previous().ToArray() {
+		versions = append(versions, v.Version())
+	}
+	return versions
+}
+
+func writeSnapshot(w io.Writer, header SnapshotHeader,
+	forEach func(fn func(data []byte) error) error,
+	sign func(digest []byte) ([]byte, error)) (*SnapshotStats, error) {
+	bw := bufio.NewWriter(w)
+	h := sha256.New()
+	hw := io.MultiWriter(bw, h)
+	if _, err := hw.Write(snapshotMagic); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSnapshotFrame(hw, snapshotFrameHeader, data); err != nil {
+		return nil, err
+	}
+	stats := &SnapshotStats{
+		Header: header,
+	}
+	if err := forEach(func(data []byte) error {
+		stats.Records++
+		return writeSnapshotFrame(hw, snapshotFrameRecord, data)
+	}); err != nil {
+		return nil, err
+	}
+	digest := h.Sum(nil)
+	sig, err := sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign snapshot: %v", err)
+	}
+	data, err = json.Marshal(&snapshotTrailer{
+		Records:   stats.Records,
+		Digest:    hex.EncodeToString(digest),
+		Signature: hex.EncodeToString(sig),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSnapshotFrame(bw, snapshotFrameTrailer, data); err != nil {
+		return nil, err
+	}
+	return stats, bw.Flush()
+}
+
+// readSnapshot reads frames up to the trailer and verifies it, fn is called for each record.
+func readSnapshot(r *bufio.Reader, fn func(record *proto.Record) error) (*SnapshotStats, error) {
+	h := sha256.New()
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return nil, fmt.Errorf("%v: bad magic", ErrInvalidSnapshot)
+	}
+	h.Write(magic)
+	typ, data, err := readSnapshotFrame(r, h)
+	if err != nil {
+		return nil, err
+	} else if typ != snapshotFrameHeader {
+		return nil, fmt.Errorf("%v: header expected", ErrInvalidSnapshot)
+	}
+	stats := &SnapshotStats{}
+	if err := json.Unmarshal(data, &stats.Header); err != nil {
+		return nil, fmt.Errorf("%v: bad header: %v", ErrInvalidSnapshot, err)
+	} else if stats.Header.Version != SnapshotVersion {
+		return nil, fmt.Errorf("%v: unsupported version %d", ErrInvalidSnapshot, stats.Header.Version)
+	}
+	for {
+		digest := h.Sum(nil)
+		typ, data, err := readSnapshotFrame(r, h)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case snapshotFrameRecord:
+			stats.Records++
+			seg, err := capn.ReadFromPackedStream(bytes.NewReader(data), nil)
+			if err != nil {
+				return nil, fmt.Errorf("%v: bad record #%d: %v", ErrInvalidSnapshot, stats.Records, err)
+			}
+			if fn == nil {
+				continue
+			}
+			record := proto.ReadRootRecord(seg)
+			if err := fn(&record); err != nil {
+				return nil, err
+			}
+		case snapshotFrameTrailer:
+			var trailer snapshotTrailer
+			if err := json.Unmarshal(data, &trailer); err != nil {
+				return nil, fmt.Errorf("%v: bad trailer: %v", ErrInvalidSnapshot, err)
+			} else if trailer.Records != stats.Records {
+				return nil, fmt.Errorf("%v: expected %d records, got %d", ErrInvalidSnapshot, trailer.Records, stats.Records)
+			} else if trailer.Digest != hex.EncodeToString(digest) {
+				return nil, fmt.Errorf("%v: digest mismatch", ErrInvalidSnapshot)
+			}
+			ok, err := fs.VerifyDataSignature(stats.Header.NodeID, trailer.Signature, digest)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", ErrInvalidSnapshot, err)
+			} else if !ok {
+				return nil, fmt.Errorf("%v: incorrect signature", ErrInvalidSnapshot)
+			}
+			log.Debugf("snapshot of %s verified: %d records", stats.Header.NodeID, stats.Records)
+			return stats, nil
+		default:
+			return nil, fmt.Errorf("%v: unexpected frame %q", ErrInvalidSnapshot, typ)
+		}
+	}
+}
+
+func writeSnapshotFrame(w io.Writer, typ byte, data []byte) error {
+	buf := make([]byte, 1+binary.MaxVarintLen64)
+	buf[0] = typ
+	n := binary.PutUvarint(buf[1:], uint64(len(data)))
+	if _, err := w.Write(buf[:1+n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readSnapshotFrame reads a single frame, its bytes are written into h.
+func readSnapshotFrame(r *bufio.Reader, h hash.Hash) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("%v: unexpected end of snapshot", ErrInvalidSnapshot)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, fmt.Errorf("%v: bad frame length", ErrInvalidSnapshot)
+	} else if size > maxSnapshotFrame {
+		return 0, nil, fmt.Errorf("%v: frame is too large: %d", ErrInvalidSnapshot, size)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, nil, fmt.Errorf("%v: truncated frame", ErrInvalidSnapshot)
+	}
+	buf := make([]byte, 1+binary.MaxVarintLen64)
+	buf[0] = typ
+	n := binary.PutUvarint(buf[1:], size)
+	h.Write(buf[:1+n])
+	h.Write(data)
+	return typ, data, nil
+}
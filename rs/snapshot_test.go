@@ -0,0 +1,75 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package rs
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	capn "github.com/glycerine/go-capnproto"
+	crypto "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+)
+
+func TestSnapshotSignature(t *testing.T) {
+	require := require.New(t)
+
+	priv, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(err)
+	id, err := peer.IDFromEd25519PublicKey(pub)
+	require.NoError(err)
+
+	var records [][]byte
+	for i := 0; i < 3; i++ {
+		rec := proto.AutoNewRecord(capn.NewBuffer(nil))
+		rec.SetId(proto.NewID())
+		rec.SetPath("/snapshot/test")
+		buf := new(bytes.Buffer)
+		_, err := rec.Segment.WriteToPacked(buf)
+		require.NoError(err)
+		records = append(records, buf.Bytes())
+	}
+	forEach := func(fn func(data []byte) error) error {
+		for _, data := range records {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	stats, err := writeSnapshot(buf, SnapshotHeader{
+		Version: SnapshotVersion,
+		NodeID:  id.Pretty(),
+	}, forEach, priv.Sign)
+	require.NoError(err)
+	require.Equal(3, stats.Records)
+
+	var paths []string
+	stats, err = readSnapshot(bufio.NewReader(bytes.NewReader(buf.Bytes())), func(record *proto.Record) error {
+		paths = append(paths, record.Path())
+		return nil
+	})
+	require.NoError(err)
+	require.Equal(3, stats.Records)
+	require.Equal(id.Pretty(), stats.Header.NodeID)
+	require.Equal([]string{"/snapshot/test", "/snapshot/test", "/snapshot/test"}, paths)
+
+	// any change of the signed part is detected
+	data := buf.Bytes()
+	tampered := make([]byte, len(data))
+	copy(tampered, data)
+	tampered[bytes.Index(tampered, []byte(`"nodeId"`))+1] = 'N'
+	_, err = VerifySnapshot(bytes.NewReader(tampered))
+	require.Error(err)
+
+	_, err = VerifySnapshot(bytes.NewReader(data[:len(data)-10]))
+	require.Error(err)
+}
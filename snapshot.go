@@ -0,0 +1,125 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/authcenter"
+	"github.com/AtlantPlatform/atlant-go/fs"
+	"github.com/AtlantPlatform/atlant-go/rs"
+	"github.com/AtlantPlatform/atlant-go/state"
+	"github.com/AtlantPlatform/atlant-go/version"
+)
+
+func exportCmd(c *cli.Cmd) {
+	c.Spec = "[--blocks] FILE"
+	file := c.StringArg("FILE", "", "Snapshot file to write.")
+	withBlocks := c.BoolOpt("blocks", false, "Include the pinned IPFS blocks as a CAR archive.")
+	c.Action = func() {
+		initNetwork()
+		env := "main"
+		if *envTestnet {
+			env = "test"
+		}
+		withOfflineStores(func(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore) {
+			f, err := os.Create(*file)
+			if err != nil {
+				log.Fatalln("failed to create snapshot file:", err)
+			}
+			defer f.Close()
+			stats, err := rs.ExportSnapshot(context.Background(), fileStore, stateStore, f, rs.SnapshotHeader{
+				Env:        env,
+				AppVersion: version.Version,
+				Blocks:     *withBlocks,
+			})
+			if err != nil {
+				log.Fatalln("snapshot export failed:", err)
+			}
+			log.WithFields(log.Fields{
+				"file":    *file,
+				"records": stats.Records,
+				"blocks":  stats.Blocks,
+			}).Infoln("snapshot exported")
+		})
+	}
+}
+
+func importCmd(c *cli.Cmd) {
+	file := c.StringArg("FILE", "", "Snapshot file to read.")
+	c.Action = func() {
+		initNetwork()
+		if authcenter.Default == nil {
+			log.Fatalln("refusing to import: publish permissions are known only within testnet.")
+		}
+		waitAuthEntries(10 * time.Second)
+		withOfflineStores(func(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore) {
+			f, err := os.Open(*file)
+			if err != nil {
+				log.Fatalln("failed to open snapshot file:", err)
+			}
+			defer f.Close()
+			stats, err := rs.ImportSnapshot(context.Background(), fileStore, stateStore, f)
+			if err != nil {
+				log.Fatalln("snapshot import failed:", err)
+			}
+			log.WithFields(log.Fields{
+				"file":     *file,
+				"nodeId":   stats.Header.NodeID,
+				"records":  stats.Records,
+				"imported": stats.Imported,
+				"blocks":   stats.Blocks,
+			}).Infoln("snapshot imported")
+		})
+	}
+}
+
+// withOfflineStores opens the stores of the node without starting the IPFS networking.
+func withOfflineStores(fn func(fileStore fs.PlanetaryFileStore, stateStore state.IndexedStore)) {
+	if !fileNotEmpty(filepath.Join(*fsDir, ipfsConfigFile)) {
+		log.Fatalln("fs dir is not initialized, please run atlant-go init")
+	}
+	injectPlugins()
+	fileStore, err := fs.NewPlanetaryFileStore(*fsDir,
+		fs.UseOnlineOpt(false),
+		fs.UsePubSubOpt(false),
+	)
+	if err != nil {
+		log.Fatalln("NewPlanetaryFileStore failed:", err)
+	}
+	defer func() {
+		if err := fileStore.Close(); err != nil {
+			log.Warningf("failed to close IPFS store: %v", err)
+		}
+	}()
+	stateStore, err := state.NewIndexedStore(*stateEngine, *stateDir)
+	if err != nil {
+		log.Fatalln("NewIndexedStore failed:", err)
+	}
+	defer func() {
+		if err := stateStore.Close(); err != nil {
+			log.Warningf("failed to close the state store: %v", err)
+		}
+	}()
+	fn(fileStore, stateStore)
+}
+
+// waitAuthEntries waits for the first refresh of the auth center, so permissions are known.
+func waitAuthEntries(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for len(authcenter.Default.Entries()) == 0 {
+		if time.Now().After(deadline) {
+			log.Warningln("auth center has no entries, records will be skipped")
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -74,28 +74,31 @@ func (s *badgerStore) Update(k *Key, fn ModifyFunc) error {
 		if fn == nil {
 			return nil
 		}
-		key := k.Bytes()
-		v, err := tx.Get(key)
-		if err == badger.ErrKeyNotFound {
-			vv, err := fn(k, nil)
-			if err == ErrNoUpdate {
-				return nil
-			} else if err != nil {
+		return s.updateTx(tx, k, fn)
+	})
+}
+
+// UpdateBatch modifies all keys within a single transaction, so either all changes
+// are committed or none of them if fn returns an error for any key.
+func (s *badgerStore) UpdateBatch(keys []*Key, fn ModifyFunc) error {
+	return s.db.Update(func(tx *badger.Txn) error {
+		if fn == nil {
+			return nil
+		}
+		for _, k := range keys {
+			if err := s.updateTx(tx, k, fn); err != nil {
 				return err
 			}
-			if k.TTL > 0 {
-				return tx.SetWithTTL(key, vv, k.TTL)
-			}
-			return tx.Set(key, vv)
-		} else if err != nil {
-			err = fmt.Errorf("item set error: %v", err)
-			return err
-		}
-		vv, err := v.ValueCopy(nil)
-		if err != nil {
-			return err
 		}
-		vv, err = fn(k, vv)
+		return nil
+	})
+}
+
+func (s *badgerStore) updateTx(tx *badger.Txn, k *Key, fn ModifyFunc) error {
+	key := k.Bytes()
+	v, err := tx.Get(key)
+	if err == badger.ErrKeyNotFound {
+		vv, err := fn(k, nil)
 		if err == ErrNoUpdate {
 			return nil
 		} else if err != nil {
@@ -105,7 +108,24 @@ func (s *badgerStore) Update(k *Key, fn ModifyFunc) error {
 			return tx.SetWithTTL(key, vv, k.TTL)
 		}
 		return tx.Set(key, vv)
-	})
+	} else if err != nil {
+		err = fmt.Errorf("item set error: %v", err)
+		return err
+	}
+	vv, err := v.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	vv, err = fn(k, vv)
+	if err == ErrNoUpdate {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if k.TTL > 0 {
+		return tx.SetWithTTL(key, vv, k.TTL)
+	}
+	return tx.Set(key, vv)
 }
 
 func (s *badgerStore) RangeKeys(b Bucket, fn KeyFunc) (*RangeOptions, error) {
@@ -117,13 +137,19 @@ func (s *badgerStore) RangeKeys(b Bucket, fn KeyFunc) (*RangeOptions, error) {
 		it := tx.NewIterator(opts)
 		defer it.Close()
 
-		for it.Seek(b.NewKey(nil).Bytes()); it.Valid(); it.Next() {
+		var n int
+		for it.Seek(b.NewKey(b.RangeOptions.Offset).Bytes()); it.Valid(); it.Next() {
 			item := it.Item()
 			k := (&Key{}).Unmarshal(item.Key())
-			if k.Bucket.ID != b.ID {
+			n++
+			if k.Bucket.ID != b.ID || (b.RangeOptions.Limit > 0 && n > b.RangeOptions.Limit) {
+				return nil
+			}
+			if err := fn(k); err == ErrRangeStop {
 				return nil
+			} else if err != nil {
+				return err
 			}
-			fn(k)
 		}
 		return nil
 	})
@@ -141,10 +167,12 @@ func (s *badgerStore) RangePeek(b Bucket, fn PeekFunc) (*RangeOptions, error) {
 		it := tx.NewIterator(opts)
 		defer it.Close()
 
-		for it.Seek(b.NewKey(nil).Bytes()); it.Valid(); it.Next() {
+		var n int
+		for it.Seek(b.NewKey(b.RangeOptions.Offset).Bytes()); it.Valid(); it.Next() {
 			item := it.Item()
 			k := (&Key{}).Unmarshal(item.Key())
-			if k.Bucket.ID != b.ID {
+			n++
+			if k.Bucket.ID != b.ID || (b.RangeOptions.Limit > 0 && n > b.RangeOptions.Limit) {
 				return nil
 			}
 			v, err := it.Item().ValueCopy(nil)
@@ -173,10 +201,12 @@ func (s *badgerStore) RangeModify(b Bucket, fn ModifyFunc) (*RangeOptions, error
 		it := tx.NewIterator(opts)
 		defer it.Close()
 
-		for it.Seek(b.NewKey(nil).Bytes()); it.Valid(); it.Next() {
+		var n int
+		for it.Seek(b.NewKey(b.RangeOptions.Offset).Bytes()); it.Valid(); it.Next() {
 			item := it.Item()
 			k := (&Key{}).Unmarshal(item.Key())
-			if k.Bucket.ID != b.ID {
+			n++
+			if k.Bucket.ID != b.ID || (b.RangeOptions.Limit > 0 && n > b.RangeOptions.Limit) {
 				return nil
 			}
 			v, err := it.Item().ValueCopy(nil)
@@ -189,10 +219,12 @@ func (s *badgerStore) RangeModify(b Bucket, fn ModifyFunc) (*RangeOptions, error
 			} else if err != nil && err != ErrRangeStop {
 				return err
 			}
-			if setErr := s.db.Update(func(tx *badger.Txn) error {
-				return tx.Set(item.Key(), vv)
-			}); setErr != nil {
-				return setErr
+			if vv != nil || err == nil {
+				if setErr := s.db.Update(func(tx *badger.Txn) error {
+					return tx.Set(item.Key(), vv)
+				}); setErr != nil {
+					return setErr
+				}
 			}
 			if err == ErrRangeStop {
 				return nil
@@ -207,7 +239,7 @@ func (s *badgerStore) Delete(k *Key) error {
 	if k == nil {
 		return nil
 	}
-	return s.db.View(func(tx *badger.Txn) error {
+	return s.db.Update(func(tx *badger.Txn) error {
 		if err := tx.Delete(k.Bytes()); err == badger.ErrKeyNotFound {
 			return nil
 		} else if err != nil {
@@ -0,0 +1,248 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// levelStore implements IndexedStore on LevelDB. Values are prefixed with their expiry time,
+// as LevelDB has no TTL, expired keys are skipped on read and removed periodically.
+type levelStore struct {
+	opts *storeOptions
+	db   *leveldb.DB
+	// mux serializes writes, so a read-modify-write is atomic
+	mux  *sync.Mutex
+	stop chan struct{}
+}
+
+var errMalformedValue = errors.New("malformed value")
+
+func newLevelStore(prefix string, opts ...storeOpt) (*levelStore, error) {
+	s := &levelStore{
+		opts: defaultStoreOptions(),
+		mux:  new(sync.Mutex),
+		stop: make(chan struct{}),
+	}
+	for _, o := range opts {
+		if o != nil {
+			o(s.opts)
+		}
+	}
+	db, err := leveldb.OpenFile(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.db = db
+	go s.runGC(s.opts.GCInterval)
+	return s, nil
+}
+
+// runGC removes expired keys.
+func (s *levelStore) runGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.mux.Lock()
+			batch := new(leveldb.Batch)
+			it := s.db.NewIterator(nil, nil)
+			for it.Next() {
+				if _, expired, err := decodeLevelValue(it.Value(), now); err == nil && expired {
+					batch.Delete(append([]byte(nil), it.Key()...))
+				}
+			}
+			it.Release()
+			if batch.Len() > 0 {
+				s.db.Write(batch, s.writeOptions())
+			}
+			s.mux.Unlock()
+		}
+	}
+}
+
+func (s *levelStore) writeOptions() *opt.WriteOptions {
+	return &opt.WriteOptions{
+		Sync: s.opts.SyncWrites,
+	}
+}
+
+func encodeLevelValue(v []byte, ttl time.Duration, now time.Time) []byte {
+	buf := make([]byte, 8+len(v))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(buf[:8], uint64(now.Add(ttl).UnixNano()))
+	}
+	copy(buf[8:], v)
+	return buf
+}
+
+// decodeLevelValue returns a copy of the value and whether it has expired.
+func decodeLevelValue(buf []byte, now time.Time) ([]byte, bool, error) {
+	if len(buf) < 8 {
+		return nil, false, errMalformedValue
+	}
+	expiresAt := int64(binary.BigEndian.Uint64(buf[:8]))
+	v := append([]byte(nil), buf[8:]...)
+	return v, expiresAt > 0 && expiresAt <= now.UnixNano(), nil
+}
+
+// get returns the value of the key, expired keys are not found.
+func (s *levelStore) get(key []byte, now time.Time) ([]byte, error) {
+	buf, err := s.db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		err = fmt.Errorf("item get error: %v", err)
+		return nil, err
+	}
+	v, expired, err := decodeLevelValue(buf, now)
+	if err != nil {
+		return nil, err
+	} else if expired {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *levelStore) View(k *Key, fn PeekFunc) error {
+	v, err := s.get(k.Bytes(), time.Now())
+	if err != nil {
+		return err
+	}
+	return fn(k, v)
+}
+
+func (s *levelStore) Update(k *Key, fn ModifyFunc) error {
+	if fn == nil {
+		return nil
+	}
+	return s.UpdateBatch([]*Key{k}, fn)
+}
+
+// UpdateBatch modifies all keys and writes them in a single batch, so either all changes
+// are committed or none of them if fn returns an error for any key.
+func (s *levelStore) UpdateBatch(keys []*Key, fn ModifyFunc) error {
+	if fn == nil {
+		return nil
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	// values written earlier in the batch
+	written := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		key := k.Bytes()
+		v, ok := written[string(key)]
+		if ok {
+			v = append([]byte(nil), v...)
+		} else if vv, err := s.get(key, now); err == nil {
+			v = vv
+		} else if err != ErrNotFound {
+			return err
+		}
+		vv, err := fn(k, v)
+		if err == ErrNoUpdate {
+			continue
+		} else if err != nil {
+			return err
+		}
+		batch.Put(key, encodeLevelValue(vv, k.TTL, now))
+		written[string(key)] = vv
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	return s.db.Write(batch, s.writeOptions())
+}
+
+func (s *levelStore) Delete(k *Key) error {
+	if k == nil {
+		return nil
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.db.Delete(k.Bytes(), s.writeOptions())
+}
+
+// rangeBucket calls fn for live entries of the bucket starting with the offset,
+// the prefetch option has no effect as LevelDB reads blocks ahead on its own.
+func (s *levelStore) rangeBucket(b Bucket, fn func(k *Key, v []byte) error) error {
+	r := util.BytesPrefix(b.ID.Bytes())
+	r.Start = b.NewKey(b.RangeOptions.Offset).Bytes()
+	it := s.db.NewIterator(r, nil)
+	defer it.Release()
+	now := time.Now()
+	var n int
+	for it.Next() {
+		v, expired, err := decodeLevelValue(it.Value(), now)
+		if err != nil {
+			return err
+		} else if expired {
+			continue
+		}
+		n++
+		if b.RangeOptions.Limit > 0 && n > b.RangeOptions.Limit {
+			return nil
+		}
+		k := (&Key{}).Unmarshal(it.Key())
+		if err := fn(k, v); err == ErrRangeStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+func (s *levelStore) RangeKeys(b Bucket, fn KeyFunc) (*RangeOptions, error) {
+	err := s.rangeBucket(b, func(k *Key, v []byte) error {
+		return fn(k)
+	})
+	return nil, err
+}
+
+func (s *levelStore) RangePeek(b Bucket, fn PeekFunc) (*RangeOptions, error) {
+	err := s.rangeBucket(b, fn)
+	return nil, err
+}
+
+// RangeModify calls fn for the bucket and stores the values returned, modified keys lose their TTL.
+func (s *levelStore) RangeModify(b Bucket, fn ModifyFunc) (*RangeOptions, error) {
+	err := s.rangeBucket(b, func(k *Key, v []byte) error {
+		vv, err := fn(k, v)
+		if err == ErrNoUpdate {
+			return nil
+		} else if err != nil && err != ErrRangeStop {
+			return err
+		}
+		if vv != nil || err == nil {
+			s.mux.Lock()
+			setErr := s.db.Put(k.Bytes(), encodeLevelValue(vv, 0, time.Now()), s.writeOptions())
+			s.mux.Unlock()
+			if setErr != nil {
+				return setErr
+			}
+		}
+		return err
+	})
+	return nil, err
+}
+
+func (s *levelStore) Close() error {
+	close(s.stop)
+	return s.db.Close()
+}
@@ -0,0 +1,250 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package state
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore implements IndexedStore in memory, nothing is persisted.
+type memoryStore struct {
+	opts *storeOptions
+	// mux guards items and is never held while callbacks run, so they can read the store
+	mux *sync.RWMutex
+	// writeMux serializes writes, so a read-modify-write is atomic
+	writeMux *sync.Mutex
+	items    map[string]*memoryItem
+	stop     chan struct{}
+}
+
+type memoryItem struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func (i *memoryItem) isExpired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
+
+func newMemoryStore(opts ...storeOpt) *memoryStore {
+	s := &memoryStore{
+		opts:     defaultStoreOptions(),
+		mux:      new(sync.RWMutex),
+		writeMux: new(sync.Mutex),
+		items:    make(map[string]*memoryItem),
+		stop:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		if o != nil {
+			o(s.opts)
+		}
+	}
+	go s.runGC(s.opts.GCInterval)
+	return s
+}
+
+// runGC removes expired keys.
+func (s *memoryStore) runGC(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.mux.Lock()
+			for key, item := range s.items {
+				if item.isExpired(now) {
+					delete(s.items, key)
+				}
+			}
+			s.mux.Unlock()
+		}
+	}
+}
+
+// get returns a copy of the value, expired keys are not found.
+func (s *memoryStore) get(key string, now time.Time) ([]byte, bool) {
+	item, ok := s.items[key]
+	if !ok || item.isExpired(now) {
+		return nil, false
+	}
+	return append([]byte(nil), item.value...), true
+}
+
+func (s *memoryStore) set(key string, v []byte, ttl time.Duration, now time.Time) {
+	item := &memoryItem{
+		value: append([]byte(nil), v...),
+	}
+	if ttl > 0 {
+		item.expiresAt = now.Add(ttl)
+	}
+	s.items[key] = item
+}
+
+func (s *memoryStore) View(k *Key, fn PeekFunc) error {
+	s.mux.RLock()
+	v, ok := s.get(string(k.Bytes()), time.Now())
+	s.mux.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return fn(k, v)
+}
+
+func (s *memoryStore) Update(k *Key, fn ModifyFunc) error {
+	if fn == nil {
+		return nil
+	}
+	return s.UpdateBatch([]*Key{k}, fn)
+}
+
+// UpdateBatch modifies all keys under the write lock, changes are applied
+// only if fn succeeds for every key.
+func (s *memoryStore) UpdateBatch(keys []*Key, fn ModifyFunc) error {
+	if fn == nil {
+		return nil
+	}
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	now := time.Now()
+	type change struct {
+		value []byte
+		ttl   time.Duration
+	}
+	changes := make(map[string]*change, len(keys))
+	var order []string
+	for _, k := range keys {
+		key := string(k.Bytes())
+		var v []byte
+		if c, ok := changes[key]; ok {
+			v = append([]byte(nil), c.value...)
+		} else {
+			s.mux.RLock()
+			v, _ = s.get(key, now)
+			s.mux.RUnlock()
+		}
+		vv, err := fn(k, v)
+		if err == ErrNoUpdate {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if _, ok := changes[key]; !ok {
+			order = append(order, key)
+		}
+		changes[key] = &change{
+			value: vv,
+			ttl:   k.TTL,
+		}
+	}
+	s.mux.Lock()
+	for _, key := range order {
+		s.set(key, changes[key].value, changes[key].ttl, now)
+	}
+	s.mux.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Delete(k *Key) error {
+	if k == nil {
+		return nil
+	}
+	s.writeMux.Lock()
+	s.mux.Lock()
+	delete(s.items, string(k.Bytes()))
+	s.mux.Unlock()
+	s.writeMux.Unlock()
+	return nil
+}
+
+type memoryEntry struct {
+	key   *Key
+	value []byte
+}
+
+// snapshot returns copies of live entries of the bucket starting with the offset, ordered by key.
+func (s *memoryStore) snapshot(b Bucket) []memoryEntry {
+	prefix := b.ID.Bytes()
+	start := string(b.NewKey(b.RangeOptions.Offset).Bytes())
+	now := time.Now()
+
+	s.mux.RLock()
+	keys := make([]string, 0, len(s.items))
+	for key, item := range s.items {
+		if key >= start && bytes.HasPrefix([]byte(key), prefix) && !item.isExpired(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit := b.RangeOptions.Limit; limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+	entries := make([]memoryEntry, 0, len(keys))
+	for _, key := range keys {
+		v, _ := s.get(key, now)
+		entries = append(entries, memoryEntry{
+			key:   (&Key{}).Unmarshal([]byte(key)),
+			value: v,
+		})
+	}
+	s.mux.RUnlock()
+	return entries
+}
+
+// RangeKeys calls fn for keys of the bucket, the prefetch option has no effect in memory.
+func (s *memoryStore) RangeKeys(b Bucket, fn KeyFunc) (*RangeOptions, error) {
+	for _, e := range s.snapshot(b) {
+		if err := fn(e.key); err == ErrRangeStop {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) RangePeek(b Bucket, fn PeekFunc) (*RangeOptions, error) {
+	for _, e := range s.snapshot(b) {
+		if err := fn(e.key, e.value); err == ErrRangeStop {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// RangeModify calls fn for a snapshot of the bucket and stores the values returned,
+// modified keys lose their TTL.
+func (s *memoryStore) RangeModify(b Bucket, fn ModifyFunc) (*RangeOptions, error) {
+	for _, e := range s.snapshot(b) {
+		vv, err := fn(e.key, e.value)
+		if err == ErrNoUpdate {
+			continue
+		} else if err != nil && err != ErrRangeStop {
+			return nil, err
+		}
+		if vv != nil || err == nil {
+			s.writeMux.Lock()
+			s.mux.Lock()
+			s.set(string(e.key.Bytes()), vv, 0, time.Now())
+			s.mux.Unlock()
+			s.writeMux.Unlock()
+		}
+		if err == ErrRangeStop {
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryStore) Close() error {
+	close(s.stop)
+	return nil
+}
@@ -5,9 +5,11 @@
 package state
 
 import (
+	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"path/filepath"
 	"time"
 )
 
@@ -16,9 +18,14 @@ var ErrNotFound = errors.New("not found")
 // IndexedStore is an interface to internal node state.
 // The state includes file names, version history, in other words it's a collection of indexed metadata.
 // The state must be synchronised across all utility Atlant nodes.
+//
+// Callbacks of Update, UpdateBatch and RangeModify may read the store, but must not write to it:
+// engines serialize writes, so a nested write deadlocks.
 type IndexedStore interface {
 	View(k *Key, fn PeekFunc) error
 	Update(k *Key, fn ModifyFunc) error
+	// UpdateBatch applies fn to every key in a single transaction, all-or-nothing.
+	UpdateBatch(keys []*Key, fn ModifyFunc) error
 	Delete(k *Key) error
 
 	RangeKeys(b Bucket, fn KeyFunc) (*RangeOptions, error)
@@ -49,9 +56,22 @@ func (b Bucket) WithRangeOptions(opt *RangeOptions) Bucket {
 }
 
 var (
-	BucketRecords   BucketID = 0x10
-	BucketBeatTicks BucketID = 0x11
-	BucketBeatInfos BucketID = 0x12
+	BucketRecords         BucketID = 0x10
+	BucketBeatTicks       BucketID = 0x11
+	BucketBeatInfos       BucketID = 0x12
+	BucketPathIndex       BucketID = 0x13
+	BucketMeta            BucketID = 0x14
+	BucketSyncCursors     BucketID = 0x15
+	BucketChanges         BucketID = 0x16
+	BucketWebhooks        BucketID = 0x17
+	BucketWebhookFailures BucketID = 0x18
+	BucketExpiry          BucketID = 0x19
+	BucketRecovered       BucketID = 0x1A
+	BucketPendingFetch    BucketID = 0x1B
+	BucketOutbound        BucketID = 0x1C
+	BucketSeenAnnounces   BucketID = 0x1D
+	BucketConflicts       BucketID = 0x1E
+	BucketCredentials     BucketID = 0x1F
 )
 
 var NoKey = Bucket{}.NewKey(nil)
@@ -64,6 +84,9 @@ func (b Bucket) NewKey(key []byte) *Key {
 	return k
 }
 
+// RangeOptions limit a range over the bucket: it starts with the first key not less than Offset
+// and visits up to Limit keys, zero means all of them. Prefetch is a hint of how many values
+// to read ahead, backends that have no use for it ignore it.
 type RangeOptions struct {
 	Prefetch int
 	Offset   []byte
@@ -96,6 +119,13 @@ func NewKey(bucket BucketID, key []byte) *Key {
 	return k
 }
 
+// NewHashedKey creates a key from a value of arbitrary length, the value is replaced
+// by its SHA-256 digest truncated to the key size.
+func NewHashedKey(bucket BucketID, value []byte) *Key {
+	sum := sha256.Sum256(value)
+	return NewKey(bucket, sum[:])
+}
+
 func (k *Key) WithinBucket(b Bucket) *Key {
 	return &Key{
 		Bucket: b,
@@ -112,7 +142,7 @@ func (k *Key) Bytes() []byte {
 
 func (k *Key) Unmarshal(buf []byte) *Key {
 	k.Bucket.ID = BucketID(binary.BigEndian.Uint16(buf[:2]))
-	copy(k.Key[:], buf)
+	copy(k.Key[:], buf[2:])
 	return k
 }
 
@@ -133,6 +163,50 @@ type KeyFunc func(k *Key) error
 type PeekFunc func(k *Key, v []byte) error
 type ModifyFunc func(k *Key, v []byte) ([]byte, error)
 
+// Engines of the state store.
+const (
+	EngineBadger  = "badger"
+	EngineLevelDB = "leveldb"
+	EngineMemory  = "memory"
+)
+
+// ErrUnknownEngine to be thrown when the state store engine is not supported
+var ErrUnknownEngine = errors.New("unknown state engine, available: badger, leveldb, memory")
+
+// NewIndexedStore opens the state store of the engine in the directory. LevelDB keeps its
+// files in the leveldb subdirectory, so it doesn't mix them with Badger ones. Memory engine
+// persists nothing.
+func NewIndexedStore(engine, prefix string, opts ...storeOpt) (IndexedStore, error) {
+	switch engine {
+	case EngineBadger:
+		return NewIndexedStoreBadger(prefix, opts...)
+	case EngineLevelDB:
+		return NewIndexedStoreLevelDB(filepath.Join(prefix, EngineLevelDB), opts...)
+	case EngineMemory:
+		return NewIndexedStoreMemory(opts...), nil
+	default:
+		return nil, ErrUnknownEngine
+	}
+}
+
 func NewIndexedStoreBadger(prefix string, opts ...storeOpt) (IndexedStore, error) {
-	return newBadgerStore(prefix, opts...)
+	s, err := newBadgerStore(prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewIndexedStoreLevelDB opens the state store on LevelDB in the directory.
+func NewIndexedStoreLevelDB(prefix string, opts ...storeOpt) (IndexedStore, error) {
+	s, err := newLevelStore(prefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewIndexedStoreMemory creates the state store that keeps everything in memory.
+func NewIndexedStoreMemory(opts ...storeOpt) IndexedStore {
+	return newMemoryStore(opts...)
 }
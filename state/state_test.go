@@ -0,0 +1,313 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package state
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBadgerStore(t *testing.T) {
+	testIndexedStore(t, func() (IndexedStore, func()) {
+		dir, err := ioutil.TempDir("", "atlant-state-badger-")
+		require.NoError(t, err)
+		ss, err := NewIndexedStore(EngineBadger, dir)
+		require.NoError(t, err)
+		return ss, func() {
+			ss.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestLevelDBStore(t *testing.T) {
+	testIndexedStore(t, func() (IndexedStore, func()) {
+		dir, err := ioutil.TempDir("", "atlant-state-leveldb-")
+		require.NoError(t, err)
+		ss, err := NewIndexedStore(EngineLevelDB, dir)
+		require.NoError(t, err)
+		return ss, func() {
+			ss.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testIndexedStore(t, func() (IndexedStore, func()) {
+		ss, err := NewIndexedStore(EngineMemory, "")
+		require.NoError(t, err)
+		return ss, func() {
+			ss.Close()
+		}
+	})
+}
+
+func TestUnknownEngine(t *testing.T) {
+	require := require.New(t)
+
+	ss, err := NewIndexedStore("bolt", "")
+	require.Equal(ErrUnknownEngine, err)
+	require.Nil(ss)
+}
+
+// testIndexedStore is the conformance suite every IndexedStore backend must pass.
+func testIndexedStore(t *testing.T, open func() (IndexedStore, func())) {
+	set := func(v string) ModifyFunc {
+		return func(k *Key, _ []byte) ([]byte, error) {
+			return []byte(v), nil
+		}
+	}
+	get := func(ss IndexedStore, k *Key) (string, error) {
+		var value string
+		err := ss.View(k, func(k *Key, v []byte) error {
+			value = string(v)
+			return nil
+		})
+		return value, err
+	}
+	errFailed := errors.New("failed")
+
+	t.Run("Update", func(t *testing.T) {
+		require := require.New(t)
+		ss, closeFn := open()
+		defer closeFn()
+
+		k := NewKey(BucketMeta, []byte("key"))
+		_, err := get(ss, k)
+		require.Equal(ErrNotFound, err)
+		require.NoError(ss.Update(k, func(k *Key, v []byte) ([]byte, error) {
+			require.Nil(v)
+			return []byte("v1"), nil
+		}))
+		require.NoError(ss.Update(k, func(k *Key, v []byte) ([]byte, error) {
+			require.Equal("v1", string(v))
+			return nil, ErrNoUpdate
+		}))
+		require.Equal(errFailed, ss.Update(k, func(k *Key, v []byte) ([]byte, error) {
+			return []byte("v2"), errFailed
+		}))
+		v, err := get(ss, k)
+		require.NoError(err)
+		require.Equal("v1", v)
+
+		// the same key in other bucket is a different one
+		_, err = get(ss, NewKey(BucketRecords, []byte("key")))
+		require.Equal(ErrNotFound, err)
+
+		require.NoError(ss.Delete(k))
+		require.NoError(ss.Delete(k))
+		_, err = get(ss, k)
+		require.Equal(ErrNotFound, err)
+	})
+
+	t.Run("UpdateBatch", func(t *testing.T) {
+		require := require.New(t)
+		ss, closeFn := open()
+		defer closeFn()
+
+		k1, k2 := NewKey(BucketMeta, []byte("k1")), NewKey(BucketMeta, []byte("k2"))
+		require.Equal(errFailed, ss.UpdateBatch([]*Key{k1, k2}, func(k *Key, v []byte) ([]byte, error) {
+			if k == k2 {
+				return nil, errFailed
+			}
+			return []byte("v1"), nil
+		}))
+		_, err := get(ss, k1)
+		require.Equal(ErrNotFound, err)
+
+		// later updates of the same key see the earlier ones
+		require.NoError(ss.UpdateBatch([]*Key{k1, k2, k1}, func(k *Key, v []byte) ([]byte, error) {
+			return append(v, 'x'), nil
+		}))
+		v, err := get(ss, k1)
+		require.NoError(err)
+		require.Equal("xx", v)
+		v, err = get(ss, k2)
+		require.NoError(err)
+		require.Equal("x", v)
+	})
+
+	t.Run("ReadInUpdate", func(t *testing.T) {
+		require := require.New(t)
+		ss, closeFn := open()
+		defer closeFn()
+
+		other := NewKey(BucketConflicts, []byte("other"))
+		require.NoError(ss.Update(other, set("v")))
+		// callbacks may read the store, e.g. to check other buckets
+		read := func(k *Key, v []byte) ([]byte, error) {
+			value, err := get(ss, other)
+			if err != nil {
+				return nil, err
+			}
+			var n int
+			if _, err := ss.RangeKeys(NewBucket(BucketConflicts), func(k *Key) error {
+				n++
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+			return []byte(fmt.Sprintf("%s%d", value, n)), nil
+		}
+		done := make(chan error, 1)
+		go func() {
+			k1, k2 := NewKey(BucketRecords, []byte("k1")), NewKey(BucketRecords, []byte("k2"))
+			if err := ss.Update(k1, read); err != nil {
+				done <- err
+				return
+			}
+			done <- ss.UpdateBatch([]*Key{k1, k2}, read)
+		}()
+		select {
+		case err := <-done:
+			require.NoError(err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("reading the store within an update has deadlocked")
+		}
+		v, err := get(ss, NewKey(BucketRecords, []byte("k2")))
+		require.NoError(err)
+		require.Equal("v1", v)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		require := require.New(t)
+		ss, closeFn := open()
+		defer closeFn()
+
+		k := NewKey(BucketSeenAnnounces, []byte("expiring"))
+		k.TTL = time.Second
+		require.NoError(ss.Update(k, set("v")))
+		require.NoError(ss.Update(NewKey(BucketSeenAnnounces, []byte("kept")), set("v")))
+		_, err := get(ss, k)
+		require.NoError(err)
+
+		time.Sleep(2 * time.Second)
+		_, err = get(ss, k)
+		require.Equal(ErrNotFound, err)
+		var keys []string
+		_, err = ss.RangeKeys(NewBucket(BucketSeenAnnounces), func(k *Key) error {
+			keys = append(keys, string(k.Key[:4]))
+			return nil
+		})
+		require.NoError(err)
+		require.Equal([]string{"kept"}, keys)
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		require := require.New(t)
+		ss, closeFn := open()
+		defer closeFn()
+
+		for _, key := range []string{"c", "a", "d", "b"} {
+			require.NoError(ss.Update(NewKey(BucketChanges, []byte(key)), set("v"+key)))
+		}
+		require.NoError(ss.Update(NewKey(BucketConflicts, []byte("a")), set("other")))
+		require.NoError(ss.Update(NewKey(BucketBeatInfos, []byte("z")), set("other")))
+
+		rangePeek := func(opts *RangeOptions, stopAt string) ([]string, error) {
+			var values []string
+			_, err := ss.RangePeek(NewBucket(BucketChanges, opts), func(k *Key, v []byte) error {
+				values = append(values, string(v))
+				if string(v) == stopAt {
+					return ErrRangeStop
+				}
+				return nil
+			})
+			return values, err
+		}
+		values, err := rangePeek(nil, "")
+		require.NoError(err)
+		require.Equal([]string{"va", "vb", "vc", "vd"}, values)
+		values, err = rangePeek(&RangeOptions{
+			Prefetch: 100,
+			Offset:   []byte("b"),
+			Limit:    2,
+		}, "")
+		require.NoError(err)
+		require.Equal([]string{"vb", "vc"}, values)
+		values, err = rangePeek(&RangeOptions{
+			Offset: []byte("bb"),
+		}, "")
+		require.NoError(err)
+		require.Equal([]string{"vc", "vd"}, values)
+		values, err = rangePeek(nil, "vb")
+		require.NoError(err)
+		require.Equal([]string{"va", "vb"}, values)
+
+		_, err = ss.RangePeek(NewBucket(BucketChanges), func(k *Key, v []byte) error {
+			return errFailed
+		})
+		require.Equal(errFailed, err)
+
+		var keys []string
+		_, err = ss.RangeKeys(NewBucket(BucketChanges, &RangeOptions{
+			Offset: []byte("b"),
+		}), func(k *Key) error {
+			require.Equal(BucketChanges, k.Bucket.ID)
+			keys = append(keys, string(k.Key[:1]))
+			if len(keys) == 2 {
+				return ErrRangeStop
+			}
+			return nil
+		})
+		require.NoError(err)
+		require.Equal([]string{"b", "c"}, keys)
+		_, err = ss.RangeKeys(NewBucket(BucketChanges), func(k *Key) error {
+			return errFailed
+		})
+		require.Equal(errFailed, err)
+	})
+
+	t.Run("RangeModify", func(t *testing.T) {
+		require := require.New(t)
+		ss, closeFn := open()
+		defer closeFn()
+
+		for _, key := range []string{"a", "b", "c", "d"} {
+			require.NoError(ss.Update(NewKey(BucketRecords, []byte(key)), set("v"+key)))
+		}
+		_, err := ss.RangeModify(NewBucket(BucketRecords), func(k *Key, v []byte) ([]byte, error) {
+			switch string(v) {
+			case "va":
+				return nil, ErrNoUpdate
+			case "vb":
+				return []byte("vb2"), nil
+			case "vc":
+				return []byte("vc2"), ErrRangeStop
+			default:
+				return []byte("unexpected"), nil
+			}
+		})
+		require.NoError(err)
+		var values []string
+		_, err = ss.RangePeek(NewBucket(BucketRecords), func(k *Key, v []byte) error {
+			values = append(values, string(v))
+			return nil
+		})
+		require.NoError(err)
+		require.Equal([]string{"va", "vb2", "vc2", "vd"}, values)
+
+		// stopping without a value leaves the key as is
+		_, err = ss.RangeModify(NewBucket(BucketRecords), func(k *Key, v []byte) ([]byte, error) {
+			return nil, ErrRangeStop
+		})
+		require.NoError(err)
+		v, err := get(ss, NewKey(BucketRecords, []byte("a")))
+		require.NoError(err)
+		require.Equal("va", v)
+
+		_, err = ss.RangeModify(NewBucket(BucketRecords), func(k *Key, v []byte) ([]byte, error) {
+			return nil, errFailed
+		})
+		require.Equal(errFailed, err)
+	})
+}
@@ -0,0 +1,406 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+// Package webhooks delivers record changes to HTTP callbacks registered for path prefixes.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/AtlantPlatform/atlant-go/proto"
+	"github.com/AtlantPlatform/atlant-go/rs"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+// Webhook is a registered HTTP callback for changes of records under the prefix.
+type Webhook struct {
+	ID        string `json:"id"`
+	Prefix    string `json:"prefix"`
+	URL       string `json:"url"`
+	Secret    string `json:"secret,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// Delivery is the JSON payload POSTed to the webhook URL.
+type Delivery struct {
+	WebhookID string           `json:"webhookId"`
+	Change    *rs.RecordChange `json:"change"`
+}
+
+// Failure is a delivery that has not succeeded after all retries.
+type Failure struct {
+	ID        string           `json:"id"`
+	WebhookID string           `json:"webhookId"`
+	URL       string           `json:"url"`
+	Change    *rs.RecordChange `json:"change"`
+	Attempts  int              `json:"attempts"`
+	LastError string           `json:"lastError"`
+	FailedAt  int64            `json:"failedAt"`
+}
+
+// SignatureHeader contains HMAC-SHA256 of the request body keyed by the webhook secret.
+const SignatureHeader = "X-Atlant-Signature"
+
+var (
+	// ErrNotFound to be thrown when webhook is not registered
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalidWebhook to be thrown when webhook has invalid prefix or URL
+	ErrInvalidWebhook = errors.New("webhook must have a prefix and an absolute http(s) URL")
+	// ErrPrivateDestination to be thrown when webhook URL resolves to a loopback, private or link-local address
+	ErrPrivateDestination = errors.New("webhook URL resolves to a non-public address")
+)
+
+var (
+	// defaultFailureTTL is the period for which failed deliveries can be queried.
+	defaultFailureTTL = 7 * 24 * time.Hour
+	// defaultMaxRetryTime limits the total time of delivery retries.
+	defaultMaxRetryTime = 15 * time.Minute
+)
+
+// Manager keeps the webhook registry and delivers record changes.
+type Manager struct {
+	ss    state.IndexedStore
+	store rs.PlanetaryRecordStore
+	cli   *http.Client
+
+	allowPrivate bool
+
+	hooksMux *sync.RWMutex
+	hooks    []*Webhook
+	jobs     chan *job
+}
+
+type job struct {
+	hook   *Webhook
+	change *rs.RecordChange
+}
+
+// ManagerOpt configures the webhook manager.
+type ManagerOpt func(m *Manager)
+
+// AllowPrivateOpt allows webhook URLs on loopback, private and link-local addresses,
+// otherwise such URLs are refused on registration and connections to them on delivery.
+func AllowPrivateOpt(allow bool) ManagerOpt {
+	return func(m *Manager) {
+		m.allowPrivate = allow
+	}
+}
+
+// NewManager creates a webhook manager using the state store for the registry.
+func NewManager(ss state.IndexedStore, store rs.PlanetaryRecordStore, opts ...ManagerOpt) *Manager {
+	m := &Manager{
+		ss:       ss,
+		store:    store,
+		hooksMux: new(sync.RWMutex),
+		jobs:     make(chan *job, 1024),
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !m.allowPrivate {
+		// checked on dial as well, the host may resolve differently than on registration
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%v: %s", ErrPrivateDestination, host)
+			}
+			return nil
+		}
+	}
+	m.cli = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+	return m
+}
+
+// isPublicIP tells whether the address is routable on the internet.
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
+
+// checkDestination resolves the host of the webhook URL and refuses non-public addresses.
+func (m *Manager) checkDestination(u *url.URL) error {
+	if m.allowPrivate {
+		return nil
+	}
+	host := u.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.LookupIP(host)
+		if err != nil {
+			log.Debugf("failed to resolve webhook host %s: %v", host, err)
+			return ErrInvalidWebhook
+		}
+		ips = addrs
+	}
+	for _, ip := range ips {
+		if !isPublicIP(ip) {
+			return ErrPrivateDestination
+		}
+	}
+	return nil
+}
+
+// Run watches record changes and delivers them to matching webhooks until ctx is done.
+func (m *Manager) Run(ctx context.Context, workers int) {
+	if err := m.reload(); err != nil {
+		log.Warningf("failed to load webhooks: %v", err)
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-m.jobs:
+					m.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+	var cursor string
+	for {
+		changes, err := m.store.WatchRecords(ctx, "", cursor)
+		if err != nil {
+			log.Warningf("failed to watch record changes: %v", err)
+		} else {
+			for change := range changes {
+				cursor = change.ID
+				m.dispatch(ctx, change)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+			// watcher has fallen behind, resume from cursor
+		}
+	}
+}
+
+func (m *Manager) dispatch(ctx context.Context, change *rs.RecordChange) {
+	m.hooksMux.RLock()
+	defer m.hooksMux.RUnlock()
+	for _, hook := range m.hooks {
+		if !strings.HasPrefix(change.Path, hook.Prefix) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case m.jobs <- &job{
+			hook:   hook,
+			change: change,
+		}:
+		}
+	}
+}
+
+func (m *Manager) deliver(ctx context.Context, j *job) {
+	body, err := json.Marshal(&Delivery{
+		WebhookID: j.hook.ID,
+		Change:    j.change,
+	})
+	if err != nil {
+		log.Warningf("failed to encode webhook delivery: %v", err)
+		return
+	}
+	var attempts int
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = defaultMaxRetryTime
+	err = backoff.Retry(func() error {
+		attempts++
+		err := m.post(ctx, j.hook, body)
+		if err != nil && ctx.Err() != nil {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(b, ctx))
+	if err == nil {
+		return
+	}
+	if perr, ok := err.(*backoff.PermanentError); ok {
+		err = perr.Err
+	}
+	log.WithFields(log.Fields{
+		"webhook": j.hook.ID,
+		"url":     j.hook.URL,
+	}).Warningf("webhook delivery failed after %d attempts: %v", attempts, err)
+	f := &Failure{
+		ID:        proto.NewID(),
+		WebhookID: j.hook.ID,
+		URL:       j.hook.URL,
+		Change:    j.change,
+		Attempts:  attempts,
+		LastError: err.Error(),
+		FailedAt:  time.Now().UnixNano(),
+	}
+	k := state.NewKey(state.BucketWebhookFailures, []byte(f.ID))
+	k.TTL = defaultFailureTTL
+	if err := m.ss.Update(k, func(k *state.Key, v []byte) ([]byte, error) {
+		return json.Marshal(f)
+	}); err != nil {
+		log.Warningf("failed to store webhook failure: %v", err)
+	}
+}
+
+func (m *Manager) post(ctx context.Context, hook *Webhook, body []byte) error {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return backoff.Permanent(err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Atlant-Webhook-ID", hook.ID)
+	if len(hook.Secret) > 0 {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(hook.Secret, body))
+	}
+	resp, err := m.cli.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns hex-encoded HMAC-SHA256 of the body, receivers should compare it with SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (m *Manager) reload() error {
+	var hooks []*Webhook
+	b := state.NewBucket(state.BucketWebhooks)
+	if _, err := m.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+		var hook *Webhook
+		if err := json.Unmarshal(v, &hook); err != nil {
+			log.Warningf("skipping invalid webhook: %v", err)
+			return nil
+		}
+		hooks = append(hooks, hook)
+		return nil
+	}); err != nil {
+		return err
+	}
+	m.hooksMux.Lock()
+	m.hooks = hooks
+	m.hooksMux.Unlock()
+	return nil
+}
+
+// Register validates and stores a new webhook, returns it with ID assigned.
+func (m *Manager) Register(prefix, hookURL, secret string) (*Webhook, error) {
+	if len(prefix) == 0 || !strings.HasPrefix(prefix, "/") {
+		return nil, ErrInvalidWebhook
+	}
+	u, err := url.Parse(hookURL)
+	if err != nil || !u.IsAbs() || len(u.Hostname()) == 0 ||
+		(u.Scheme != "http" && u.Scheme != "https") {
+		return nil, ErrInvalidWebhook
+	} else if err := m.checkDestination(u); err != nil {
+		return nil, err
+	}
+	hook := &Webhook{
+		ID:        proto.NewID(),
+		Prefix:    prefix,
+		URL:       hookURL,
+		Secret:    secret,
+		CreatedAt: time.Now().UnixNano(),
+	}
+	if err := m.ss.Update(state.NewKey(state.BucketWebhooks, []byte(hook.ID)),
+		func(k *state.Key, v []byte) ([]byte, error) {
+			return json.Marshal(hook)
+		}); err != nil {
+		return nil, err
+	}
+	if err := m.reload(); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// Unregister removes the webhook, pending deliveries are still attempted.
+func (m *Manager) Unregister(id string) error {
+	k := state.NewKey(state.BucketWebhooks, []byte(id))
+	if err := m.ss.View(k, func(k *state.Key, v []byte) error {
+		return nil
+	}); err == state.ErrNotFound {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	if err := m.ss.Delete(k); err != nil {
+		return err
+	}
+	return m.reload()
+}
+
+// List returns all registered webhooks, secrets are omitted.
+func (m *Manager) List() []*Webhook {
+	m.hooksMux.RLock()
+	defer m.hooksMux.RUnlock()
+	list := make([]*Webhook, 0, len(m.hooks))
+	for _, hook := range m.hooks {
+		h := *hook
+		h.Secret = ""
+		list = append(list, &h)
+	}
+	return list
+}
+
+// Failures returns failed deliveries, optionally only those of the specified webhook.
+func (m *Manager) Failures(webhookID string) ([]*Failure, error) {
+	var failures []*Failure
+	b := state.NewBucket(state.BucketWebhookFailures)
+	if _, err := m.ss.RangePeek(b, func(k *state.Key, v []byte) error {
+		var f *Failure
+		if err := json.Unmarshal(v, &f); err != nil {
+			return nil
+		} else if len(webhookID) > 0 && f.WebhookID != webhookID {
+			return nil
+		}
+		failures = append(failures, f)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
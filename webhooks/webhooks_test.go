@@ -0,0 +1,97 @@
+// Copyright 2017-2021 Digital Asset Exchange Limited. All rights reserved.
+// Use of this source code is governed by BSD-3-Clause "New" or "Revised"
+// License (BSD-3-Clause) that can be found in the LICENSE file.
+
+package webhooks
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/AtlantPlatform/atlant-go/rs"
+	"github.com/AtlantPlatform/atlant-go/state"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	require := require.New(t)
+
+	ss := state.NewIndexedStoreMemory()
+	defer ss.Close()
+	m := NewManager(ss, nil, AllowPrivateOpt(true))
+
+	_, err := m.Register("properties", "http://localhost", "")
+	require.Equal(ErrInvalidWebhook, err)
+
+	delivered := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != "sha256="+Sign("secret", body) {
+			delivered <- "invalid signature"
+			return
+		}
+		delivered <- r.Header.Get("X-Atlant-Webhook-ID")
+	}))
+	defer srv.Close()
+
+	hook, err := m.Register("/properties/", srv.URL, "secret")
+	require.NoError(err)
+	require.Len(m.List(), 1)
+	require.Empty(m.List()[0].Secret)
+
+	m.dispatch(context.Background(), &rs.RecordChange{
+		ID:   "1",
+		Path: "/configs/pto/x.json",
+	})
+	m.dispatch(context.Background(), &rs.RecordChange{
+		ID:   "2",
+		Path: "/properties/x.pdf",
+	})
+	require.Len(m.jobs, 1)
+	m.deliver(context.Background(), <-m.jobs)
+	require.Equal(hook.ID, <-delivered)
+
+	require.NoError(m.Unregister(hook.ID))
+	require.Empty(m.List())
+	require.Equal(ErrNotFound, m.Unregister(hook.ID))
+}
+
+func TestWebhookPrivateDestination(t *testing.T) {
+	require := require.New(t)
+
+	ss := state.NewIndexedStoreMemory()
+	defer ss.Close()
+	m := NewManager(ss, nil)
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		_, err := m.Register("/properties/", u, "")
+		require.Equal(ErrPrivateDestination, err, u)
+	}
+	_, err := m.Register("/properties/", "http:///hook", "")
+	require.Equal(ErrInvalidWebhook, err)
+	require.Empty(m.List())
+
+	hook, err := m.Register("/properties/", "https://93.184.216.34/hook", "")
+	require.NoError(err)
+
+	// a host resolving to a private address after registration is refused on dial
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	hook.URL = srv.URL
+	err = m.post(context.Background(), hook, []byte("{}"))
+	require.Error(err)
+	require.Contains(err.Error(), ErrPrivateDestination.Error())
+}